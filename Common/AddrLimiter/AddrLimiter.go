@@ -3,12 +3,155 @@ package AddrLimiter
 import (
 	"errors"
 	"net"
+	"sync"
 )
 
-var whilteList = make(map[string]bool, 10)
+const DefaultList = "default" // 默认名单, 即IP白名单
+
+// 本机地址默认在白名单中
+var loopbackList = []string{"127.0.0.1", "::1"}
+
+// ListConfig 名单配置, 支持IP与CIDR(IPv4/IPv6)
+//	Deny优先: 命中Deny则拒绝; Allow为空则放行其余地址, 否则须命中Allow
+type ListConfig struct {
+	Allow []string
+	Deny  []string
+}
+
+// Config 访问控制配置
+type Config struct {
+	Lists          map[string]ListConfig // 名称->名单, 路由通过名称引用
+	TrustedProxies []string              // 可信代理, 仅来自可信代理的请求才读取 X-Real-IP/X-Forwarded-For
+}
+
+type ipList []*net.IPNet
+
+func (list ipList) contains(ip net.IP) bool {
+	for _, ipNet := range list {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIPList 解析IP或CIDR列表, 单个IP视为/32或/128
+func parseIPList(strList []string) (ipList, error) {
+	list := make(ipList, 0, len(strList))
+	for _, str := range strList {
+		if _, ipNet, err := net.ParseCIDR(str); err == nil {
+			list = append(list, ipNet)
+			continue
+		}
+		ip := net.ParseIP(str)
+		if ip == nil {
+			return nil, errors.New("ip or cidr invalid: " + str)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		list = append(list, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return list, nil
+}
+
+type rule struct {
+	allow ipList
+	deny  ipList
+}
+
+func newRule(conf ListConfig) (*rule, error) {
+	allow, err := parseIPList(conf.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseIPList(conf.Deny)
+	if err != nil {
+		return nil, err
+	}
+	return &rule{allow: allow, deny: deny}, nil
+}
+
+func (r *rule) enable(ip net.IP) bool {
+	if r.deny.contains(ip) {
+		return false
+	}
+	return len(r.allow) == 0 || r.allow.contains(ip)
+}
+
+// Limiter 解析后的访问控制配置, 通过Build生成
+type Limiter struct {
+	lists   map[string]*rule
+	trusted ipList
+}
+
+// Build 校验配置并生成Limiter, 默认名单的Allow会补充本机地址
+func Build(conf Config) (*Limiter, error) {
+	limiter := &Limiter{
+		lists: make(map[string]*rule, len(conf.Lists)+1),
+	}
+
+	defaultConf := conf.Lists[DefaultList]
+	defaultConf.Allow = append(append([]string{}, loopbackList...), defaultConf.Allow...)
+	for name, listConf := range conf.Lists {
+		if name == DefaultList {
+			continue
+		}
+		r, err := newRule(listConf)
+		if err != nil {
+			return nil, errors.New(err.Error() + ", list = " + name)
+		}
+		limiter.lists[name] = r
+	}
+	r, err := newRule(defaultConf)
+	if err != nil {
+		return nil, errors.New(err.Error() + ", list = " + DefaultList)
+	}
+	limiter.lists[DefaultList] = r
+
+	if limiter.trusted, err = parseIPList(conf.TrustedProxies); err != nil {
+		return nil, errors.New(err.Error() + ", trusted proxies")
+	}
+	return limiter, nil
+}
+
+var rwlock sync.RWMutex
+var limiter *Limiter
 
 func init() {
-	whilteList["127.0.0.1"] = true
+	limiter, _ = Build(Config{})
+}
+
+// Store 替换当前访问控制配置
+func Store(l *Limiter) {
+	if l == nil {
+		return
+	}
+	rwlock.Lock()
+	limiter = l
+	rwlock.Unlock()
+}
+
+func getLimiter() *Limiter {
+	rwlock.RLock()
+	defer rwlock.RUnlock()
+	return limiter
+}
+
+// HasList 判断名单是否存在
+func (l *Limiter) HasList(name string) bool {
+	_, ok := l.lists[name]
+	return ok
+}
+
+// IsTrustedProxy 判断IP是否为可信代理
+func IsTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	return getLimiter().trusted.contains(parsed)
 }
 
 func get_ip(addr string) (string, error) {
@@ -22,13 +165,27 @@ func get_ip(addr string) (string, error) {
 	return "", errors.New("ip parse invalid")
 }
 
-func IPEnable(ip string) (bool, error) {
-	if enable, ok := whilteList[ip]; ok && enable {
+// ListEnable 判断IP是否通过指定名单校验
+func ListEnable(name string, ip string) (bool, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false, errors.New("ip parse invalid")
+	}
+	r, ok := getLimiter().lists[name]
+	if !ok {
+		return false, errors.New("ip list not found: " + name)
+	}
+	if r.enable(parsed) {
 		return true, nil
 	}
 	return false, errors.New("ip check failed")
 }
 
+// IPEnable 判断IP是否在默认名单(IP白名单)中
+func IPEnable(ip string) (bool, error) {
+	return ListEnable(DefaultList, ip)
+}
+
 func AddrEnabel(addr string) (bool, error) {
 	if ip, err := get_ip(addr); err != nil {
 		return false, err
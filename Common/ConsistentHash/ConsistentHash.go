@@ -218,6 +218,27 @@ func (c *Consistent) GetN(name string, n int) ([]string, error) {
 	return res, nil
 }
 
+// Walk calls fn for each element of the circle in order, starting from the
+// element closest to where name hashes to, until fn returns false. Replicas
+// of the same element are visited once per replica.
+func (c *Consistent) Walk(name string, fn func(elt string) bool) error {
+	c.RLock()
+	defer c.RUnlock()
+
+	if len(c.circle) == 0 {
+		return ErrEmptyCircle
+	}
+
+	start := c.search(c.hashKey(name))
+	for n := 0; n < len(c.sortedHashes); n++ {
+		i := (start + n) % len(c.sortedHashes)
+		if !fn(c.circle[c.sortedHashes[i]]) {
+			break
+		}
+	}
+	return nil
+}
+
 func (c *Consistent) hashKey(key string) uint32 {
 	if c.UseFnv {
 		return c.hashKeyFnv(key)
@@ -0,0 +1,222 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.1
+// 	protoc        v3.14.0
+// source: Batch.proto
+
+package GateWayProtos
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// BatchRequest 批量请求, 网关将同一接口的多个请求合并后发往下级服务的批量接口
+//
+//	UnifiedRequest{Cmd: 批量接口CMD, Request: BatchRequest}
+type BatchRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Requests []*UnifiedRequest `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty"` // 合并的请求, Cmd为原接口CMD
+}
+
+func (x *BatchRequest) Reset() {
+	*x = BatchRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_Batch_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchRequest) ProtoMessage() {}
+
+func (x *BatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_Batch_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchRequest.ProtoReflect.Descriptor instead.
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return file_Batch_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *BatchRequest) GetRequests() []*UnifiedRequest {
+	if x != nil {
+		return x.Requests
+	}
+	return nil
+}
+
+// BatchResponse 批量返回, 下级服务的批量接口返回
+//
+//	UnifiedResponse{Result: OK, Response: BatchResponse}
+//	responses与requests一一对应, 单个请求失败时在对应的UnifiedResponse.Result中返回错误码
+type BatchResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Responses []*UnifiedResponse `protobuf:"bytes,1,rep,name=responses,proto3" json:"responses,omitempty"`
+}
+
+func (x *BatchResponse) Reset() {
+	*x = BatchResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_Batch_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResponse) ProtoMessage() {}
+
+func (x *BatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_Batch_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResponse.ProtoReflect.Descriptor instead.
+func (*BatchResponse) Descriptor() ([]byte, []int) {
+	return file_Batch_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *BatchResponse) GetResponses() []*UnifiedResponse {
+	if x != nil {
+		return x.Responses
+	}
+	return nil
+}
+
+var File_Batch_proto protoreflect.FileDescriptor
+
+var file_Batch_proto_rawDesc = []byte{
+	0x0a, 0x0b, 0x42, 0x61, 0x74, 0x63, 0x68, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0a, 0x47,
+	0x72, 0x70, 0x63, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x1a, 0x0c, 0x43, 0x6f, 0x6d, 0x6d, 0x6f,
+	0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x46, 0x0a, 0x0c, 0x42, 0x61, 0x74, 0x63, 0x68,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x36, 0x0a, 0x08, 0x72, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x47, 0x72, 0x70, 0x63,
+	0x50, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x55, 0x6e, 0x69, 0x66, 0x69, 0x65, 0x64, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x52, 0x08, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x73, 0x22,
+	0x4a, 0x0a, 0x0d, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x39, 0x0a, 0x09, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x73, 0x18, 0x01, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x47, 0x72, 0x70, 0x63, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x73,
+	0x2e, 0x55, 0x6e, 0x69, 0x66, 0x69, 0x65, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x52, 0x09, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x73, 0x42, 0x12, 0x5a, 0x10, 0x2e,
+	0x2f, 0x3b, 0x47, 0x61, 0x74, 0x65, 0x57, 0x61, 0x79, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_Batch_proto_rawDescOnce sync.Once
+	file_Batch_proto_rawDescData = file_Batch_proto_rawDesc
+)
+
+func file_Batch_proto_rawDescGZIP() []byte {
+	file_Batch_proto_rawDescOnce.Do(func() {
+		file_Batch_proto_rawDescData = protoimpl.X.CompressGZIP(file_Batch_proto_rawDescData)
+	})
+	return file_Batch_proto_rawDescData
+}
+
+var file_Batch_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_Batch_proto_goTypes = []interface{}{
+	(*BatchRequest)(nil),    // 0: GrpcProtos.BatchRequest
+	(*BatchResponse)(nil),   // 1: GrpcProtos.BatchResponse
+	(*UnifiedRequest)(nil),  // 2: GrpcProtos.UnifiedRequest
+	(*UnifiedResponse)(nil), // 3: GrpcProtos.UnifiedResponse
+}
+var file_Batch_proto_depIdxs = []int32{
+	2, // 0: GrpcProtos.BatchRequest.requests:type_name -> GrpcProtos.UnifiedRequest
+	3, // 1: GrpcProtos.BatchResponse.responses:type_name -> GrpcProtos.UnifiedResponse
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_Batch_proto_init() }
+func file_Batch_proto_init() {
+	if File_Batch_proto != nil {
+		return
+	}
+	file_Common_proto_init()
+	if !protoimpl.UnsafeEnabled {
+		file_Batch_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_Batch_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_Batch_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_Batch_proto_goTypes,
+		DependencyIndexes: file_Batch_proto_depIdxs,
+		MessageInfos:      file_Batch_proto_msgTypes,
+	}.Build()
+	File_Batch_proto = out.File
+	file_Batch_proto_rawDesc = nil
+	file_Batch_proto_goTypes = nil
+	file_Batch_proto_depIdxs = nil
+}
@@ -167,6 +167,8 @@ const (
 	ResultType_ERR_Service_Timeout ResultType = 10 // 服务计算超时
 	ResultType_ERR_Grpc_Closed     ResultType = 11 // Grpc已经关闭
 	ResultType_ERR_Rate_Limit      ResultType = 12 // 接口速率限制
+	ResultType_ERR_Unauthorized    ResultType = 13 // 身份认证失败(Token缺失或无效)
+	ResultType_ERR_Forbidden       ResultType = 14 // 没有访问权限(IP名单/Token权限范围校验不通过)
 )
 
 // Enum value maps for ResultType.
@@ -185,6 +187,8 @@ var (
 		10: "ERR_Service_Timeout",
 		11: "ERR_Grpc_Closed",
 		12: "ERR_Rate_Limit",
+		13: "ERR_Unauthorized",
+		14: "ERR_Forbidden",
 	}
 	ResultType_value = map[string]int32{
 		"OK":                  0,
@@ -200,6 +204,8 @@ var (
 		"ERR_Service_Timeout": 10,
 		"ERR_Grpc_Closed":     11,
 		"ERR_Rate_Limit":      12,
+		"ERR_Unauthorized":    13,
+		"ERR_Forbidden":       14,
 	}
 )
 
@@ -1332,7 +1338,7 @@ var file_Common_proto_rawDesc = []byte{
 	0x49, 0x46, 0x59, 0x10, 0x46, 0x12, 0x0d, 0x0a, 0x09, 0x43, 0x4d, 0x44, 0x5f, 0x48, 0x45, 0x4c,
 	0x4c, 0x4f, 0x10, 0x64, 0x12, 0x20, 0x0a, 0x1a, 0x43, 0x4d, 0x44, 0x5f, 0x47, 0x45, 0x54, 0x5f,
 	0x44, 0x4f, 0x57, 0x4e, 0x4c, 0x4f, 0x41, 0x44, 0x5f, 0x52, 0x45, 0x43, 0x4f, 0x4d, 0x4d, 0x45,
-	0x4e, 0x44, 0x10, 0xe1, 0xb5, 0x37, 0x2a, 0x9c, 0x02, 0x0a, 0x0a, 0x52, 0x65, 0x73, 0x75, 0x6c,
+	0x4e, 0x44, 0x10, 0xe1, 0xb5, 0x37, 0x2a, 0xc5, 0x02, 0x0a, 0x0a, 0x52, 0x65, 0x73, 0x75, 0x6c,
 	0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x06, 0x0a, 0x02, 0x4f, 0x4b, 0x10, 0x00, 0x12, 0x0f, 0x0a,
 	0x0b, 0x45, 0x52, 0x52, 0x5f, 0x55, 0x6e, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x10, 0x01, 0x12, 0x13,
 	0x0a, 0x0f, 0x45, 0x52, 0x52, 0x5f, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x5f, 0x43, 0x4d,
@@ -1350,20 +1356,23 @@ var file_Common_proto_rawDesc = []byte{
 	0x63, 0x65, 0x5f, 0x54, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x10, 0x0a, 0x12, 0x13, 0x0a, 0x0f,
 	0x45, 0x52, 0x52, 0x5f, 0x47, 0x72, 0x70, 0x63, 0x5f, 0x43, 0x6c, 0x6f, 0x73, 0x65, 0x64, 0x10,
 	0x0b, 0x12, 0x12, 0x0a, 0x0e, 0x45, 0x52, 0x52, 0x5f, 0x52, 0x61, 0x74, 0x65, 0x5f, 0x4c, 0x69,
-	0x6d, 0x69, 0x74, 0x10, 0x0c, 0x2a, 0x43, 0x0a, 0x0d, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
-	0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x6e, 0x6b, 0x6e, 0x6f, 0x77,
-	0x6e, 0x10, 0x00, 0x12, 0x0c, 0x0a, 0x08, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x10,
-	0x01, 0x12, 0x0a, 0x0a, 0x06, 0x4f, 0x6e, 0x6c, 0x69, 0x6e, 0x65, 0x10, 0x02, 0x12, 0x0b, 0x0a,
-	0x07, 0x4f, 0x66, 0x66, 0x6c, 0x69, 0x6e, 0x65, 0x10, 0x03, 0x2a, 0x17, 0x0a, 0x0b, 0x43, 0x6f,
-	0x6e, 0x6e, 0x65, 0x63, 0x74, 0x4d, 0x6f, 0x64, 0x65, 0x12, 0x08, 0x0a, 0x04, 0x47, 0x52, 0x50,
-	0x43, 0x10, 0x00, 0x32, 0x5a, 0x0a, 0x0e, 0x55, 0x6e, 0x69, 0x66, 0x69, 0x65, 0x64, 0x53, 0x65,
-	0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x48, 0x0a, 0x0b, 0x43, 0x61, 0x6c, 0x6c, 0x53, 0x65, 0x72,
-	0x76, 0x69, 0x63, 0x65, 0x12, 0x1a, 0x2e, 0x47, 0x72, 0x70, 0x63, 0x50, 0x72, 0x6f, 0x74, 0x6f,
-	0x73, 0x2e, 0x55, 0x6e, 0x69, 0x66, 0x69, 0x65, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
-	0x1a, 0x1b, 0x2e, 0x47, 0x72, 0x70, 0x63, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x55, 0x6e,
-	0x69, 0x66, 0x69, 0x65, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42,
-	0x12, 0x5a, 0x10, 0x2e, 0x2f, 0x3b, 0x47, 0x61, 0x74, 0x65, 0x57, 0x61, 0x79, 0x50, 0x72, 0x6f,
-	0x74, 0x6f, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x6d, 0x69, 0x74, 0x10, 0x0c, 0x12, 0x14, 0x0a, 0x10, 0x45, 0x52, 0x52, 0x5f, 0x55, 0x6e, 0x61,
+	0x75, 0x74, 0x68, 0x6f, 0x72, 0x69, 0x7a, 0x65, 0x64, 0x10, 0x0d, 0x12, 0x11, 0x0a, 0x0d, 0x45,
+	0x52, 0x52, 0x5f, 0x46, 0x6f, 0x72, 0x62, 0x69, 0x64, 0x64, 0x65, 0x6e, 0x10, 0x0e, 0x2a, 0x43,
+	0x0a, 0x0d, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12,
+	0x0b, 0x0a, 0x07, 0x55, 0x6e, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x10, 0x00, 0x12, 0x0c, 0x0a, 0x08,
+	0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x10, 0x01, 0x12, 0x0a, 0x0a, 0x06, 0x4f, 0x6e,
+	0x6c, 0x69, 0x6e, 0x65, 0x10, 0x02, 0x12, 0x0b, 0x0a, 0x07, 0x4f, 0x66, 0x66, 0x6c, 0x69, 0x6e,
+	0x65, 0x10, 0x03, 0x2a, 0x17, 0x0a, 0x0b, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x4d, 0x6f,
+	0x64, 0x65, 0x12, 0x08, 0x0a, 0x04, 0x47, 0x52, 0x50, 0x43, 0x10, 0x00, 0x32, 0x5a, 0x0a, 0x0e,
+	0x55, 0x6e, 0x69, 0x66, 0x69, 0x65, 0x64, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x48,
+	0x0a, 0x0b, 0x43, 0x61, 0x6c, 0x6c, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x1a, 0x2e,
+	0x47, 0x72, 0x70, 0x63, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x55, 0x6e, 0x69, 0x66, 0x69,
+	0x65, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1b, 0x2e, 0x47, 0x72, 0x70, 0x63,
+	0x50, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x55, 0x6e, 0x69, 0x66, 0x69, 0x65, 0x64, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x12, 0x5a, 0x10, 0x2e, 0x2f, 0x3b, 0x47,
+	0x61, 0x74, 0x65, 0x57, 0x61, 0x79, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x62, 0x06, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -0,0 +1,175 @@
+package GroundRules
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"bufio"
+	"errors"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 兜底物料池, 文件格式每行为: ll_id,res_type
+type ItemPool struct {
+	fileName   string                    // 物料文件
+	itemList   []*GateWayProtos.ItemData // 物料列表
+	resTypeIdx map[int64][]int           // res_type->物料下标
+}
+
+const MaxSampleCount = 1000 // 单次抽取物料数量上限
+
+var rwlock sync.RWMutex
+var poolMap = make(map[int32]*ItemPool, 10) // cmd->兜底物料池
+
+// LoadItemPool 从文件加载兜底物料池
+func LoadItemPool(fileName string) (*ItemPool, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pool := &ItemPool{
+		fileName:   fileName,
+		resTypeIdx: make(map[int64][]int),
+	}
+
+	lineNum := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) < 2 {
+			return nil, errors.New("ground rules file format error, line = " + strconv.Itoa(lineNum))
+		}
+		llId, err := strconv.ParseInt(strings.TrimSpace(fields[0]), 10, 64)
+		if err != nil {
+			return nil, errors.New("ground rules ll_id parse error, line = " + strconv.Itoa(lineNum))
+		}
+		resType, err := strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64)
+		if err != nil {
+			return nil, errors.New("ground rules res_type parse error, line = " + strconv.Itoa(lineNum))
+		}
+
+		pool.resTypeIdx[resType] = append(pool.resTypeIdx[resType], len(pool.itemList))
+		pool.itemList = append(pool.itemList, &GateWayProtos.ItemData{
+			LlId:    llId,
+			ResType: resType,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(pool.itemList) == 0 {
+		return nil, errors.New("ground rules file is empty, file = " + fileName)
+	}
+	return pool, nil
+}
+
+// StoreAll 整体替换全部兜底物料池
+func StoreAll(newPoolMap map[int32]*ItemPool) {
+	rwlock.Lock()
+	poolMap = newPoolMap
+	rwlock.Unlock()
+}
+
+// Get 获取cmd对应的兜底物料池
+func Get(cmd int32) (*ItemPool, bool) {
+	rwlock.RLock()
+	defer rwlock.RUnlock()
+	pool, ok := poolMap[cmd]
+	return pool, ok
+}
+
+// Size 物料池大小
+func (pool *ItemPool) Size() int {
+	return len(pool.itemList)
+}
+
+// Sample 随机抽取count个物料
+// 优先抽取与resType相同类目的物料, 数量不足时再从全部物料中补齐, 并过滤掉excludeLlId
+// count来自请求, 不超过物料池大小及MaxSampleCount
+func (pool *ItemPool) Sample(
+	resType int64,
+	excludeLlId int64,
+	count int,
+) []*GateWayProtos.ItemData {
+	if count <= 0 {
+		return nil
+	}
+	if count > pool.Size() {
+		count = pool.Size()
+	}
+	if count > MaxSampleCount {
+		count = MaxSampleCount
+	}
+
+	itemList := make([]*GateWayProtos.ItemData, 0, count)
+	picked := make(map[int]bool, count)
+
+	// 多抽取已选数量+1个下标, 保证去重和过滤后仍能补齐
+	pick := func(n int, getIdx func(int) int) {
+		for _, i := range sampleIdx(n, count-len(itemList)+len(picked)+1) {
+			if len(itemList) >= count {
+				return
+			}
+			idx := getIdx(i)
+			if picked[idx] || pool.itemList[idx].LlId == excludeLlId {
+				continue
+			}
+			picked[idx] = true
+
+			// 复制一份, 防止调用方修改物料池
+			item := pool.itemList[idx]
+			itemList = append(itemList, &GateWayProtos.ItemData{
+				LlId:    item.LlId,
+				ResType: item.ResType,
+				Source:  item.Source,
+			})
+		}
+	}
+
+	// 1. 同类目物料
+	if idxList, ok := pool.resTypeIdx[resType]; ok {
+		pick(len(idxList), func(i int) int { return idxList[i] })
+	}
+
+	// 2. 全部物料补齐
+	if len(itemList) < count {
+		pick(len(pool.itemList), func(i int) int { return i })
+	}
+	return itemList
+}
+
+// sampleIdx 从[0, n)中不重复地随机抽取k个下标(Floyd算法), 返回顺序随机
+func sampleIdx(n int, k int) []int {
+	if k > n {
+		k = n
+	}
+	if k <= 0 {
+		return nil
+	}
+
+	result := make([]int, 0, k)
+	seen := make(map[int]bool, k)
+	for j := n - k; j < n; j++ {
+		t := rand.Intn(j + 1)
+		if seen[t] {
+			t = j
+		}
+		seen[t] = true
+		result = append(result, t)
+	}
+	rand.Shuffle(len(result), func(i, j int) {
+		result[i], result[j] = result[j], result[i]
+	})
+	return result
+}
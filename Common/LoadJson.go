@@ -14,18 +14,21 @@ func NewJsonStruct() *JsonStruct {
 }
 
 func (jst *JsonStruct) Load(filename string, v interface{}) bool {
+	if err := jst.LoadFile(filename, v); err != nil {
+		logger.Log().WithField("err", err).Error("json.LoadFile Error")
+		return false
+	}
+	return true
+}
+
+// LoadFile 读取json文件并解码, 失败返回错误信息
+func (jst *JsonStruct) LoadFile(filename string, v interface{}) error {
 	//ReadFile函数会读取文件的全部内容，并将结果以[]byte类型返回
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
-		logger.Log().WithField("err", err).Error("json.ReadFile Error")
-		return false
+		return err
 	}
 
 	//读取的数据为json格式，需要进行解码
-	err = json.Unmarshal(data, v)
-	if err != nil {
-		logger.Log().WithField("err", err).Error("json.Unmarshal Error")
-		return false
-	}
-	return true
+	return json.Unmarshal(data, v)
 }
@@ -0,0 +1,246 @@
+package Metrics
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "algo_gateway"
+
+var (
+	// HTTP 请求数, 按路由/CMD/HTTP状态码统计
+	HttpRequestTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Total number of HTTP requests by route, cmd and http status.",
+		},
+		[]string{"route", "cmd", "status"},
+	)
+
+	// HTTP 请求耗时
+	HttpRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by route and cmd.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		},
+		[]string{"route", "cmd"},
+	)
+
+	// HTTP 正在处理的请求数
+	HttpInflight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "inflight_requests",
+			Help:      "Number of HTTP requests currently being served by route.",
+		},
+		[]string{"route"},
+	)
+
+	// HTTP 限流拒绝数, 按路由/限流范围统计
+	HttpRateLimited = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "rate_limited_total",
+			Help:      "Total number of HTTP requests rejected by rate limit by route and scope.",
+		},
+		[]string{"route", "scope"},
+	)
+
+	// HTTP 返回结果缓存, 按路由/缓存状态统计
+	HttpCacheTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "cache_total",
+			Help:      "Total number of HTTP response cache lookups by route and status (hit/miss/stale).",
+		},
+		[]string{"route", "status"},
+	)
+
+	// gRPC/gRPC-Web 透传请求数, 按协议/CMD/ResultType统计
+	GrpcRequestTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "grpc",
+			Name:      "requests_total",
+			Help:      "Total number of gRPC passthrough requests by protocol, cmd and result type.",
+		},
+		[]string{"protocol", "cmd", "result"},
+	)
+
+	// gRPC/gRPC-Web 透传请求耗时
+	GrpcRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "grpc",
+			Name:      "request_duration_seconds",
+			Help:      "gRPC passthrough request latency by protocol and cmd.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		},
+		[]string{"protocol", "cmd"},
+	)
+
+	// 下级服务调用数, 按服务类型/CMD/ResultType统计
+	UpstreamRequestTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "upstream",
+			Name:      "requests_total",
+			Help:      "Total number of upstream calls by service type, cmd and result type.",
+		},
+		[]string{"service_type", "cmd", "result"},
+	)
+
+	// 下级服务调用耗时
+	UpstreamRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "upstream",
+			Name:      "request_duration_seconds",
+			Help:      "Upstream call latency by service type and cmd.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		},
+		[]string{"service_type", "cmd"},
+	)
+
+	// 下级服务重试及对冲请求数
+	UpstreamRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "upstream",
+			Name:      "retries_total",
+			Help:      "Total number of upstream retries and hedged requests by cmd and kind.",
+		},
+		[]string{"cmd", "kind"},
+	)
+
+	// 下级服务批量请求大小
+	UpstreamBatchSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "upstream",
+			Name:      "batch_size",
+			Help:      "Number of requests merged into one upstream batch call by cmd.",
+			Buckets:   []float64{2, 4, 8, 16, 32, 64, 128},
+		},
+		[]string{"cmd"},
+	)
+
+	// 注册中心定时任务失败数: ping/check
+	RegCenterTaskFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "register_center",
+			Name:      "task_failures_total",
+			Help:      "Total number of failed register center tasks (ping/check).",
+		},
+		[]string{"task"},
+	)
+
+	// 下级服务已解析地址数
+	RegCenterResolvedAddrs = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "register_center",
+			Name:      "resolved_addrs",
+			Help:      "Number of resolved upstream addresses by service type.",
+		},
+		[]string{"service_type"},
+	)
+
+	// 结点熔断次数
+	RegCenterBreakerOpen = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "register_center",
+			Name:      "circuit_breaker_open_total",
+			Help:      "Total number of circuit breaker openings by upstream addr.",
+		},
+		[]string{"addr"},
+	)
+
+	// 负载均衡选择结点失败数
+	RegCenterPickerErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "register_center",
+			Name:      "picker_errors_total",
+			Help:      "Total number of picker errors by pick type and error.",
+		},
+		[]string{"pick_type", "err"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		HttpRequestTotal,
+		HttpRequestDuration,
+		HttpInflight,
+		HttpRateLimited,
+		HttpCacheTotal,
+		GrpcRequestTotal,
+		GrpcRequestDuration,
+		UpstreamRequestTotal,
+		UpstreamRequestDuration,
+		UpstreamRetries,
+		UpstreamBatchSize,
+		RegCenterTaskFailures,
+		RegCenterResolvedAddrs,
+		RegCenterBreakerOpen,
+		RegCenterPickerErrors,
+	)
+}
+
+// Handler 返回 /metrics 处理函数
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// CmdLabel CMD标签, 优先使用枚举名称
+func CmdLabel(cmd int32) string {
+	if name, ok := GateWayProtos.CmdType_name[cmd]; ok {
+		return name
+	}
+	return strconv.Itoa(int(cmd))
+}
+
+// ServiceTypeLabel 服务类型标签, 优先使用枚举名称
+func ServiceTypeLabel(serviceType int32) string {
+	if name, ok := GateWayProtos.ServiceType_name[serviceType]; ok {
+		return name
+	}
+	return strconv.Itoa(int(serviceType))
+}
+
+// ResultLabel ResultType标签, 优先使用枚举名称
+func ResultLabel(result int32) string {
+	if name, ok := GateWayProtos.ResultType_name[result]; ok {
+		return name
+	}
+	return strconv.Itoa(int(result))
+}
+
+// ObserveUpstream 统计下级服务调用
+func ObserveUpstream(
+	serviceType int32,
+	cmd int32,
+	result int32,
+	dur time.Duration,
+) {
+	serviceLabel := ServiceTypeLabel(serviceType)
+	cmdLabel := CmdLabel(cmd)
+	UpstreamRequestTotal.WithLabelValues(serviceLabel, cmdLabel, ResultLabel(result)).Inc()
+	UpstreamRequestDuration.WithLabelValues(serviceLabel, cmdLabel).Observe(dur.Seconds())
+}
@@ -0,0 +1,227 @@
+package RateLimiter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LimitConfig 令牌桶配置
+type LimitConfig struct {
+	Rate  float64 // 每秒产生令牌数, <=0 不限制
+	Burst int64   // 桶容量, 不填默认为Rate向上取整
+}
+
+func (conf LimitConfig) check() error {
+	if math.IsNaN(conf.Rate) || math.IsInf(conf.Rate, 0) {
+		return errors.New("rate limit rate invalid")
+	}
+	if conf.Burst < 0 {
+		return errors.New("rate limit burst invalid")
+	}
+	return nil
+}
+
+// Bucket 令牌桶, nil 为不限制
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket 创建令牌桶, Rate<=0 返回nil
+func NewBucket(conf LimitConfig) *Bucket {
+	if conf.Rate <= 0 {
+		return nil
+	}
+	burst := float64(conf.Burst)
+	if burst <= 0 {
+		burst = math.Ceil(conf.Rate)
+	}
+	return &Bucket{
+		rate:   conf.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Allow 取一个令牌, 令牌不足返回false
+func (b *Bucket) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// need b.mu.Lock() before calling
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// full 令牌桶已满, 与新建的令牌桶等价
+func (b *Bucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+const keyed_clean_interval = time.Minute // 清理空闲令牌桶间隔
+
+// KeyedLimiter 按Key限流, 每个Key一个令牌桶
+type KeyedLimiter struct {
+	conf      LimitConfig
+	mu        sync.Mutex
+	bucketMap map[string]*Bucket
+	lastClean time.Time
+}
+
+// NewKeyedLimiter 创建按Key限流器, Rate<=0 返回nil
+func NewKeyedLimiter(conf LimitConfig) *KeyedLimiter {
+	if conf.Rate <= 0 {
+		return nil
+	}
+	return &KeyedLimiter{
+		conf:      conf,
+		bucketMap: make(map[string]*Bucket),
+		lastClean: time.Now(),
+	}
+}
+
+// Allow 取key对应令牌桶的一个令牌
+func (kl *KeyedLimiter) Allow(key string) bool {
+	if kl == nil {
+		return true
+	}
+
+	now := time.Now()
+	kl.mu.Lock()
+	// 已满的令牌桶与新建的等价, 可以直接删除, 防止Key过多占用内存
+	if now.Sub(kl.lastClean) > keyed_clean_interval {
+		for k, b := range kl.bucketMap {
+			if b.full(now) {
+				delete(kl.bucketMap, k)
+			}
+		}
+		kl.lastClean = now
+	}
+	b, ok := kl.bucketMap[key]
+	if !ok {
+		b = NewBucket(kl.conf)
+		kl.bucketMap[key] = b
+	}
+	kl.mu.Unlock()
+
+	return b.Allow()
+}
+
+// CMDLimitConfig 下级服务接口限流配置
+type CMDLimitConfig struct {
+	CMD string // CmdType枚举名称或数值
+	LimitConfig
+}
+
+// Config 全局及下级服务接口限流配置
+type Config struct {
+	Global LimitConfig      // 全部HTTP请求
+	CMD    []CMDLimitConfig // 按下级服务接口
+}
+
+// Limiter 解析后的限流配置, 通过Build生成
+type Limiter struct {
+	global     *Bucket
+	globalConf LimitConfig
+	cmdMap     map[int32]*Bucket
+	cmdConfMap map[int32]LimitConfig
+}
+
+var limiter atomic.Value // *Limiter
+
+func init() {
+	limiter.Store(&Limiter{})
+}
+
+// Build 校验配置并生成Limiter, 配置未改变的令牌桶沿用当前状态
+func Build(conf Config) (*Limiter, error) {
+	old := limiter.Load().(*Limiter)
+
+	if err := conf.Global.check(); err != nil {
+		return nil, err
+	}
+	l := &Limiter{
+		globalConf: conf.Global,
+		cmdMap:     make(map[int32]*Bucket, len(conf.CMD)),
+		cmdConfMap: make(map[int32]LimitConfig, len(conf.CMD)),
+	}
+	if conf.Global == old.globalConf {
+		l.global = old.global
+	} else {
+		l.global = NewBucket(conf.Global)
+	}
+
+	for _, cmdConf := range conf.CMD {
+		cmd, err := parseCMD(cmdConf.CMD)
+		if err != nil {
+			return nil, err
+		}
+		if err := cmdConf.check(); err != nil {
+			return nil, errors.New(err.Error() + ", cmd = " + cmdConf.CMD)
+		}
+		if _, ok := l.cmdConfMap[cmd]; ok {
+			return nil, errors.New("rate limit cmd repeated, cmd = " + cmdConf.CMD)
+		}
+		l.cmdConfMap[cmd] = cmdConf.LimitConfig
+		if oldConf, ok := old.cmdConfMap[cmd]; ok && oldConf == cmdConf.LimitConfig {
+			l.cmdMap[cmd] = old.cmdMap[cmd]
+		} else {
+			l.cmdMap[cmd] = NewBucket(cmdConf.LimitConfig)
+		}
+	}
+	return l, nil
+}
+
+func parseCMD(str string) (int32, error) {
+	if val, ok := GateWayProtos.CmdType_value[str]; ok {
+		return val, nil
+	}
+	val, err := strconv.ParseInt(str, 10, 32)
+	if err != nil {
+		return 0, errors.New("rate limit cmd invalid, cmd = " + str)
+	}
+	return int32(val), nil
+}
+
+// Store 替换当前限流配置
+func Store(l *Limiter) {
+	if l != nil {
+		limiter.Store(l)
+	}
+}
+
+// AllowGlobal 全局限流
+func AllowGlobal() bool {
+	return limiter.Load().(*Limiter).global.Allow()
+}
+
+// AllowCMD 下级服务接口限流
+func AllowCMD(cmd int32) bool {
+	return limiter.Load().(*Limiter).cmdMap[cmd].Allow()
+}
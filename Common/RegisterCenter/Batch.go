@@ -0,0 +1,322 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/Metrics"
+	"GateWayCommon/Tracing"
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	protoV2 "google.golang.org/protobuf/proto"
+)
+
+// 批量协议见 GateWayProtos/Batch.proto:
+//	批量请求: UnifiedRequest{Cmd: BatchCMD, Request: BatchRequest}
+//	批量返回: UnifiedResponse{Result: OK, Response: BatchResponse}
+//	responses 与 requests 一一对应, 单个请求失败时在对应的 UnifiedResponse.Result 中返回错误码
+const (
+	batch_default_timeout  = 3 * time.Second // 请求未设置超时的情况下, 批量请求的超时时间
+	batch_default_max_size = 16
+)
+
+// BatchConfig 下级服务接口批量请求配置
+type BatchConfig struct {
+	CMD      string // 业务接口, CmdType枚举名称或数值
+	BatchCMD string // 批量接口, 下级服务按批量协议处理
+	MaxSize  int    // 每批最大请求数, 不填默认16
+	MaxDelay int64  // 最长等待时间, 单位ms
+}
+
+type batchPolicy struct {
+	batchCmd int32
+	maxSize  int
+	maxDelay time.Duration
+}
+
+// BatchPolicies 解析后的批量请求配置, 通过BuildBatchPolicies生成
+type BatchPolicies struct {
+	cmdMap map[int32]*batchPolicy
+}
+
+var batchPolicies atomic.Value // *BatchPolicies
+
+func init() {
+	batchPolicies.Store(&BatchPolicies{})
+}
+
+// BuildBatchPolicies 校验批量请求配置
+func BuildBatchPolicies(confList []BatchConfig) (*BatchPolicies, error) {
+	policies := &BatchPolicies{
+		cmdMap: make(map[int32]*batchPolicy, len(confList)),
+	}
+	batchCmdMap := make(map[int32]bool, len(confList))
+	for _, conf := range confList {
+		cmd, err := parseEnum(conf.CMD, GateWayProtos.CmdType_value)
+		if err != nil {
+			return nil, errors.New("batch cmd invalid, cmd = " + conf.CMD)
+		}
+		batchCmd, err := parseEnum(conf.BatchCMD, GateWayProtos.CmdType_value)
+		if err != nil || batchCmd == cmd {
+			return nil, errors.New("batch batch_cmd invalid, cmd = " + conf.CMD)
+		}
+		if _, ok := policies.cmdMap[cmd]; ok {
+			return nil, errors.New("batch cmd repeated, cmd = " + conf.CMD)
+		}
+		if conf.MaxSize < 0 || conf.MaxDelay <= 0 {
+			return nil, errors.New("batch max_size or max_delay invalid, cmd = " + conf.CMD)
+		}
+
+		policy := &batchPolicy{
+			batchCmd: batchCmd,
+			maxSize:  conf.MaxSize,
+			maxDelay: time.Duration(conf.MaxDelay) * time.Millisecond,
+		}
+		if policy.maxSize == 0 {
+			policy.maxSize = batch_default_max_size
+		}
+		policies.cmdMap[cmd] = policy
+		batchCmdMap[batchCmd] = true
+	}
+
+	// 批量接口本身不能再批量
+	for cmd := range policies.cmdMap {
+		if batchCmdMap[cmd] {
+			return nil, errors.New("batch cmd is also a batch_cmd, cmd = " + GateWayProtos.CmdType(cmd).String())
+		}
+	}
+	return policies, nil
+}
+
+// StoreBatchPolicies 替换批量请求配置
+func StoreBatchPolicies(policies *BatchPolicies) {
+	if policies != nil {
+		batchPolicies.Store(policies)
+	}
+}
+
+func getBatchPolicy(cmd int32) *batchPolicy {
+	return batchPolicies.Load().(*BatchPolicies).cmdMap[cmd]
+}
+
+// batchItem 等待批量发送的请求
+type batchItem struct {
+	ctx     context.Context
+	request []byte
+	done    chan *attemptResult // 容量为1, 发送结果后不阻塞
+}
+
+type pendingBatch struct {
+	items []*batchItem
+}
+
+// batcher 收集相同接口及过滤条件的请求, 攒批后发送
+type batcher struct {
+	client *unifiedClient
+	cmd    int32
+	filter map[string]string
+
+	mu      sync.Mutex
+	pending *pendingBatch
+}
+
+// batchKey 相同接口及过滤条件的请求才能合并
+func batchKey(cmd int32, filter map[string]string) string {
+	keys := make([]string, 0, len(filter))
+	for k := range filter {
+		if k != Param_CMD {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	builder.WriteString(GateWayProtos.CmdType(cmd).String())
+	for _, k := range keys {
+		builder.WriteByte(0)
+		builder.WriteString(k)
+		builder.WriteByte('=')
+		builder.WriteString(filter[k])
+	}
+	return builder.String()
+}
+
+// callBatch 加入批量请求并等待结果
+func (client *unifiedClient) callBatch(
+	ctx context.Context,
+	cmd int32,
+	request []byte,
+	data map[string]string,
+	policy *batchPolicy,
+) *attemptResult {
+	key := batchKey(cmd, data)
+	val, ok := client.batchers.Load(key)
+	if !ok {
+		val, _ = client.batchers.LoadOrStore(key, &batcher{
+			client: client,
+			cmd:    cmd,
+			filter: data,
+		})
+	}
+	b := val.(*batcher)
+
+	item := &batchItem{
+		ctx:     ctx,
+		request: request,
+		done:    make(chan *attemptResult, 1),
+	}
+	b.add(item, policy)
+
+	select {
+	case r := <-item.done:
+		return r
+	case <-ctx.Done():
+		return &attemptResult{err: ctx.Err()}
+	}
+}
+
+func (b *batcher) add(item *batchItem, policy *batchPolicy) {
+	b.mu.Lock()
+	pb := b.pending
+	if pb == nil {
+		pb = &pendingBatch{}
+		b.pending = pb
+		time.AfterFunc(policy.maxDelay, func() { b.take(pb, policy) })
+	}
+	pb.items = append(pb.items, item)
+	full := len(pb.items) >= policy.maxSize
+	b.mu.Unlock()
+
+	if full {
+		b.take(pb, policy)
+	}
+}
+
+// take 取出待发送的请求并发送, 已被取出则忽略
+func (b *batcher) take(pb *pendingBatch, policy *batchPolicy) {
+	b.mu.Lock()
+	if b.pending != pb {
+		b.mu.Unlock()
+		return
+	}
+	b.pending = nil
+	b.mu.Unlock()
+
+	go b.flush(pb.items, policy)
+}
+
+func (b *batcher) flush(items []*batchItem, policy *batchPolicy) {
+	// 过滤已取消的请求
+	alive := items[:0]
+	for _, item := range items {
+		if item.ctx.Err() == nil {
+			alive = append(alive, item)
+		}
+	}
+	if len(alive) == 0 {
+		return
+	}
+
+	// 只有一个请求时按原接口请求
+	if len(alive) == 1 {
+		item := alive[0]
+		ctx := BuildCtxFilter(item.ctx, b.filter)
+		item.done <- b.client.callUnbatched(ctx, b.cmd, item.request)
+		return
+	}
+	Metrics.UpstreamBatchSize.WithLabelValues(Metrics.CmdLabel(b.cmd)).Observe(float64(len(alive)))
+
+	// 批量请求不受单个请求取消的影响, 超时取最晚的请求超时时间
+	var deadline time.Time
+	for _, item := range alive {
+		d, ok := item.ctx.Deadline()
+		if !ok {
+			d = time.Now().Add(batch_default_timeout)
+		}
+		if d.After(deadline) {
+			deadline = d
+		}
+	}
+	ctx, cancel := context.WithDeadline(BuildCtxFilter(context.Background(), b.filter), deadline)
+	defer cancel()
+
+	// 批量请求单独作为一个Trace, 关联合并的各个请求
+	ctx, span := Tracing.Start(ctx, "Batch "+GateWayProtos.CmdType(policy.batchCmd).String(), Tracing.SpanKind_Internal)
+	defer span.End()
+	span.SetAttribute("gateway.batch_size", len(alive))
+	for _, item := range alive {
+		span.AddLink(Tracing.SpanContextFromContext(item.ctx))
+	}
+
+	payload, err := encodeBatchRequest(b.cmd, alive)
+	if err != nil {
+		deliverBatch(alive, &attemptResult{
+			response: []byte(err.Error()),
+			result:   int32(GateWayProtos.ResultType_ERR_Encode_Request),
+		})
+		return
+	}
+
+	// 重试策略按原接口配置, 原接口未配置时使用批量接口的配置
+	retry := getRetryPolicy(b.cmd)
+	if retry == nil {
+		retry = getRetryPolicy(policy.batchCmd)
+	}
+	r := b.client.callWithPolicy(ctx, policy.batchCmd, payload, retry)
+	if r.err != nil || r.result != int32(GateWayProtos.ResultType_OK) {
+		deliverBatch(alive, r)
+		return
+	}
+
+	responses, err := decodeBatchResponse(r.response)
+	if err == nil && len(responses) != len(alive) {
+		err = errors.New("batch response count mismatch")
+	}
+	if err != nil {
+		errStr := err.Error() + ", batch_cmd = " + GateWayProtos.CmdType(policy.batchCmd).String()
+		deliverBatch(alive, &attemptResult{
+			response: []byte(errStr),
+			result:   int32(GateWayProtos.ResultType_ERR_Decode_Response),
+		})
+		return
+	}
+	for i, item := range alive {
+		item.done <- &attemptResult{
+			response: responses[i].Response,
+			result:   responses[i].Result,
+			addr:     r.addr,
+		}
+	}
+}
+
+// deliverBatch 全部请求返回相同结果
+func deliverBatch(items []*batchItem, r *attemptResult) {
+	for _, item := range items {
+		item.done <- r
+	}
+}
+
+func encodeBatchRequest(cmd int32, items []*batchItem) ([]byte, error) {
+	request := &GateWayProtos.BatchRequest{
+		Requests: make([]*GateWayProtos.UnifiedRequest, 0, len(items)),
+	}
+	for _, item := range items {
+		request.Requests = append(request.Requests, &GateWayProtos.UnifiedRequest{
+			Cmd:     cmd,
+			Request: item.request,
+		})
+	}
+	return protoV2.Marshal(request)
+}
+
+func decodeBatchResponse(payload []byte) ([]*GateWayProtos.UnifiedResponse, error) {
+	response := &GateWayProtos.BatchResponse{}
+	if err := protoV2.Unmarshal(payload, response); err != nil {
+		return nil, err
+	}
+	return response.Responses, nil
+}
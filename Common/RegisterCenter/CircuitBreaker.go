@@ -0,0 +1,327 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/Metrics"
+	"GateWayCommon/logger"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("all nodes circuit open")
+
+// BreakerConfig 熔断配置, 按真实结点(addr)熔断
+type BreakerConfig struct {
+	Enable              bool    // 是否启用熔断
+	WindowTime          int64   // 统计窗口时长, 单位ms
+	MinRequests         int64   // 窗口内最少请求数, 不足时不按错误率熔断
+	ErrorRate           float64 // 错误率阈值, 0~1
+	ConsecutiveFailures int64   // 连续失败次数阈值, 0为不启用
+	OpenTime            int64   // 熔断持续时长, 单位ms, 之后进入半开状态
+	HalfOpenRequests    int64   // 半开状态探测请求数, 全部成功则恢复
+}
+
+func defaultBreakerConfig() *BreakerConfig {
+	return &BreakerConfig{
+		Enable:              false,
+		WindowTime:          10000,
+		MinRequests:         20,
+		ErrorRate:           0.5,
+		ConsecutiveFailures: 5,
+		OpenTime:            5000,
+		HalfOpenRequests:    3,
+	}
+}
+
+var breakerConfig atomic.Value // *BreakerConfig
+var breakerMap sync.Map        // addr->*circuitBreaker
+
+func init() {
+	breakerConfig.Store(defaultBreakerConfig())
+}
+
+// SetBreakerConfig 更新熔断配置, 未配置的字段使用默认值
+func SetBreakerConfig(conf BreakerConfig) {
+	def := defaultBreakerConfig()
+	if conf.WindowTime <= 0 {
+		conf.WindowTime = def.WindowTime
+	}
+	if conf.MinRequests <= 0 {
+		conf.MinRequests = def.MinRequests
+	}
+	if conf.ErrorRate <= 0 || conf.ErrorRate > 1 {
+		conf.ErrorRate = def.ErrorRate
+	}
+	if conf.OpenTime <= 0 {
+		conf.OpenTime = def.OpenTime
+	}
+	if conf.HalfOpenRequests <= 0 {
+		conf.HalfOpenRequests = def.HalfOpenRequests
+	}
+	breakerConfig.Store(&conf)
+}
+
+func getBreakerConfig() *BreakerConfig {
+	return breakerConfig.Load().(*BreakerConfig)
+}
+
+type breakerState int
+
+const (
+	breakerState_Closed   breakerState = 0 // 正常
+	breakerState_Open     breakerState = 1 // 熔断
+	breakerState_HalfOpen breakerState = 2 // 半开, 允许少量探测请求
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerState_Closed:
+		return "closed"
+	case breakerState_Open:
+		return "open"
+	case breakerState_HalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+type circuitBreaker struct {
+	addr string
+	mu   sync.Mutex
+
+	state       breakerState
+	windowStart time.Time // 统计窗口开始时间
+	requests    int64     // 窗口内请求数
+	failures    int64     // 窗口内失败数
+	consecutive int64     // 连续失败数
+	openUntil   time.Time // 熔断结束时间
+	halfOpenAt  time.Time // 进入半开状态时间
+	probing     int64     // 半开状态已发出的探测请求数
+	probeSucc   int64     // 半开状态探测成功数
+}
+
+func getBreaker(addr string) *circuitBreaker {
+	if val, ok := breakerMap.Load(addr); ok {
+		return val.(*circuitBreaker)
+	}
+	val, _ := breakerMap.LoadOrStore(addr, &circuitBreaker{
+		addr:        addr,
+		windowStart: time.Now(),
+	})
+	return val.(*circuitBreaker)
+}
+
+// breakerAvailable 结点是否可以被选择, 不改变熔断状态计数
+func breakerAvailable(addr string) bool {
+	if !getBreakerConfig().Enable {
+		return true
+	}
+	val, ok := breakerMap.Load(addr)
+	if !ok {
+		return true
+	}
+	return val.(*circuitBreaker).available(getBreakerConfig())
+}
+
+// breakerEligible 结点当前是否可以被选择, 只用于查看, 不改变熔断状态(不进入半开, 不重置探测名额)
+func breakerEligible(addr string) bool {
+	conf := getBreakerConfig()
+	if !conf.Enable {
+		return true
+	}
+	val, ok := breakerMap.Load(addr)
+	if !ok {
+		return true
+	}
+	return val.(*circuitBreaker).eligible(conf, time.Now())
+}
+
+// breakerStateOf 结点熔断状态, 只用于查看, 不改变熔断状态; 未启用熔断返回disabled
+func breakerStateOf(addr string) string {
+	if !getBreakerConfig().Enable {
+		return "disabled"
+	}
+	val, ok := breakerMap.Load(addr)
+	if !ok {
+		return breakerState_Closed.String()
+	}
+	cb := val.(*circuitBreaker)
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state.String()
+}
+
+// breakerPicked 结点被选中, 半开状态下占用一个探测名额
+func breakerPicked(addr string) {
+	if !getBreakerConfig().Enable {
+		return
+	}
+	if val, ok := breakerMap.Load(addr); ok {
+		val.(*circuitBreaker).picked()
+	}
+}
+
+// breakerRecord 记录调用结果
+func breakerRecord(addr string, succ bool) {
+	conf := getBreakerConfig()
+	if !conf.Enable || addr == "" {
+		return
+	}
+	getBreaker(addr).record(conf, succ)
+}
+
+// breakerRemove 结点下线, 删除熔断器及监控数据, 防止结点地址变化时无限增长
+func breakerRemove(addr string) {
+	if _, ok := breakerMap.LoadAndDelete(addr); ok {
+		Metrics.RegCenterBreakerOpen.DeleteLabelValues(addr)
+	}
+}
+
+// isBreakerFailure 判断调用结果是否计为失败
+func isBreakerFailure(err error, result int32) bool {
+	if err != nil {
+		return true
+	}
+	switch GateWayProtos.ResultType(result) {
+	case GateWayProtos.ResultType_ERR_Service_Cal,
+		GateWayProtos.ResultType_ERR_Service_Timeout,
+		GateWayProtos.ResultType_ERR_Grpc_Closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (cb *circuitBreaker) available(conf *BreakerConfig) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case breakerState_Open:
+		if time.Now().Before(cb.openUntil) {
+			return false
+		}
+		// 熔断时间结束, 进入半开状态
+		cb.setState(breakerState_HalfOpen)
+		cb.halfOpenAt = time.Now()
+		cb.probing = 0
+		cb.probeSucc = 0
+		return true
+	case breakerState_HalfOpen:
+		// 探测请求长时间没有结果(如请求未到达结点), 重新开放探测名额
+		if cb.probing >= conf.HalfOpenRequests &&
+			time.Since(cb.halfOpenAt) > time.Duration(conf.OpenTime)*time.Millisecond {
+			cb.halfOpenAt = time.Now()
+			cb.probing = 0
+			cb.probeSucc = 0
+		}
+		return cb.probing < conf.HalfOpenRequests
+	default:
+		return true
+	}
+}
+
+// eligible 与available判断相同, 但不修改状态
+func (cb *circuitBreaker) eligible(conf *BreakerConfig, now time.Time) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case breakerState_Open:
+		return !now.Before(cb.openUntil)
+	case breakerState_HalfOpen:
+		if cb.probing >= conf.HalfOpenRequests &&
+			now.Sub(cb.halfOpenAt) > time.Duration(conf.OpenTime)*time.Millisecond {
+			return true
+		}
+		return cb.probing < conf.HalfOpenRequests
+	default:
+		return true
+	}
+}
+
+func (cb *circuitBreaker) picked() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == breakerState_HalfOpen {
+		cb.probing++
+	}
+}
+
+func (cb *circuitBreaker) record(conf *BreakerConfig, succ bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	switch cb.state {
+	case breakerState_HalfOpen:
+		if !succ {
+			cb.open(conf, now)
+			return
+		}
+		cb.probeSucc++
+		if cb.probeSucc >= conf.HalfOpenRequests {
+			cb.reset(now)
+			cb.setState(breakerState_Closed)
+		}
+	case breakerState_Closed:
+		// 统计窗口过期, 重新计数
+		if now.Sub(cb.windowStart) > time.Duration(conf.WindowTime)*time.Millisecond {
+			cb.reset(now)
+		}
+
+		cb.requests++
+		if succ {
+			cb.consecutive = 0
+			return
+		}
+		cb.failures++
+		cb.consecutive++
+
+		if conf.ConsecutiveFailures > 0 && cb.consecutive >= conf.ConsecutiveFailures {
+			cb.open(conf, now)
+			return
+		}
+		if cb.requests >= conf.MinRequests &&
+			float64(cb.failures)/float64(cb.requests) >= conf.ErrorRate {
+			cb.open(conf, now)
+		}
+	}
+}
+
+// need cb.mu.Lock() before calling
+func (cb *circuitBreaker) open(conf *BreakerConfig, now time.Time) {
+	logger.Log().WithFields(logger.Fields{
+		"addr":        cb.addr,
+		"state":       cb.state.String(),
+		"requests":    cb.requests,
+		"failures":    cb.failures,
+		"consecutive": cb.consecutive,
+	}).Warn("CircuitBreaker Open")
+	Metrics.RegCenterBreakerOpen.WithLabelValues(cb.addr).Inc()
+
+	cb.setState(breakerState_Open)
+	cb.openUntil = now.Add(time.Duration(conf.OpenTime) * time.Millisecond)
+	cb.reset(now)
+}
+
+// need cb.mu.Lock() before calling
+func (cb *circuitBreaker) reset(now time.Time) {
+	cb.windowStart = now
+	cb.requests = 0
+	cb.failures = 0
+	cb.consecutive = 0
+	cb.probing = 0
+	cb.probeSucc = 0
+}
+
+// need cb.mu.Lock() before calling
+func (cb *circuitBreaker) setState(state breakerState) {
+	if cb.state != state && state == breakerState_Closed {
+		logger.Log().WithField("addr", cb.addr).Info("CircuitBreaker Closed")
+	}
+	cb.state = state
+}
@@ -0,0 +1,194 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// 服务发现方式
+const (
+	DiscoveryType_Static    = "static"    // 配置文件中的静态结点列表
+	DiscoveryType_File      = "file"      // 监听结点文件, json/yaml
+	DiscoveryType_DNS       = "dns"       // 定时解析DNS A/SRV记录
+	DiscoveryType_Endpoints = "endpoints" // 监听Kubernetes Endpoints格式的文件, json/yaml
+)
+
+// Discovery 服务发现, 注册中心之外的下级服务结点来源
+//	发现的结点通过update写入, 与注册中心下发的结点一同参与负载均衡
+type Discovery interface {
+	Name() string                                                    // 名称, 用于日志
+	Start(update func(serviceInfo *GateWayProtos.ServiceInfo)) error // 开始发现, 首次发现失败返回错误
+	Stop()                                                           // 停止发现, 已发现的结点保留
+}
+
+// DiscoveryConfig 服务发现配置
+type DiscoveryConfig struct {
+	Type       string       // 发现方式: static/file/dns/endpoints
+	Nodes      []NodeConfig // static: 结点列表
+	FileName   string       // file/endpoints: 结点文件, 按扩展名解析: .json/.yaml/.yml
+	Interval   int          // file/endpoints: 文件检查间隔, 不填默认3000; dns: 解析间隔, 不填默认30000; 单位ms
+	Node       NodeConfig   // dns/endpoints: 结点模板, 需填写service_type及semver, 地址/主机名/状态由发现结果填充
+	Host       string       // dns: 域名, SRV记录如: _grpc._tcp.algo.example.com
+	RecordType string       // dns: 记录类型: A/SRV; 不填默认SRV
+	Port       int          // dns: A记录的服务端口
+	DNSServer  string       // dns: DNS服务器地址, ip:port, 不填端口默认53; 不填使用系统配置
+	PortName   string       // endpoints: 端口名称, Endpoints只有一个端口时可不填
+}
+
+// NodeConfig 结点配置, 字段与ServiceInfo一致
+type NodeConfig struct {
+	ServiceType   int32  `json:"service_type" yaml:"service_type"`     // 服务类型, 如: 9090
+	Addr          string `json:"addr" yaml:"addr"`                     // 服务地址: ip:port
+	Semver        string `json:"semver" yaml:"semver"`                 // 服务版本
+	Status        int32  `json:"status" yaml:"status"`                 // 服务状态, 不填默认Online
+	ServiceWeight int32  `json:"service_weight" yaml:"service_weight"` // 服务权重, 不填默认32
+	GroupTab      string `json:"group_tab" yaml:"group_tab"`           // 分组标签, 不填默认使用本服务分组
+	HostName      string `json:"host_name" yaml:"host_name"`           // 主机名
+	ServiceName   string `json:"service_name" yaml:"service_name"`     // 服务名称
+	Nickname      string `json:"nickname" yaml:"nickname"`             // 服务昵称
+}
+
+// serviceInfo 转换为ServiceInfo
+func (conf *NodeConfig) serviceInfo() *GateWayProtos.ServiceInfo {
+	status := conf.Status
+	if status == int32(GateWayProtos.ServiceStatus_Unknown) {
+		status = int32(GateWayProtos.ServiceStatus_Online)
+	}
+	return &GateWayProtos.ServiceInfo{
+		ServiceType:   conf.ServiceType,
+		Semver:        conf.Semver,
+		Addr:          conf.Addr,
+		HostName:      conf.HostName,
+		Status:        status,
+		ServiceWeight: conf.ServiceWeight,
+		ConnectMode:   int32(GateWayProtos.ConnectMode_GRPC),
+		GroupTab:      conf.GroupTab,
+		ServiceName:   conf.ServiceName,
+		Nickname:      conf.Nickname,
+	}
+}
+
+// checkServiceType 结点只能是注册中心之外的下级服务
+func (conf *NodeConfig) checkServiceType() error {
+	if conf.ServiceType == int32(GateWayProtos.ServiceType_SERVICE_TYPE_NONE) ||
+		conf.ServiceType == int32(GateWayProtos.ServiceType_REGISTER_CENTER) {
+		return errors.New("node service_type invalid, addr = " + conf.Addr)
+	}
+	return nil
+}
+
+// checkTemplate 校验dns/endpoints的结点模板
+func (conf *NodeConfig) checkTemplate() error {
+	if err := conf.checkServiceType(); err != nil {
+		return err
+	}
+	if conf.Semver == "" {
+		return errors.New("node semver empty, service_type = " + strconv.Itoa(int(conf.ServiceType)))
+	}
+	return nil
+}
+
+// discovered 按结点模板生成发现的结点
+func (conf NodeConfig) discovered(addr string, hostName string, online bool) *GateWayProtos.ServiceInfo {
+	conf.Addr = addr
+	conf.HostName = hostName
+	conf.Status = int32(GateWayProtos.ServiceStatus_Online)
+	if !online {
+		conf.Status = int32(GateWayProtos.ServiceStatus_Offline)
+	}
+	return conf.serviceInfo()
+}
+
+// buildNodes 校验结点配置并转换为ServiceInfo
+func buildNodes(confList []NodeConfig) ([]*GateWayProtos.ServiceInfo, error) {
+	list := make([]*GateWayProtos.ServiceInfo, 0, len(confList))
+	keys := make(map[string]bool, len(confList))
+	for i := range confList {
+		conf := &confList[i]
+		if err := conf.checkServiceType(); err != nil {
+			return nil, err
+		}
+		if conf.Addr == "" {
+			return nil, errors.New("node addr empty, service_type = " + strconv.Itoa(int(conf.ServiceType)))
+		}
+		key := nodeKey(conf.ServiceType, conf.Addr)
+		if keys[key] {
+			return nil, errors.New("node repeated, addr = " + conf.Addr)
+		}
+		keys[key] = true
+		list = append(list, conf.serviceInfo())
+	}
+	return list, nil
+}
+
+// CheckGroupTab 校验static结点及dns/endpoints结点模板的分组, 与本服务分组不同的结点不会被选择
+func (conf *DiscoveryConfig) CheckGroupTab(groupTab string) error {
+	if conf.Node.GroupTab != "" && conf.Node.GroupTab != groupTab {
+		return errors.New("discovery node group_tab mismatch: " + conf.Node.GroupTab)
+	}
+	for i := range conf.Nodes {
+		if conf.Nodes[i].GroupTab != "" && conf.Nodes[i].GroupTab != groupTab {
+			return errors.New("discovery node group_tab mismatch, addr = " + conf.Nodes[i].Addr)
+		}
+	}
+	return nil
+}
+
+// BuildDiscovery 校验配置并生成服务发现
+func BuildDiscovery(conf DiscoveryConfig) (Discovery, error) {
+	switch conf.Type {
+	case DiscoveryType_Static:
+		return newStaticDiscovery(conf)
+	case DiscoveryType_File:
+		return newFileDiscovery(conf)
+	case DiscoveryType_DNS:
+		return newDNSDiscovery(conf)
+	case DiscoveryType_Endpoints:
+		return newEndpointsDiscovery(conf)
+	default:
+		return nil, errors.New("discovery type not support: " + conf.Type)
+	}
+}
+
+// nodeSet 记录服务发现已下发的结点, 结点消失时下发下线状态
+type nodeSet struct {
+	mu     sync.Mutex
+	nodes  map[string]*GateWayProtos.ServiceInfo // serviceType/addr->结点
+	update func(serviceInfo *GateWayProtos.ServiceInfo)
+}
+
+func newNodeSet(update func(serviceInfo *GateWayProtos.ServiceInfo)) *nodeSet {
+	return &nodeSet{
+		nodes:  make(map[string]*GateWayProtos.ServiceInfo),
+		update: update,
+	}
+}
+
+// sync 下发当前全部结点, 未变化的结点不重复下发, 不在列表中的已有结点下线
+func (s *nodeSet) sync(list []*GateWayProtos.ServiceInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nodes := make(map[string]*GateWayProtos.ServiceInfo, len(list))
+	for _, serviceInfo := range list {
+		nodes[nodeKey(serviceInfo.ServiceType, serviceInfo.Addr)] = serviceInfo
+	}
+	for key, old := range s.nodes {
+		if _, ok := nodes[key]; !ok {
+			offline := proto.Clone(old).(*GateWayProtos.ServiceInfo)
+			offline.Status = int32(GateWayProtos.ServiceStatus_Offline)
+			s.update(offline)
+		}
+	}
+	for key, serviceInfo := range nodes {
+		if old, ok := s.nodes[key]; ok && proto.Equal(old, serviceInfo) {
+			continue
+		}
+		s.update(serviceInfo)
+	}
+	s.nodes = nodes
+}
@@ -0,0 +1,213 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/logger"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNS记录类型
+const (
+	dnsRecord_A   = "A"
+	dnsRecord_SRV = "SRV"
+)
+
+const (
+	default_dns_discovery_interval = 30000           // 默认解析间隔, 单位ms
+	default_dns_port               = "53"            // DNS服务器默认端口
+	dns_resolve_timeout            = 5 * time.Second // 单次解析超时
+	max_srv_weight                 = 128             // SRV权重上限, 权重即虚拟结点数量
+)
+
+// dnsDiscovery 定时解析DNS记录, 解析结果有变化时下发
+//	A: 域名解析出的全部IP, 使用配置的端口
+//	SRV: 每条记录的目标域名再解析为IP, 使用记录的端口; 忽略优先级
+//	结点模板未配置权重时使用SRV记录的权重, 最大128
+//	解析失败(含没有记录)时保留原有结点
+type dnsDiscovery struct {
+	host       string
+	recordType string
+	port       string
+	interval   time.Duration
+	resolver   *net.Resolver
+	node       NodeConfig // 结点模板
+
+	nodes    *nodeSet
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newDNSDiscovery(conf DiscoveryConfig) (*dnsDiscovery, error) {
+	if err := conf.Node.checkTemplate(); err != nil {
+		return nil, err
+	}
+	if conf.Host == "" {
+		return nil, errors.New("discovery dns host empty")
+	}
+	if conf.Interval < 0 {
+		return nil, errors.New("discovery dns interval invalid")
+	}
+	interval := conf.Interval
+	if interval == 0 {
+		interval = default_dns_discovery_interval
+	}
+
+	d := &dnsDiscovery{
+		host:       conf.Host,
+		recordType: strings.ToUpper(conf.RecordType),
+		interval:   time.Duration(interval) * time.Millisecond,
+		resolver:   net.DefaultResolver,
+		node:       conf.Node,
+		done:       make(chan struct{}),
+	}
+	switch d.recordType {
+	case "":
+		d.recordType = dnsRecord_SRV
+	case dnsRecord_SRV:
+	case dnsRecord_A:
+		if conf.Port <= 0 || conf.Port > 65535 {
+			return nil, errors.New("discovery dns port invalid: " + strconv.Itoa(conf.Port))
+		}
+		d.port = strconv.Itoa(conf.Port)
+	default:
+		return nil, errors.New("discovery dns record type not support: " + conf.RecordType)
+	}
+
+	// 指定DNS服务器时, 全部查询发往该服务器
+	if conf.DNSServer != "" {
+		server := conf.DNSServer
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, default_dns_port)
+		}
+		host, _, _ := net.SplitHostPort(server)
+		if net.ParseIP(host) == nil {
+			return nil, errors.New("discovery dns server invalid: " + conf.DNSServer)
+		}
+		d.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return d, nil
+}
+
+func (d *dnsDiscovery) Name() string {
+	return DiscoveryType_DNS + ":" + d.recordType + ":" + d.host
+}
+
+func (d *dnsDiscovery) Start(update func(serviceInfo *GateWayProtos.ServiceInfo)) error {
+	d.nodes = newNodeSet(update)
+	if err := d.reload(); err != nil {
+		return err
+	}
+	go d.watch()
+	return nil
+}
+
+func (d *dnsDiscovery) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.done)
+	})
+}
+
+// watch 定时重新解析
+func (d *dnsDiscovery) watch() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+
+		if err := d.reload(); err != nil {
+			logger.Log().WithFields(logger.Fields{
+				"discovery": d.Name(),
+				"err":       err,
+			}).Error("Discovery DNS Resolve Failed, keep old nodes")
+		}
+	}
+}
+
+// reload 解析并下发全部结点
+func (d *dnsDiscovery) reload() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dns_resolve_timeout)
+	defer cancel()
+
+	var nodes []*GateWayProtos.ServiceInfo
+	var err error
+	if d.recordType == dnsRecord_A {
+		nodes, err = d.resolveA(ctx)
+	} else {
+		nodes, err = d.resolveSRV(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return errors.New("dns no record: " + d.host)
+	}
+	d.nodes.sync(nodes)
+	return nil
+}
+
+func (d *dnsDiscovery) resolveA(ctx context.Context) ([]*GateWayProtos.ServiceInfo, error) {
+	ips, err := d.resolver.LookupIPAddr(ctx, d.host)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*GateWayProtos.ServiceInfo, 0, len(ips))
+	keys := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		addr := net.JoinHostPort(ip.IP.String(), d.port)
+		if keys[addr] {
+			continue
+		}
+		keys[addr] = true
+		nodes = append(nodes, d.node.discovered(addr, d.host, true))
+	}
+	return nodes, nil
+}
+
+// resolveSRV 任一目标域名解析失败则整体失败, 避免误下线结点
+func (d *dnsDiscovery) resolveSRV(ctx context.Context) ([]*GateWayProtos.ServiceInfo, error) {
+	_, srvs, err := d.resolver.LookupSRV(ctx, "", "", d.host)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []*GateWayProtos.ServiceInfo
+	keys := make(map[string]bool)
+	for _, srv := range srvs {
+		target := strings.TrimSuffix(srv.Target, ".")
+		ips, err := d.resolver.LookupIPAddr(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			addr := net.JoinHostPort(ip.IP.String(), strconv.Itoa(int(srv.Port)))
+			if keys[addr] {
+				continue
+			}
+			keys[addr] = true
+			serviceInfo := d.node.discovered(addr, target, true)
+			if serviceInfo.ServiceWeight == 0 && srv.Weight > 0 {
+				serviceInfo.ServiceWeight = int32(srv.Weight)
+				if serviceInfo.ServiceWeight > max_srv_weight {
+					serviceInfo.ServiceWeight = max_srv_weight
+				}
+			}
+			nodes = append(nodes, serviceInfo)
+		}
+	}
+	return nodes, nil
+}
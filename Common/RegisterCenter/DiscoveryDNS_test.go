@@ -0,0 +1,329 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsStub 本地UDP DNS服务, 按名称返回A/SRV记录
+//	名称不存在返回NXDOMAIN, fail中的名称返回SERVFAIL
+type dnsStub struct {
+	mu   sync.Mutex
+	a    map[string][]string  // 名称->IPv4地址
+	srv  map[string][]net.SRV // 名称->SRV记录
+	fail map[string]bool      // 名称->返回SERVFAIL
+	conn net.PacketConn
+}
+
+func newDNSStub(t *testing.T) *dnsStub {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &dnsStub{
+		a:    make(map[string][]string),
+		srv:  make(map[string][]net.SRV),
+		fail: make(map[string]bool),
+		conn: conn,
+	}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+// resolver 全部查询发往本地DNS服务
+func (s *dnsStub) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+		},
+	}
+}
+
+func (s *dnsStub) set(modify func(s *dnsStub)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	modify(s)
+}
+
+func (s *dnsStub) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var p dnsmessage.Parser
+		header, err := p.Start(buf[:n])
+		if err != nil {
+			continue
+		}
+		question, err := p.Question()
+		if err != nil {
+			continue
+		}
+		if resp, err := s.answer(header, question); err == nil {
+			s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *dnsStub) answer(header dnsmessage.Header, q dnsmessage.Question) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := strings.ToLower(q.Name.String())
+	ips, hasA := s.a[name]
+	srvs, hasSRV := s.srv[name]
+	rcode := dnsmessage.RCodeSuccess
+	switch {
+	case s.fail[name]:
+		rcode = dnsmessage.RCodeServerFailure
+	case !hasA && !hasSRV:
+		rcode = dnsmessage.RCodeNameError
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:               header.ID,
+		Response:         true,
+		Authoritative:    true,
+		RecursionDesired: header.RecursionDesired,
+		RCode:            rcode,
+	})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	if rcode == dnsmessage.RCodeSuccess {
+		switch q.Type {
+		case dnsmessage.TypeA:
+			for _, ip := range ips {
+				var a [4]byte
+				copy(a[:], net.ParseIP(ip).To4())
+				if err := b.AResource(rh, dnsmessage.AResource{A: a}); err != nil {
+					return nil, err
+				}
+			}
+		case dnsmessage.TypeSRV:
+			for _, srv := range srvs {
+				target, err := dnsmessage.NewName(srv.Target)
+				if err != nil {
+					return nil, err
+				}
+				if err := b.SRVResource(rh, dnsmessage.SRVResource{
+					Priority: srv.Priority,
+					Weight:   srv.Weight,
+					Port:     srv.Port,
+					Target:   target,
+				}); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return b.Finish()
+}
+
+// startDNSDiscovery 使用本地DNS服务启动DNS服务发现
+func startDNSDiscovery(t *testing.T, stub *dnsStub, conf DiscoveryConfig) (*dnsDiscovery, *nodeUpdates) {
+	conf.Type = DiscoveryType_DNS
+	conf.Node = NodeConfig{
+		ServiceType:   int32(GateWayProtos.ServiceType_SERVICE_ALGO_CENTER),
+		Semver:        "v1.0.0",
+		ServiceWeight: conf.Node.ServiceWeight,
+	}
+	d, err := newDNSDiscovery(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.resolver = stub.resolver()
+
+	updates := &nodeUpdates{nodes: make(map[string]*GateWayProtos.ServiceInfo)}
+	if err := d.Start(updates.update); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(d.Stop)
+	return d, updates
+}
+
+func checkDNSNode(t *testing.T, updates *nodeUpdates, addr string, status GateWayProtos.ServiceStatus, weight int32, hostName string) {
+	t.Helper()
+	node := updates.get(addr)
+	if node == nil {
+		t.Fatalf("node %s not updated", addr)
+	}
+	if node.Status != int32(status) || node.ServiceWeight != weight || node.HostName != hostName {
+		t.Fatalf("node %s = %+v, want status %s, weight %d, host %s", addr, node, status, weight, hostName)
+	}
+}
+
+func TestDNSDiscoveryA(t *testing.T) {
+	stub := newDNSStub(t)
+	stub.set(func(s *dnsStub) {
+		s.a["algo.test."] = []string{"10.0.0.1", "10.0.0.2", "10.0.0.1"}
+	})
+	d, updates := startDNSDiscovery(t, stub, DiscoveryConfig{
+		Host:       "algo.test.",
+		RecordType: "a",
+		Port:       8080,
+	})
+
+	if updates.total() != 2 {
+		t.Fatalf("updates = %d, want 2", updates.total())
+	}
+	online := GateWayProtos.ServiceStatus_Online
+	checkDNSNode(t, updates, "10.0.0.1:8080", online, 0, "algo.test.")
+	checkDNSNode(t, updates, "10.0.0.2:8080", online, 0, "algo.test.")
+
+	// 结点变化: 10.0.0.1下线, 10.0.0.3上线, 10.0.0.2不重复下发
+	stub.set(func(s *dnsStub) {
+		s.a["algo.test."] = []string{"10.0.0.2", "10.0.0.3"}
+	})
+	if err := d.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if updates.total() != 4 {
+		t.Fatalf("updates = %d, want 4", updates.total())
+	}
+	checkDNSNode(t, updates, "10.0.0.1:8080", GateWayProtos.ServiceStatus_Offline, 0, "algo.test.")
+	checkDNSNode(t, updates, "10.0.0.3:8080", online, 0, "algo.test.")
+}
+
+func TestDNSDiscoverySRV(t *testing.T) {
+	online := GateWayProtos.ServiceStatus_Online
+	records := func(s *dnsStub) {
+		s.srv["_grpc._tcp.algo.test."] = []net.SRV{
+			{Target: "node1.algo.test.", Port: 9000, Weight: 10},
+			{Target: "node2.algo.test.", Port: 9001, Weight: 1000},
+			{Target: "node3.algo.test.", Port: 9002, Weight: 0},
+		}
+		s.a["node1.algo.test."] = []string{"10.0.1.1"}
+		s.a["node2.algo.test."] = []string{"10.0.1.2", "10.0.1.3"}
+		s.a["node3.algo.test."] = []string{"10.0.1.4"}
+	}
+
+	t.Run("record weight", func(t *testing.T) {
+		stub := newDNSStub(t)
+		stub.set(records)
+		_, updates := startDNSDiscovery(t, stub, DiscoveryConfig{Host: "_grpc._tcp.algo.test."})
+
+		if updates.total() != 4 {
+			t.Fatalf("updates = %d, want 4", updates.total())
+		}
+		checkDNSNode(t, updates, "10.0.1.1:9000", online, 10, "node1.algo.test")
+		// 权重超出上限时取上限
+		checkDNSNode(t, updates, "10.0.1.2:9001", online, max_srv_weight, "node2.algo.test")
+		checkDNSNode(t, updates, "10.0.1.3:9001", online, max_srv_weight, "node2.algo.test")
+		// 记录权重为0时保留模板权重(未配置)
+		checkDNSNode(t, updates, "10.0.1.4:9002", online, 0, "node3.algo.test")
+	})
+
+	t.Run("template weight", func(t *testing.T) {
+		stub := newDNSStub(t)
+		stub.set(records)
+		_, updates := startDNSDiscovery(t, stub, DiscoveryConfig{
+			Host: "_grpc._tcp.algo.test.",
+			Node: NodeConfig{ServiceWeight: 50},
+		})
+		checkDNSNode(t, updates, "10.0.1.1:9000", online, 50, "node1.algo.test")
+		checkDNSNode(t, updates, "10.0.1.2:9001", online, 50, "node2.algo.test")
+	})
+}
+
+// 解析失败时保留原有结点, 不下发任何变化
+func TestDNSDiscoveryKeepNodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(s *dnsStub)
+	}{
+		{
+			name: "target lookup failed",
+			modify: func(s *dnsStub) {
+				s.srv["_grpc._tcp.algo.test."] = append(s.srv["_grpc._tcp.algo.test."],
+					net.SRV{Target: "bad.algo.test.", Port: 9000, Weight: 1})
+				s.fail["bad.algo.test."] = true
+			},
+		},
+		{
+			name: "target not found",
+			modify: func(s *dnsStub) {
+				s.srv["_grpc._tcp.algo.test."] = append(s.srv["_grpc._tcp.algo.test."],
+					net.SRV{Target: "none.algo.test.", Port: 9000, Weight: 1})
+			},
+		},
+		{
+			name: "empty answer",
+			modify: func(s *dnsStub) {
+				s.srv["_grpc._tcp.algo.test."] = []net.SRV{}
+			},
+		},
+		{
+			name: "server failure",
+			modify: func(s *dnsStub) {
+				s.fail["_grpc._tcp.algo.test."] = true
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newDNSStub(t)
+			stub.set(func(s *dnsStub) {
+				s.srv["_grpc._tcp.algo.test."] = []net.SRV{{Target: "node1.algo.test.", Port: 9000, Weight: 10}}
+				s.a["node1.algo.test."] = []string{"10.0.1.1"}
+			})
+			d, updates := startDNSDiscovery(t, stub, DiscoveryConfig{Host: "_grpc._tcp.algo.test."})
+			if updates.total() != 1 {
+				t.Fatalf("updates = %d, want 1", updates.total())
+			}
+
+			stub.set(tt.modify)
+			if err := d.reload(); err == nil {
+				t.Fatal("reload should fail")
+			}
+			if updates.total() != 1 {
+				t.Fatalf("updates = %d, old nodes should be kept", updates.total())
+			}
+			checkDNSNode(t, updates, "10.0.1.1:9000", GateWayProtos.ServiceStatus_Online, 10, "node1.algo.test")
+		})
+	}
+}
+
+func TestNewDNSDiscovery(t *testing.T) {
+	node := NodeConfig{ServiceType: int32(GateWayProtos.ServiceType_SERVICE_ALGO_CENTER), Semver: "v1.0.0"}
+	tests := []struct {
+		name    string
+		conf    DiscoveryConfig
+		wantErr bool
+	}{
+		{name: "srv default", conf: DiscoveryConfig{Host: "algo.test", Node: node}},
+		{name: "a", conf: DiscoveryConfig{Host: "algo.test", RecordType: "A", Port: 80, Node: node}},
+		{name: "a without port", conf: DiscoveryConfig{Host: "algo.test", RecordType: "A", Node: node}, wantErr: true},
+		{name: "record type", conf: DiscoveryConfig{Host: "algo.test", RecordType: "AAAA", Node: node}, wantErr: true},
+		{name: "host empty", conf: DiscoveryConfig{Node: node}, wantErr: true},
+		{name: "interval", conf: DiscoveryConfig{Host: "algo.test", Interval: -1, Node: node}, wantErr: true},
+		{name: "dns server", conf: DiscoveryConfig{Host: "algo.test", DNSServer: "127.0.0.1", Node: node}},
+		{name: "dns server host", conf: DiscoveryConfig{Host: "algo.test", DNSServer: "dns.test:53", Node: node}, wantErr: true},
+		{name: "template semver", conf: DiscoveryConfig{Host: "algo.test", Node: NodeConfig{ServiceType: node.ServiceType}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newDNSDiscovery(tt.conf); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// endpoints Kubernetes Endpoints, 只解析结点相关字段
+type endpoints struct {
+	Kind     string `json:"kind" yaml:"kind"`
+	Metadata struct {
+		Name      string `json:"name" yaml:"name"`
+		Namespace string `json:"namespace" yaml:"namespace"`
+	} `json:"metadata" yaml:"metadata"`
+	Subsets []endpointSubset `json:"subsets" yaml:"subsets"`
+}
+
+type endpointSubset struct {
+	Addresses         []endpointAddress `json:"addresses" yaml:"addresses"`                 // 就绪的地址
+	NotReadyAddresses []endpointAddress `json:"notReadyAddresses" yaml:"notReadyAddresses"` // 未就绪的地址
+	Ports             []endpointPort    `json:"ports" yaml:"ports"`
+}
+
+type endpointAddress struct {
+	IP        string `json:"ip" yaml:"ip"`
+	Hostname  string `json:"hostname" yaml:"hostname"`
+	NodeName  string `json:"nodeName" yaml:"nodeName"`
+	TargetRef *struct {
+		Kind string `json:"kind" yaml:"kind"`
+		Name string `json:"name" yaml:"name"`
+	} `json:"targetRef" yaml:"targetRef"`
+}
+
+// hostName 结点主机名: hostname -> targetRef(Pod名称) -> nodeName
+func (a *endpointAddress) hostName() string {
+	if a.Hostname != "" {
+		return a.Hostname
+	}
+	if a.TargetRef != nil && a.TargetRef.Name != "" {
+		return a.TargetRef.Name
+	}
+	return a.NodeName
+}
+
+type endpointPort struct {
+	Name     string `json:"name" yaml:"name"`
+	Port     int32  `json:"port" yaml:"port"`
+	Protocol string `json:"protocol" yaml:"protocol"`
+}
+
+// newEndpointsDiscovery 监听Endpoints文件, 如: kubectl get endpoints algo-center -o json
+//	addresses下发为Online, notReadyAddresses下发为Offline, 全部结点使用同一个结点模板
+func newEndpointsDiscovery(conf DiscoveryConfig) (*fileDiscovery, error) {
+	if err := conf.Node.checkTemplate(); err != nil {
+		return nil, err
+	}
+	d, err := newFileWatcher(conf)
+	if err != nil {
+		return nil, err
+	}
+	node, portName := conf.Node, conf.PortName
+	d.parse = func(data []byte) ([]*GateWayProtos.ServiceInfo, error) {
+		ep := &endpoints{}
+		if err := unmarshalFile(d.filename, data, ep); err != nil {
+			return nil, err
+		}
+		return parseEndpoints(ep, node, portName)
+	}
+	return d, nil
+}
+
+// parseEndpoints Endpoints转换为结点, 同一地址同时出现在就绪及未就绪中时按就绪处理
+func parseEndpoints(ep *endpoints, node NodeConfig, portName string) ([]*GateWayProtos.ServiceInfo, error) {
+	if ep.Kind != "" && ep.Kind != "Endpoints" {
+		return nil, errors.New("endpoints kind invalid: " + ep.Kind)
+	}
+
+	var list []*GateWayProtos.ServiceInfo
+	index := make(map[string]int) // addr->list下标
+	add := func(address *endpointAddress, port int32, online bool) error {
+		if net.ParseIP(address.IP) == nil {
+			return errors.New("endpoints ip invalid: " + address.IP)
+		}
+		addr := net.JoinHostPort(address.IP, strconv.Itoa(int(port)))
+		serviceInfo := node.discovered(addr, address.hostName(), online)
+		if i, ok := index[addr]; ok {
+			if online {
+				list[i] = serviceInfo
+			}
+			return nil
+		}
+		index[addr] = len(list)
+		list = append(list, serviceInfo)
+		return nil
+	}
+
+	for i := range ep.Subsets {
+		subset := &ep.Subsets[i]
+		port, err := subset.port(portName)
+		if err != nil {
+			return nil, err
+		}
+		// 指定的端口不在本组中, 跳过
+		if port == 0 {
+			continue
+		}
+		for j := range subset.Addresses {
+			if err := add(&subset.Addresses[j], port, true); err != nil {
+				return nil, err
+			}
+		}
+		for j := range subset.NotReadyAddresses {
+			if err := add(&subset.NotReadyAddresses[j], port, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return list, nil
+}
+
+// port 按名称选择TCP端口, 名称为空时本组只能有一个端口; 没有指定名称的端口返回0
+func (subset *endpointSubset) port(portName string) (int32, error) {
+	var ports []*endpointPort
+	for i := range subset.Ports {
+		p := &subset.Ports[i]
+		if p.Protocol != "" && !strings.EqualFold(p.Protocol, "TCP") {
+			continue
+		}
+		if portName == "" || p.Name == portName {
+			ports = append(ports, p)
+		}
+	}
+	if len(ports) == 0 {
+		return 0, nil
+	}
+	if len(ports) > 1 {
+		return 0, errors.New("endpoints has multiple ports, port name required")
+	}
+	if ports[0].Port <= 0 || ports[0].Port > 65535 {
+		return 0, errors.New("endpoints port invalid: " + strconv.Itoa(int(ports[0].Port)))
+	}
+	return ports[0].Port, nil
+}
@@ -0,0 +1,154 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"encoding/json"
+	"testing"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	node := NodeConfig{ServiceType: int32(GateWayProtos.ServiceType_SERVICE_ALGO_CENTER), Semver: "v1.0.0"}
+	online := int32(GateWayProtos.ServiceStatus_Online)
+	offline := int32(GateWayProtos.ServiceStatus_Offline)
+
+	type want struct {
+		addr     string
+		status   int32
+		hostName string
+	}
+	tests := []struct {
+		name     string
+		data     string
+		portName string
+		want     []want
+		wantErr  bool
+	}{
+		{
+			name: "ready and not ready",
+			data: `{"kind": "Endpoints", "subsets": [{
+				"addresses": [{"ip": "10.0.0.1", "hostname": "pod-1"}],
+				"notReadyAddresses": [{"ip": "10.0.0.2", "hostname": "pod-2"}],
+				"ports": [{"port": 9090}]
+			}]}`,
+			want: []want{{"10.0.0.1:9090", online, "pod-1"}, {"10.0.0.2:9090", offline, "pod-2"}},
+		},
+		{
+			name: "ready and not ready same subset",
+			data: `{"subsets": [{
+				"addresses": [{"ip": "10.0.0.1"}],
+				"notReadyAddresses": [{"ip": "10.0.0.1"}],
+				"ports": [{"port": 9090}]
+			}]}`,
+			want: []want{{"10.0.0.1:9090", online, ""}},
+		},
+		{
+			name: "not ready before ready",
+			data: `{"subsets": [
+				{"notReadyAddresses": [{"ip": "10.0.0.1"}], "ports": [{"port": 9090}]},
+				{"addresses": [{"ip": "10.0.0.1"}], "ports": [{"port": 9090}]}
+			]}`,
+			want: []want{{"10.0.0.1:9090", online, ""}},
+		},
+		{
+			name: "host name",
+			data: `{"subsets": [{
+				"addresses": [
+					{"ip": "10.0.0.1", "hostname": "host", "nodeName": "node", "targetRef": {"kind": "Pod", "name": "pod"}},
+					{"ip": "10.0.0.2", "nodeName": "node", "targetRef": {"kind": "Pod", "name": "pod"}},
+					{"ip": "10.0.0.3", "nodeName": "node"}
+				],
+				"ports": [{"port": 9090}]
+			}]}`,
+			want: []want{{"10.0.0.1:9090", online, "host"}, {"10.0.0.2:9090", online, "pod"}, {"10.0.0.3:9090", online, "node"}},
+		},
+		{
+			name:     "port name",
+			portName: "grpc",
+			data: `{"subsets": [
+				{"addresses": [{"ip": "10.0.0.1"}], "ports": [{"name": "http", "port": 8080}, {"name": "grpc", "port": 9090}]},
+				{"addresses": [{"ip": "10.0.0.2"}], "ports": [{"name": "http", "port": 8080}]}
+			]}`,
+			want: []want{{"10.0.0.1:9090", online, ""}},
+		},
+		{
+			name: "ipv6",
+			data: `{"subsets": [{"addresses": [{"ip": "fd00::1"}], "ports": [{"port": 9090}]}]}`,
+			want: []want{{"[fd00::1]:9090", online, ""}},
+		},
+		{
+			name: "no subsets",
+			data: `{"kind": "Endpoints", "subsets": []}`,
+		},
+		{
+			name:    "kind invalid",
+			data:    `{"kind": "Service"}`,
+			wantErr: true,
+		},
+		{
+			name:    "ip invalid",
+			data:    `{"subsets": [{"addresses": [{"ip": "pod-1"}], "ports": [{"port": 9090}]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "multiple ports without name",
+			data:    `{"subsets": [{"addresses": [{"ip": "10.0.0.1"}], "ports": [{"port": 8080}, {"port": 9090}]}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := &endpoints{}
+			if err := json.Unmarshal([]byte(tt.data), ep); err != nil {
+				t.Fatal(err)
+			}
+			list, err := parseEndpoints(ep, node, tt.portName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(list) != len(tt.want) {
+				t.Fatalf("nodes = %v, want %v", list, tt.want)
+			}
+			for i, w := range tt.want {
+				got := list[i]
+				if got.Addr != w.addr || got.Status != w.status || got.HostName != w.hostName ||
+					got.ServiceType != node.ServiceType || got.Semver != node.Semver {
+					t.Fatalf("node[%d] = %+v, want %+v", i, got, w)
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointSubsetPort(t *testing.T) {
+	tests := []struct {
+		name     string
+		ports    []endpointPort
+		portName string
+		want     int32
+		wantErr  bool
+	}{
+		{name: "single port", ports: []endpointPort{{Port: 9090}}, want: 9090},
+		{name: "single port with name", ports: []endpointPort{{Name: "grpc", Port: 9090}}, want: 9090},
+		{name: "multiple ports without name", ports: []endpointPort{{Name: "http", Port: 8080}, {Name: "grpc", Port: 9090}}, wantErr: true},
+		{name: "multiple ports by name", ports: []endpointPort{{Name: "http", Port: 8080}, {Name: "grpc", Port: 9090}}, portName: "grpc", want: 9090},
+		{name: "name not found", ports: []endpointPort{{Name: "http", Port: 8080}}, portName: "grpc", want: 0},
+		{name: "no ports", want: 0},
+		{name: "non tcp skipped", ports: []endpointPort{{Port: 53, Protocol: "UDP"}, {Port: 9090, Protocol: "TCP"}}, want: 9090},
+		{name: "non tcp by name", ports: []endpointPort{{Name: "grpc", Port: 9090, Protocol: "SCTP"}}, portName: "grpc", want: 0},
+		{name: "protocol case", ports: []endpointPort{{Port: 9090, Protocol: "tcp"}}, want: 9090},
+		{name: "port invalid", ports: []endpointPort{{Port: 70000}}, wantErr: true},
+		{name: "port zero", ports: []endpointPort{{Port: 0}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subset := &endpointSubset{Ports: tt.ports}
+			port, err := subset.port(tt.portName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if port != tt.want {
+				t.Fatalf("port = %d, want %d", port, tt.want)
+			}
+		})
+	}
+}
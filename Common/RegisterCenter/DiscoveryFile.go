@@ -0,0 +1,151 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/logger"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const default_file_discovery_interval = 3000 // 默认文件检查间隔, 单位ms
+
+// fileDiscovery 监听结点文件, 文件修改后重新下发全部结点
+//	file: 文件内容为NodeConfig列表; endpoints: 文件内容为Endpoints, 见parseEndpoints
+//	按扩展名解析: .json/.yaml/.yml, 修改后的文件解析失败或结点为空时保留原有结点, 与dns一致
+type fileDiscovery struct {
+	typ      string
+	filename string
+	interval time.Duration
+	parse    func(data []byte) ([]*GateWayProtos.ServiceInfo, error) // 解析文件内容
+
+	modTime  time.Time // 文件修改时间
+	nodes    *nodeSet
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newFileDiscovery(conf DiscoveryConfig) (*fileDiscovery, error) {
+	d, err := newFileWatcher(conf)
+	if err != nil {
+		return nil, err
+	}
+	d.parse = func(data []byte) ([]*GateWayProtos.ServiceInfo, error) {
+		var confList []NodeConfig
+		if err := unmarshalFile(d.filename, data, &confList); err != nil {
+			return nil, err
+		}
+		return buildNodes(confList)
+	}
+	return d, nil
+}
+
+// newFileWatcher 校验文件配置, parse由调用方设置
+func newFileWatcher(conf DiscoveryConfig) (*fileDiscovery, error) {
+	if conf.FileName == "" {
+		return nil, errors.New("discovery file name empty")
+	}
+	switch strings.ToLower(filepath.Ext(conf.FileName)) {
+	case ".json", ".yaml", ".yml":
+	default:
+		return nil, errors.New("discovery file type not support: " + conf.FileName)
+	}
+	if conf.Interval < 0 {
+		return nil, errors.New("discovery file interval invalid")
+	}
+	interval := conf.Interval
+	if interval == 0 {
+		interval = default_file_discovery_interval
+	}
+	return &fileDiscovery{
+		typ:      conf.Type,
+		filename: conf.FileName,
+		interval: time.Duration(interval) * time.Millisecond,
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// unmarshalFile 按扩展名解析文件内容
+func unmarshalFile(filename string, data []byte, v interface{}) error {
+	if strings.ToLower(filepath.Ext(filename)) == ".json" {
+		return json.Unmarshal(data, v)
+	}
+	return yaml.Unmarshal(data, v)
+}
+
+func (d *fileDiscovery) Name() string {
+	return d.typ + ":" + d.filename
+}
+
+func (d *fileDiscovery) Start(update func(serviceInfo *GateWayProtos.ServiceInfo)) error {
+	d.nodes = newNodeSet(update)
+	if err := d.reload(); err != nil {
+		return err
+	}
+	go d.watch()
+	return nil
+}
+
+func (d *fileDiscovery) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.done)
+	})
+}
+
+// watch 定时检查文件修改时间, 修改后重新加载
+func (d *fileDiscovery) watch() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(d.filename)
+		if err != nil || info.ModTime().Equal(d.modTime) {
+			continue
+		}
+		if err := d.reload(); err != nil {
+			logger.Log().WithFields(logger.Fields{
+				"filename": d.filename,
+				"err":      err,
+			}).Error("Discovery File Reload Failed, keep old nodes")
+		} else {
+			logger.Log().WithField("filename", d.filename).Info("Discovery File Reload Succ")
+		}
+	}
+}
+
+// reload 读取文件并下发全部结点
+func (d *fileDiscovery) reload() error {
+	info, err := os.Stat(d.filename)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(d.filename)
+	if err != nil {
+		return err
+	}
+	// 无论解析是否成功, 文件未再次修改前不重复加载
+	d.modTime = info.ModTime()
+
+	nodes, err := d.parse(data)
+	if err != nil {
+		return err
+	}
+	// 结点为空多为文件写入中途或配置错误, 不下线全部结点
+	if len(nodes) == 0 {
+		return errors.New("discovery file no node: " + d.filename)
+	}
+	d.nodes.sync(nodes)
+	return nil
+}
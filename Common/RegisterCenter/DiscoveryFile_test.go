@@ -0,0 +1,109 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// nodeUpdates 记录下发的结点, addr->最近一次下发的结点
+type nodeUpdates struct {
+	mu    sync.Mutex
+	count int
+	nodes map[string]*GateWayProtos.ServiceInfo
+}
+
+func (u *nodeUpdates) update(serviceInfo *GateWayProtos.ServiceInfo) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.count++
+	u.nodes[serviceInfo.Addr] = serviceInfo
+}
+
+func (u *nodeUpdates) get(addr string) *GateWayProtos.ServiceInfo {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.nodes[addr]
+}
+
+func (u *nodeUpdates) total() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.count
+}
+
+func TestFileDiscoveryKeepNodes(t *testing.T) {
+	node := NodeConfig{ServiceType: int32(GateWayProtos.ServiceType_SERVICE_ALGO_CENTER), Semver: "v1.0.0"}
+	tests := []struct {
+		name     string
+		typ      string
+		fileName string
+		data     string
+		modify   string
+	}{
+		{
+			name:     "file empty list",
+			typ:      DiscoveryType_File,
+			fileName: "nodes.json",
+			data:     `[{"service_type": 9090, "addr": "10.0.0.1:9090", "semver": "v1.0.0"}]`,
+			modify:   `[]`,
+		},
+		{
+			name:     "file invalid",
+			typ:      DiscoveryType_File,
+			fileName: "nodes.json",
+			data:     `[{"service_type": 9090, "addr": "10.0.0.1:9090", "semver": "v1.0.0"}]`,
+			modify:   `[{"service_type": 9090`,
+		},
+		{
+			name:     "endpoints no subsets",
+			typ:      DiscoveryType_Endpoints,
+			fileName: "endpoints.json",
+			data:     `{"subsets": [{"addresses": [{"ip": "10.0.0.1"}], "ports": [{"port": 9090}]}]}`,
+			modify:   `{"subsets": []}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), tt.fileName)
+			if err := ioutil.WriteFile(fileName, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			// 检查间隔足够长, 只由测试调用reload
+			conf := DiscoveryConfig{Type: tt.typ, FileName: fileName, Interval: 3600000, Node: node}
+			var d *fileDiscovery
+			var err error
+			if tt.typ == DiscoveryType_File {
+				d, err = newFileDiscovery(conf)
+			} else {
+				d, err = newEndpointsDiscovery(conf)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			updates := &nodeUpdates{nodes: make(map[string]*GateWayProtos.ServiceInfo)}
+			if err := d.Start(updates.update); err != nil {
+				t.Fatal(err)
+			}
+			defer d.Stop()
+			if updates.total() != 1 {
+				t.Fatalf("updates = %d, want 1", updates.total())
+			}
+
+			if err := ioutil.WriteFile(fileName, []byte(tt.modify), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.reload(); err == nil {
+				t.Fatal("reload should fail")
+			}
+			if updates.total() != 1 {
+				t.Fatalf("updates = %d, old nodes should be kept", updates.total())
+			}
+			if n := updates.get("10.0.0.1:9090"); n == nil || n.Status != int32(GateWayProtos.ServiceStatus_Online) {
+				t.Fatalf("node = %+v, want online", n)
+			}
+		})
+	}
+}
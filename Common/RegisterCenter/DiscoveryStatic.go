@@ -0,0 +1,29 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+)
+
+// staticDiscovery 配置文件中的静态结点列表, 启动时下发一次
+type staticDiscovery struct {
+	nodes []*GateWayProtos.ServiceInfo
+}
+
+func newStaticDiscovery(conf DiscoveryConfig) (*staticDiscovery, error) {
+	nodes, err := buildNodes(conf.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	return &staticDiscovery{nodes: nodes}, nil
+}
+
+func (d *staticDiscovery) Name() string {
+	return DiscoveryType_Static
+}
+
+func (d *staticDiscovery) Start(update func(serviceInfo *GateWayProtos.ServiceInfo)) error {
+	newNodeSet(update).sync(d.nodes)
+	return nil
+}
+
+func (d *staticDiscovery) Stop() {}
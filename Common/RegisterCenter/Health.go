@@ -0,0 +1,100 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+// 超过该时间未与注册中心通信成功, 视为注册中心不可达(Ping间隔3秒, 允许连续失败2次)
+const regCenterContactTimeout = 10 * time.Second
+
+// DependencyHealth 依赖服务的就绪状态
+type DependencyHealth struct {
+	Name    string `json:"name"`              // 服务名称
+	Ready   bool   `json:"ready"`             // 是否就绪
+	State   string `json:"state"`             // grpc连接状态, READY表示至少有一个可用连接
+	Addrs   int    `json:"addrs"`             // 已解析的结点数量
+	Message string `json:"message,omitempty"` // 未就绪原因
+}
+
+// recordContact 记录与注册中心的通信结果
+func (regCenter *RegisterCenter) recordContact(err error) {
+	regCenter.healthLock.Lock()
+	defer regCenter.healthLock.Unlock()
+	regCenter.lastErr = err
+	if err == nil {
+		regCenter.lastContact = time.Now()
+	}
+}
+
+// Health 注册中心及RelyList中各依赖服务的就绪状态, 不使用注册中心时只返回依赖服务
+//	注册中心: 最近regCenterContactTimeout内通信成功
+//	依赖服务: grpc连接状态为READY, 即至少有一个可用的SubConn
+func (regCenter *RegisterCenter) Health() []DependencyHealth {
+	var list []DependencyHealth
+
+	// 注册中心, 不使用注册中心时不检查
+	if regCenter.regEnable {
+		list = append(list, regCenter.regCenterHealth())
+	}
+
+	// 依赖服务
+	for _, relyInfo := range regCenter.serviceInfo.RelyList {
+		name := GateWayProtos.ServiceType(relyInfo.RelyServiceType).String()
+		list = append(list, regCenter.clientHealth(regCenter.clientMaps[name], name))
+	}
+	return list
+}
+
+// regCenterHealth 注册中心的连通状态
+func (regCenter *RegisterCenter) regCenterHealth() DependencyHealth {
+	rc_name := GateWayProtos.ServiceType_REGISTER_CENTER.String()
+	rc := regCenter.clientHealth(regCenter.clientMaps[rc_name], rc_name)
+	regCenter.healthLock.Lock()
+	lastContact, lastErr := regCenter.lastContact, regCenter.lastErr
+	regCenter.healthLock.Unlock()
+	switch {
+	case lastContact.IsZero():
+		rc.Ready = false
+		rc.Message = "register center never contacted"
+	case time.Since(lastContact) > regCenterContactTimeout:
+		rc.Ready = false
+		rc.Message = "last contact " + time.Since(lastContact).Truncate(time.Second).String() + " ago"
+		if lastErr != nil {
+			rc.Message += ": " + lastErr.Error()
+		}
+	default:
+		rc.Ready = true
+		rc.Message = ""
+	}
+	return rc
+}
+
+// clientHealth 单个下级服务的连接状态
+func (regCenter *RegisterCenter) clientHealth(client *unifiedClient, name string) DependencyHealth {
+	health := DependencyHealth{
+		Name: name,
+	}
+	if client == nil || client.conn == nil {
+		health.State = "UNKNOWN"
+		health.Message = "client not initialized"
+		return health
+	}
+
+	state := client.conn.GetState()
+	health.State = state.String()
+	if client.serviceResolver != nil {
+		health.Addrs = client.serviceResolver.addrCount()
+	}
+	health.Ready = state == connectivity.Ready
+	if !health.Ready {
+		if health.Addrs == 0 {
+			health.Message = "no resolved address"
+		} else {
+			health.Message = "no ready connection"
+		}
+	}
+	return health
+}
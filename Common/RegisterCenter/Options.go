@@ -3,6 +3,8 @@ package RegisterCenter
 import (
 	"context"
 	"errors"
+	"strings"
+	"sync"
 
 	"google.golang.org/grpc/resolver"
 )
@@ -17,9 +19,12 @@ const (
 )
 
 const (
-	Param_CMD       = "cmd"
-	Param_PickType  = "pick_type"
-	Param_PickParam = "pick_param" // 负载均衡参数(hash_key/addr)
+	Param_CMD         = "cmd"
+	Param_PickType    = "pick_type"
+	Param_PickParam   = "pick_param"   // 负载均衡参数(hash_key/addr)
+	Param_Semver      = "semver"       // 版本约束, 如: ">=1.2.0, <2.0.0"
+	Param_GroupTab    = "group_tab"    // 分组标签, 只选择分组相同的结点
+	Param_ExcludeAddr = "exclude_addr" // 排除的结点地址, 逗号分隔
 
 	PickType_ConsistentHash = "consistent_hash" // 一致性哈希
 	PickType_RandWeight     = "rand_weight"     // 随机权重
@@ -36,6 +41,7 @@ type RealNode struct {
 	Addr        string `json:"addr"`
 	Semver      string `json:"semver"`
 	Status      int32  `json:"status"`
+	GroupTab    string `json:"group_tab"`
 }
 
 type VirtualNode struct {
@@ -58,6 +64,76 @@ func getCtxFilter(ctx context.Context) map[string]string {
 	return ctx.Value(RegCenterContext).(map[string]string)
 }
 
+// copyCtxFilter 复制ctx中的过滤参数, 修改时不影响调用方
+func copyCtxFilter(ctx context.Context) map[string]string {
+	data := getCtxFilter(ctx)
+	newData := make(map[string]string, len(data)+2)
+	for k, v := range data {
+		newData[k] = v
+	}
+	return newData
+}
+
+// containsAddr 判断逗号分隔的地址列表中是否包含addr
+func containsAddr(addrList string, addr string) bool {
+	for addrList != "" {
+		item := addrList
+		if idx := strings.IndexByte(addrList, ','); idx >= 0 {
+			item, addrList = addrList[:idx], addrList[idx+1:]
+		} else {
+			addrList = ""
+		}
+		if item == addr {
+			return true
+		}
+	}
+	return false
+}
+
+type ctxKey_PickRecord struct{}
+
+// pickRecord 记录负载均衡选中的结点地址, 选择失败时记录原因
+type pickRecord struct {
+	mu   sync.Mutex
+	addr string
+	err  error // 选择失败原因, 如: ErrCircuitOpen/ErrNotFoundConn
+}
+
+func (record *pickRecord) set(addr string) {
+	record.mu.Lock()
+	record.addr = addr
+	record.err = nil
+	record.mu.Unlock()
+}
+
+func (record *pickRecord) fail(err error) {
+	record.mu.Lock()
+	record.err = err
+	record.mu.Unlock()
+}
+
+func (record *pickRecord) get() string {
+	record.mu.Lock()
+	defer record.mu.Unlock()
+	return record.addr
+}
+
+func (record *pickRecord) getErr() error {
+	record.mu.Lock()
+	defer record.mu.Unlock()
+	return record.err
+}
+
+// withPickRecord 在ctx中附加选择记录, 负载均衡选中结点后写入地址
+func withPickRecord(ctx context.Context, record *pickRecord) context.Context {
+	return context.WithValue(ctx, ctxKey_PickRecord{}, record)
+}
+
+func getPickRecord(ctx context.Context) *pickRecord {
+	record, _ := ctx.Value(ctxKey_PickRecord{}).(*pickRecord)
+	return record
+}
+
 type attrKey_Info struct{}
 type attrKey_Idx struct{}
 
@@ -0,0 +1,205 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/logger"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 结点本地覆盖操作, 只影响本网关的结点选择, 不通知注册中心
+const (
+	OverrideAction_ZeroWeight = "zero_weight" // 权重置零, 不参与随机权重/一致性哈希, 指定地址仍可选择
+	OverrideAction_Offline    = "offline"     // 强制下线, 从解析结果中移除, 忽略注册中心的上线状态
+	OverrideAction_Pin        = "pin"         // 固定在线, 忽略注册中心的下线状态
+)
+
+const MaxOverrideTTL = 24 * time.Hour // 覆盖最长有效期
+
+var ErrOverrideAction = errors.New("override action invalid")
+var ErrOverrideTTL = errors.New("override ttl invalid")
+var ErrNodeNotFound = errors.New("node not found")
+
+// NodeOverride 结点本地覆盖, 到期自动恢复为注册中心下发的状态
+type NodeOverride struct {
+	ServiceType int32     `json:"service_type"`
+	ServiceName string    `json:"service_name"`
+	Addr        string    `json:"addr"`
+	Action      string    `json:"action"`
+	Operator    string    `json:"operator"`
+	Reason      string    `json:"reason,omitempty"`
+	CreateTime  time.Time `json:"create_time"`
+	ExpireTime  time.Time `json:"expire_time"`
+
+	timer *time.Timer
+}
+
+var overrideLock sync.Mutex
+var overrideMap sync.Map // serviceType/addr->*NodeOverride, 不同下级服务可能使用相同地址
+
+func nodeKey(serviceType int32, addr string) string {
+	return strconv.Itoa(int(serviceType)) + "/" + addr
+}
+
+func getOverride(serviceType int32, addr string) *NodeOverride {
+	if val, ok := overrideMap.Load(nodeKey(serviceType, addr)); ok {
+		return val.(*NodeOverride)
+	}
+	return nil
+}
+
+// getOverrideAction 结点当前的覆盖操作, 没有覆盖返回空
+func getOverrideAction(serviceType int32, addr string) string {
+	if o := getOverride(serviceType, addr); o != nil {
+		return o.Action
+	}
+	return ""
+}
+
+// overrideWeighted 结点是否参与按权重选择(随机权重/一致性哈希)
+func overrideWeighted(serviceType int32, addr string) bool {
+	return getOverrideAction(serviceType, addr) != OverrideAction_ZeroWeight
+}
+
+// SetNodeOverride 设置结点本地覆盖, 同一结点已有覆盖时替换
+//	只能覆盖注册中心已下发的下级服务结点, 注册中心结点通过RegisterCenterAddr配置
+func (regCenter *RegisterCenter) SetNodeOverride(
+	serviceType int32,
+	addr string,
+	action string,
+	ttl time.Duration,
+	operator string,
+	reason string,
+) (*NodeOverride, error) {
+	switch action {
+	case OverrideAction_ZeroWeight, OverrideAction_Offline, OverrideAction_Pin:
+	default:
+		return nil, ErrOverrideAction
+	}
+	if ttl <= 0 || ttl > MaxOverrideTTL {
+		return nil, ErrOverrideTTL
+	}
+
+	client, err := regCenter.getOverrideClient(serviceType)
+	if err != nil {
+		return nil, err
+	}
+	if client.getServiceInfo(addr) == nil {
+		return nil, ErrNodeNotFound
+	}
+
+	now := time.Now()
+	o := &NodeOverride{
+		ServiceType: serviceType,
+		ServiceName: client.serviceName,
+		Addr:        addr,
+		Action:      action,
+		Operator:    operator,
+		Reason:      reason,
+		CreateTime:  now,
+		ExpireTime:  now.Add(ttl),
+	}
+
+	key := nodeKey(serviceType, addr)
+	overrideLock.Lock()
+	if val, ok := overrideMap.Load(key); ok {
+		val.(*NodeOverride).timer.Stop()
+	}
+	o.timer = time.AfterFunc(ttl, func() {
+		regCenter.expireNodeOverride(o)
+	})
+	overrideMap.Store(key, o)
+	overrideLock.Unlock()
+
+	client.reloadAddr(addr)
+	return o, nil
+}
+
+// ClearNodeOverride 取消结点本地覆盖, 恢复为注册中心下发的状态
+func (regCenter *RegisterCenter) ClearNodeOverride(serviceType int32, addr string) (*NodeOverride, error) {
+	key := nodeKey(serviceType, addr)
+	overrideLock.Lock()
+	val, ok := overrideMap.Load(key)
+	if !ok {
+		overrideLock.Unlock()
+		return nil, ErrNodeNotFound
+	}
+	o := val.(*NodeOverride)
+	o.timer.Stop()
+	overrideMap.Delete(key)
+	overrideLock.Unlock()
+
+	if client, err := regCenter.getOverrideClient(serviceType); err == nil {
+		client.reloadAddr(addr)
+	}
+	return o, nil
+}
+
+// NodeOverrides 当前全部结点本地覆盖, 按服务类型及地址排序
+func (regCenter *RegisterCenter) NodeOverrides() []*NodeOverride {
+	var list []*NodeOverride
+	overrideMap.Range(func(key, value interface{}) bool {
+		list = append(list, value.(*NodeOverride))
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ServiceType != list[j].ServiceType {
+			return list[i].ServiceType < list[j].ServiceType
+		}
+		return list[i].Addr < list[j].Addr
+	})
+	return list
+}
+
+// expireNodeOverride 覆盖到期, 未被替换时删除并恢复结点状态
+func (regCenter *RegisterCenter) expireNodeOverride(o *NodeOverride) {
+	key := nodeKey(o.ServiceType, o.Addr)
+	overrideLock.Lock()
+	val, ok := overrideMap.Load(key)
+	if !ok || val.(*NodeOverride) != o {
+		overrideLock.Unlock()
+		return
+	}
+	overrideMap.Delete(key)
+	overrideLock.Unlock()
+
+	logger.Log().WithFields(logger.Fields{
+		"service":  o.ServiceName,
+		"addr":     o.Addr,
+		"action":   o.Action,
+		"operator": o.Operator,
+	}).Info("Node Override Expired")
+
+	if client, err := regCenter.getOverrideClient(o.ServiceType); err == nil {
+		client.reloadAddr(o.Addr)
+	}
+}
+
+// getOverrideClient 可以覆盖结点的下级服务
+func (regCenter *RegisterCenter) getOverrideClient(serviceType int32) (*unifiedClient, error) {
+	if serviceType == int32(GateWayProtos.ServiceType_REGISTER_CENTER) {
+		return nil, errors.New("register center node can not be overridden")
+	}
+	client, ok := regCenter.clientMaps[GateWayProtos.ServiceType(serviceType).String()]
+	if !ok || client == nil {
+		return nil, errors.New("service_type not watch.")
+	}
+	return client, nil
+}
+
+// getServiceInfo 注册中心下发的结点信息, 不存在返回nil
+func (client *unifiedClient) getServiceInfo(addr string) *GateWayProtos.ServiceInfo {
+	client.rwlock.RLock()
+	defer client.rwlock.RUnlock()
+	return client.si_map[addr]
+}
+
+// reloadAddr 按注册中心下发的结点信息及本地覆盖重新更新结点
+func (client *unifiedClient) reloadAddr(addr string) {
+	if serviceInfo := client.getServiceInfo(addr); serviceInfo != nil {
+		client.updateAddr(serviceInfo)
+	}
+}
@@ -2,11 +2,13 @@ package RegisterCenter
 
 import (
 	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/Metrics"
 	"GateWayCommon/logger"
 	"bytes"
 	"context"
 	"errors"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -17,6 +19,15 @@ type RegisterCenter struct {
 	serviceInfo *GateWayProtos.ServiceInfo // 本地服务信息
 	clientMaps  map[string]*unifiedClient  // 下级服务管理
 	crontab     *cron.Cron                 // 定时任务
+
+	regEnable   bool        // 是否使用注册中心
+	regAddrLock sync.Mutex  // 注册中心地址锁
+	regAddrList []string    // 注册中心地址
+	discoveries []Discovery // 注册中心之外的服务发现
+
+	healthLock  sync.Mutex // 注册中心连通状态锁
+	lastContact time.Time  // 最近一次与注册中心通信成功的时间
+	lastErr     error      // 最近一次与注册中心通信的错误
 }
 
 func newCrontabWithSeconds() *cron.Cron {
@@ -27,11 +38,18 @@ func newCrontabWithSeconds() *cron.Cron {
 	return cron.New(cron.WithParser(secondParser), cron.WithChain())
 }
 
+// Init 初始化下级服务管理
+//	regAddrList为空时不使用注册中心, 下级服务结点全部来自服务发现discoveries
 func (regCenter *RegisterCenter) Init(
 	serviceInfo *GateWayProtos.ServiceInfo,
 	regAddrList []string,
+	discoveries ...Discovery,
 ) error {
 	regCenter.serviceInfo = serviceInfo
+	regCenter.regEnable = len(regAddrList) > 0
+	if !regCenter.regEnable && len(discoveries) == 0 {
+		return errors.New("register center addr and discovery are both empty")
+	}
 
 	newCustomizeBuilder()
 
@@ -45,31 +63,44 @@ func (regCenter *RegisterCenter) Init(
 		regCenter.clientMaps[client.serviceName] = client
 	}
 
-	// 添加注册中心客户端
+	regCenter.crontab = newCrontabWithSeconds()
+	if regCenter.regEnable {
+		if err := regCenter.initRegCenter(regAddrList); err != nil {
+			return err
+		}
+	}
+
+	// 启动服务发现, 与注册中心下发的结点一同参与负载均衡
+	for _, discovery := range discoveries {
+		if err := discovery.Start(regCenter.onDiscovery); err != nil {
+			regCenter.Close()
+			return errors.New("discovery " + discovery.Name() + " start failed: " + err.Error())
+		}
+		regCenter.discoveries = append(regCenter.discoveries, discovery)
+		logger.Log().WithField("discovery", discovery.Name()).Info("Discovery Start Succ")
+	}
+	return nil
+}
+
+// initRegCenter 添加注册中心客户端及定时任务
+func (regCenter *RegisterCenter) initRegCenter(regAddrList []string) error {
 	rc_client := new(unifiedClient)
 	if err := rc_client.Init(int32(GateWayProtos.ServiceType_REGISTER_CENTER), "1.0.0"); err != nil {
 		return err
 	}
 	regCenter.clientMaps[rc_client.serviceName] = rc_client
 
-	for _, regAddr := range regAddrList {
-		rc_info := &GateWayProtos.ServiceInfo{
-			ServiceType:   int32(GateWayProtos.ServiceType_REGISTER_CENTER),
-			Semver:        "1.0.0",
-			Addr:          regAddr,
-			Status:        int32(GateWayProtos.ServiceStatus_Online),
-			ServiceWeight: 32,
-		}
-		regCenter.updateClient(rc_info)
-	}
+	regCenter.UpdateRegisterCenterAddr(regAddrList)
 
-	// 初始化定时器, 添加定时任务
+	// 添加定时任务
 	// 1. Ping 3sec
-	regCenter.crontab = newCrontabWithSeconds()
 	if _, err := regCenter.crontab.AddFunc("*/3 * * * * *", func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 		defer cancel()
-		if err := regCenter.ping(ctx); err != nil {
+		err := regCenter.ping(ctx)
+		regCenter.recordContact(err)
+		if err != nil {
+			Metrics.RegCenterTaskFailures.WithLabelValues("ping").Inc()
 			logger.Log().WithField("err", err).Warn("RegisterCenter Ping Failed")
 		}
 	}); err != nil {
@@ -80,35 +111,52 @@ func (regCenter *RegisterCenter) Init(
 	if _, err := regCenter.crontab.AddFunc("*/30 * * * * *", func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 		defer cancel()
-		if err := regCenter.check(ctx); err != nil {
+		err := regCenter.check(ctx)
+		regCenter.recordContact(err)
+		if err != nil {
+			Metrics.RegCenterTaskFailures.WithLabelValues("check").Inc()
 			logger.Log().WithField("err", err).Warn("RegisterCenter Check Failed")
 		}
 	}); err != nil {
 		return err
 	}
-
 	return nil
 }
 
-// Online 服务上线
+// RegisterCenterEnabled 是否使用注册中心
+func (regCenter *RegisterCenter) RegisterCenterEnabled() bool {
+	return regCenter.regEnable
+}
+
+// Online 服务上线, 不使用注册中心时直接返回
 func (regCenter *RegisterCenter) Online() error {
+	if !regCenter.regEnable {
+		return nil
+	}
+
 	// 请求ctx
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
 	// 服务上线
-	if err := regCenter.online(ctx); err != nil {
+	err := regCenter.online(ctx)
+	regCenter.recordContact(err)
+	if err != nil {
 		return err
 	}
-	
+
 	regCenter.crontab.Start()
 	return nil
 }
 
-// Offline 服务下线
+// Offline 服务下线, 不使用注册中心时直接返回
+//	服务发现不停止, 下线后仍需要请求下级服务处理未完成的请求
 func (regCenter *RegisterCenter) Offline() error {
 	regCenter.serviceInfo.Status = int32(GateWayProtos.ServiceStatus_Offline)
 	regCenter.crontab.Stop()
+	if !regCenter.regEnable {
+		return nil
+	}
 
 	// 请求ctx
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
@@ -121,22 +169,111 @@ func (regCenter *RegisterCenter) Offline() error {
 	return nil
 }
 
+// Close 停止服务发现
+func (regCenter *RegisterCenter) Close() {
+	for _, discovery := range regCenter.discoveries {
+		discovery.Stop()
+	}
+}
+
+// onDiscovery 服务发现的结点写入下级服务管理
+//	未填写分组的结点使用本服务分组, 否则会被结点选择过滤; 发现的结点不在Check时上报注册中心
+func (regCenter *RegisterCenter) onDiscovery(serviceInfo *GateWayProtos.ServiceInfo) {
+	if serviceInfo.GroupTab == "" && regCenter.serviceInfo.GroupTab != "" {
+		serviceInfo = proto.Clone(serviceInfo).(*GateWayProtos.ServiceInfo)
+		serviceInfo.GroupTab = regCenter.serviceInfo.GroupTab
+	}
+	serviceName := GateWayProtos.ServiceType(serviceInfo.ServiceType).String()
+	if client, ok := regCenter.clientMaps[serviceName]; ok && client != nil {
+		client.setDiscovered(serviceInfo.Addr)
+	}
+	if err := regCenter.updateClient(serviceInfo); err != nil {
+		logger.Log().WithFields(logger.Fields{
+			"service_info": serviceInfo,
+			"err":          err,
+		}).Debug("Discovery Update Node Failed")
+	}
+}
+
+// UpdateRegisterCenterAddr 更新注册中心地址, 新增地址上线, 删除地址下线
+// P.s> 只更新本地连接, 不会触发本服务的Offline/Online
+func (regCenter *RegisterCenter) UpdateRegisterCenterAddr(
+	regAddrList []string,
+) {
+	if !regCenter.regEnable {
+		if len(regAddrList) > 0 {
+			logger.Log().WithField("regAddr", regAddrList).Warn("RegisterCenter disabled at startup, restart required")
+		}
+		return
+	}
+
+	regCenter.regAddrLock.Lock()
+	defer regCenter.regAddrLock.Unlock()
+
+	newAddrMap := make(map[string]bool, len(regAddrList))
+	for _, regAddr := range regAddrList {
+		newAddrMap[regAddr] = true
+	}
+
+	// 删除的地址下线
+	for _, regAddr := range regCenter.regAddrList {
+		if !newAddrMap[regAddr] {
+			regCenter.updateClient(newRegisterCenterInfo(regAddr, GateWayProtos.ServiceStatus_Offline))
+		}
+	}
+
+	// 新地址上线, 已有地址重复上线不影响
+	for _, regAddr := range regAddrList {
+		regCenter.updateClient(newRegisterCenterInfo(regAddr, GateWayProtos.ServiceStatus_Online))
+	}
+	regCenter.regAddrList = append([]string{}, regAddrList...)
+}
+
+func newRegisterCenterInfo(
+	regAddr string,
+	status GateWayProtos.ServiceStatus,
+) *GateWayProtos.ServiceInfo {
+	return &GateWayProtos.ServiceInfo{
+		ServiceType:   int32(GateWayProtos.ServiceType_REGISTER_CENTER),
+		Semver:        "1.0.0",
+		Addr:          regAddr,
+		Status:        int32(status),
+		ServiceWeight: 32,
+	}
+}
+
 func (regCenter *RegisterCenter) CallService(
 	ctx context.Context,
 	serviceType int32,
 	cmd int32,
 	request []byte,
 ) ([]byte, int32, error) {
+	st := time.Now()
+
 	// 根据类型获取服务列表
 	serviceName := GateWayProtos.ServiceType(serviceType).String()
 	client, ok := regCenter.clientMaps[serviceName]
 	if !ok || client == nil {
 		errStr := "not found server, please check service and version, serviceType = " + strconv.Itoa(int(serviceType))
-		return []byte(errStr), int32(GateWayProtos.ResultType_ERR_NO_Server), nil
+		result := int32(GateWayProtos.ResultType_ERR_NO_Server)
+		Metrics.ObserveUpstream(serviceType, cmd, result, time.Since(st))
+		return []byte(errStr), result, nil
+	}
+
+	// 只选择与本服务分组相同的下级服务, 注册中心不区分分组
+	if serviceType != int32(GateWayProtos.ServiceType_REGISTER_CENTER) &&
+		regCenter.serviceInfo.GroupTab != "" {
+		data := copyCtxFilter(ctx)
+		if _, ok := data[Param_GroupTab]; !ok {
+			data[Param_GroupTab] = regCenter.serviceInfo.GroupTab
+			ctx = BuildCtxFilter(ctx, data)
+		}
 	}
 
 	// 调用服务
-	return client.callService(ctx, cmd, request)
+	response, result, err := client.callService(ctx, cmd, request)
+	Metrics.ObserveUpstream(serviceType, cmd, result, time.Since(st))
+	return response, result, err
 }
 
 func (regCenter *RegisterCenter) updateClient(
@@ -159,6 +296,9 @@ func (regCenter *RegisterCenter) updateClient(
 		}).Warn("client.updateAddr Failed")
 		return err
 	}
+	if serviceInfo.Status != int32(GateWayProtos.ServiceStatus_Online) {
+		breakerRemove(serviceInfo.Addr)
+	}
 	logger.Log().WithField("service_info", serviceInfo).Debug("client.updateAddr Succ")
 	return nil
 }
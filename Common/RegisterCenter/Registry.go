@@ -0,0 +1,123 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"sort"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+// ServiceView 下级服务的结点视图
+type ServiceView struct {
+	ServiceType int32       `json:"service_type"`
+	ServiceName string      `json:"service_name"`
+	RelySemver  string      `json:"rely_semver"`
+	State       string      `json:"state"` // grpc连接状态
+	Nodes       []*NodeView `json:"nodes"`
+}
+
+// NodeView 结点视图
+type NodeView struct {
+	ServiceInfo  *GateWayProtos.ServiceInfo `json:"service_info"`       // 注册中心下发的结点信息
+	VirtualNodes int                        `json:"virtual_nodes"`      // 虚拟结点数量, 未解析为0
+	SubConnState string                     `json:"subconn_state"`      // 结点连接状态
+	Breaker      string                     `json:"breaker"`            // 熔断状态
+	Override     *NodeOverride              `json:"override,omitempty"` // 本地覆盖
+	Eligible     bool                       `json:"eligible"`           // 是否可以被随机权重选中
+	Reasons      []string                   `json:"reasons,omitempty"`  // 不可选中的原因
+}
+
+// 结点连接状态
+const (
+	subConnState_Ready    = "READY"     // 连接可用
+	subConnState_NotReady = "NOT_READY" // 已解析, 连接不可用
+	subConnState_None     = "NONE"      // 未解析, 没有连接
+)
+
+// Services 全部下级服务(含注册中心)的结点视图, 按服务名称及地址排序
+func (regCenter *RegisterCenter) Services() []*ServiceView {
+	var list []*ServiceView
+	for _, client := range regCenter.clientMaps {
+		list = append(list, regCenter.serviceView(client))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ServiceName < list[j].ServiceName
+	})
+	return list
+}
+
+func (regCenter *RegisterCenter) serviceView(client *unifiedClient) *ServiceView {
+	view := &ServiceView{
+		ServiceType: client.serviceType,
+		ServiceName: client.serviceName,
+		RelySemver:  client.relySemver,
+		State:       "UNKNOWN",
+	}
+	connReady := false
+	if client.conn != nil {
+		state := client.conn.GetState()
+		view.State = state.String()
+		connReady = state == connectivity.Ready
+	}
+	readyAddrs := map[string]bool{}
+	if val, ok := readyAddrMap.Load(client.serviceName); ok && connReady {
+		readyAddrs = val.(map[string]bool)
+	}
+
+	// 只选择与本服务分组相同的结点, 注册中心不区分分组
+	groupTab := ""
+	if client.serviceType != int32(GateWayProtos.ServiceType_REGISTER_CENTER) {
+		groupTab = regCenter.serviceInfo.GroupTab
+	}
+
+	client.rwlock.RLock()
+	infos := make([]*GateWayProtos.ServiceInfo, 0, len(client.si_map))
+	for _, info := range client.si_map {
+		infos = append(infos, info)
+	}
+	client.rwlock.RUnlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Addr < infos[j].Addr
+	})
+
+	for _, info := range infos {
+		node := &NodeView{
+			ServiceInfo:  info,
+			SubConnState: subConnState_None,
+			Breaker:      breakerStateOf(info.Addr),
+			Override:     getOverride(client.serviceType, info.Addr),
+		}
+		if client.serviceResolver != nil {
+			node.VirtualNodes = client.serviceResolver.vnodeCount(info.Addr)
+		}
+		if node.VirtualNodes > 0 {
+			node.SubConnState = subConnState_NotReady
+			if readyAddrs[info.Addr] {
+				node.SubConnState = subConnState_Ready
+			}
+		}
+
+		if node.Override != nil {
+			if node.Override.Action != OverrideAction_Pin {
+				node.Reasons = append(node.Reasons, "override "+node.Override.Action)
+			}
+		} else if info.Status != int32(GateWayProtos.ServiceStatus_Online) {
+			node.Reasons = append(node.Reasons, "status "+GateWayProtos.ServiceStatus(info.Status).String())
+		}
+		if !client.checkVersion(info.Semver) {
+			node.Reasons = append(node.Reasons, "semver mismatch")
+		}
+		if groupTab != "" && info.GroupTab != groupTab {
+			node.Reasons = append(node.Reasons, "group_tab mismatch")
+		}
+		if node.SubConnState != subConnState_Ready {
+			node.Reasons = append(node.Reasons, "subconn "+node.SubConnState)
+		}
+		if !breakerEligible(info.Addr) {
+			node.Reasons = append(node.Reasons, "circuit "+node.Breaker)
+		}
+		node.Eligible = len(node.Reasons) == 0
+		view.Nodes = append(view.Nodes, node)
+	}
+	return view
+}
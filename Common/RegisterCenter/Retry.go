@@ -0,0 +1,215 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// RetryConfig 下级服务接口重试及对冲配置
+type RetryConfig struct {
+	CMD            string   // 服务接口, CmdType枚举名称或数值
+	MaxAttempts    int      // 最大请求次数(含首次请求及对冲请求), <=1 不重试
+	AttemptTimeout int64    // 单次请求超时, 单位ms; 0为只受调用方超时限制
+	Backoff        int64    // 重试间隔, 单位ms
+	RetryCodes     []string // 重试的grpc错误码, 不填默认 Unavailable, DeadlineExceeded
+	RetryResults   []string // 重试的ResultType, ResultType枚举名称或数值
+	Hedge          bool     // 是否启用对冲请求
+	HedgeDelay     int64    // 对冲请求延迟, 单位ms; 0为使用接口最近请求耗时的p95
+}
+
+// retryPolicy 解析后的重试策略
+type retryPolicy struct {
+	maxAttempts    int
+	attemptTimeout time.Duration
+	backoff        time.Duration
+	retryCodes     map[codes.Code]bool
+	retryResults   map[int32]bool
+	hedge          bool
+	hedgeDelay     time.Duration
+}
+
+// RetryPolicies 解析后的全部重试策略, 通过BuildRetryPolicies生成
+type RetryPolicies struct {
+	cmdMap map[int32]*retryPolicy
+}
+
+var retryCodeMap = map[string]codes.Code{
+	"Unavailable":       codes.Unavailable,
+	"DeadlineExceeded":  codes.DeadlineExceeded,
+	"ResourceExhausted": codes.ResourceExhausted,
+	"Aborted":           codes.Aborted,
+	"Internal":          codes.Internal,
+	"Unknown":           codes.Unknown,
+}
+
+var retryPolicies atomic.Value // *RetryPolicies
+
+func init() {
+	retryPolicies.Store(&RetryPolicies{})
+}
+
+func parseEnum(str string, valueMap map[string]int32) (int32, error) {
+	if val, ok := valueMap[str]; ok {
+		return val, nil
+	}
+	val, err := strconv.ParseInt(str, 10, 32)
+	if err != nil {
+		return 0, errors.New("enum value invalid: " + str)
+	}
+	return int32(val), nil
+}
+
+// BuildRetryPolicies 校验重试配置
+func BuildRetryPolicies(confList []RetryConfig) (*RetryPolicies, error) {
+	policies := &RetryPolicies{
+		cmdMap: make(map[int32]*retryPolicy, len(confList)),
+	}
+	for _, conf := range confList {
+		cmd, err := parseEnum(conf.CMD, GateWayProtos.CmdType_value)
+		if err != nil {
+			return nil, errors.New("retry cmd invalid, cmd = " + conf.CMD)
+		}
+		if _, ok := policies.cmdMap[cmd]; ok {
+			return nil, errors.New("retry cmd repeated, cmd = " + conf.CMD)
+		}
+		if conf.AttemptTimeout < 0 || conf.Backoff < 0 || conf.HedgeDelay < 0 {
+			return nil, errors.New("retry time invalid, cmd = " + conf.CMD)
+		}
+
+		policy := &retryPolicy{
+			maxAttempts:    conf.MaxAttempts,
+			attemptTimeout: time.Duration(conf.AttemptTimeout) * time.Millisecond,
+			backoff:        time.Duration(conf.Backoff) * time.Millisecond,
+			retryCodes:     make(map[codes.Code]bool),
+			retryResults:   make(map[int32]bool),
+			hedge:          conf.Hedge,
+			hedgeDelay:     time.Duration(conf.HedgeDelay) * time.Millisecond,
+		}
+		if policy.maxAttempts < 1 {
+			policy.maxAttempts = 1
+		}
+
+		if len(conf.RetryCodes) == 0 {
+			policy.retryCodes[codes.Unavailable] = true
+			policy.retryCodes[codes.DeadlineExceeded] = true
+		}
+		for _, str := range conf.RetryCodes {
+			code, ok := retryCodeMap[str]
+			if !ok {
+				return nil, errors.New("retry code not support, code = " + str)
+			}
+			policy.retryCodes[code] = true
+		}
+		for _, str := range conf.RetryResults {
+			result, err := parseEnum(str, GateWayProtos.ResultType_value)
+			if err != nil || result == int32(GateWayProtos.ResultType_OK) {
+				return nil, errors.New("retry result invalid, result = " + str)
+			}
+			policy.retryResults[result] = true
+		}
+		policies.cmdMap[cmd] = policy
+	}
+	return policies, nil
+}
+
+// StoreRetryPolicies 替换重试配置
+func StoreRetryPolicies(policies *RetryPolicies) {
+	if policies != nil {
+		retryPolicies.Store(policies)
+	}
+}
+
+func getRetryPolicy(cmd int32) *retryPolicy {
+	return retryPolicies.Load().(*RetryPolicies).cmdMap[cmd]
+}
+
+// shouldRetry 判断请求结果是否需要重试
+func (policy *retryPolicy) shouldRetry(r *attemptResult) bool {
+	if r.err != nil {
+		// 没有可选择的结点, 重试没有意义
+		if r.noServer() {
+			return false
+		}
+		return policy.retryCodes[r.code()]
+	}
+	return policy.retryResults[r.result]
+}
+
+const (
+	latency_sample_size     = 512              // 接口耗时采样数
+	latency_min_sample      = 100              // 计算p95的最少采样数
+	latency_update_interval = time.Second      // p95更新间隔
+	hedge_min_delay         = time.Millisecond // 对冲请求最小延迟
+)
+
+// latencyTracker 接口最近请求耗时, 用于计算对冲请求延迟
+type latencyTracker struct {
+	mu       sync.Mutex
+	samples  [latency_sample_size]time.Duration
+	count    int
+	idx      int
+	p95      time.Duration
+	lastCalc time.Time
+}
+
+var latencyMap sync.Map // cmd->*latencyTracker
+
+func getLatencyTracker(cmd int32) *latencyTracker {
+	if val, ok := latencyMap.Load(cmd); ok {
+		return val.(*latencyTracker)
+	}
+	val, _ := latencyMap.LoadOrStore(cmd, &latencyTracker{})
+	return val.(*latencyTracker)
+}
+
+func (lt *latencyTracker) record(dur time.Duration) {
+	lt.mu.Lock()
+	lt.samples[lt.idx] = dur
+	lt.idx = (lt.idx + 1) % latency_sample_size
+	if lt.count < latency_sample_size {
+		lt.count++
+	}
+	lt.mu.Unlock()
+}
+
+// percentile95 最近请求耗时的p95, 采样不足时返回0
+func (lt *latencyTracker) percentile95() time.Duration {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if lt.count < latency_min_sample {
+		return 0
+	}
+	if time.Since(lt.lastCalc) < latency_update_interval {
+		return lt.p95
+	}
+
+	sorted := make([]time.Duration, lt.count)
+	copy(sorted, lt.samples[:lt.count])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	lt.p95 = sorted[lt.count*95/100]
+	lt.lastCalc = time.Now()
+	return lt.p95
+}
+
+// getHedgeDelay 对冲请求延迟, 返回0表示不发送对冲请求
+func (policy *retryPolicy) getHedgeDelay(cmd int32) time.Duration {
+	if !policy.hedge || policy.maxAttempts < 2 {
+		return 0
+	}
+	delay := policy.hedgeDelay
+	if delay == 0 {
+		delay = getLatencyTracker(cmd).percentile95()
+	}
+	if delay > 0 && delay < hedge_min_delay {
+		delay = hedge_min_delay
+	}
+	return delay
+}
@@ -0,0 +1,116 @@
+package RegisterCenter
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/semver"
+)
+
+// 版本约束, 多个条件以逗号或空格分隔, 需全部满足, 如:
+//
+//	">=1.2.0, <2.0.0"
+//	"^1.2.0"  主版本号相同, 且 >= 1.2.0
+//	"~1.2.0"  主次版本号相同, 且 >= 1.2.0
+//	"1.2.3" 或 "=1.2.3"  版本号相同
+type semverCond struct {
+	op      string
+	version string
+}
+
+var constraintCache sync.Map // constraint->[]semverCond
+
+// canonicalSemver 加上前导v并校验
+func canonicalSemver(version string) (string, bool) {
+	if version == "" {
+		return "", false
+	}
+	if version[0] != 'v' {
+		version = "v" + version
+	}
+	if !semver.IsValid(version) {
+		return "", false
+	}
+	return version, true
+}
+
+// parseSemverConstraint 解析版本约束
+func parseSemverConstraint(constraint string) ([]semverCond, error) {
+	if val, ok := constraintCache.Load(constraint); ok {
+		return val.([]semverCond), nil
+	}
+
+	var condList []semverCond
+	fields := strings.FieldsFunc(constraint, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	for _, field := range fields {
+		op := ""
+		for _, prefix := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+			if strings.HasPrefix(field, prefix) {
+				op = prefix
+				break
+			}
+		}
+		version, ok := canonicalSemver(strings.TrimPrefix(field, op))
+		if !ok {
+			return nil, errors.New("semver constraint invalid: " + constraint)
+		}
+		if op == "" {
+			op = "="
+		}
+		condList = append(condList, semverCond{op: op, version: version})
+	}
+	if len(condList) == 0 {
+		return nil, errors.New("semver constraint empty")
+	}
+
+	constraintCache.Store(constraint, condList)
+	return condList, nil
+}
+
+// matchSemver 判断版本是否满足约束, 约束无效时视为不满足
+func matchSemver(version string, constraint string) bool {
+	version, ok := canonicalSemver(version)
+	if !ok {
+		return false
+	}
+
+	condList, err := parseSemverConstraint(constraint)
+	if err != nil {
+		return false
+	}
+
+	for _, cond := range condList {
+		cmp := semver.Compare(version, cond.version)
+		switch cond.op {
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case "<":
+			ok = cmp < 0
+		case "!=":
+			ok = cmp != 0
+		case "=":
+			ok = cmp == 0
+		case "^":
+			ok = cmp >= 0 && semver.Major(version) == semver.Major(cond.version)
+		case "~":
+			ok = cmp >= 0 && semver.MajorMinor(version) == semver.MajorMinor(cond.version)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckSemverConstraint 校验版本约束格式
+func CheckSemverConstraint(constraint string) error {
+	_, err := parseSemverConstraint(constraint)
+	return err
+}
@@ -2,7 +2,11 @@ package RegisterCenter
 
 import (
 	"GateWayCommon/ConsistentHash"
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/Metrics"
+	"GateWayCommon/Tracing"
 	"math/rand"
+	"strings"
 	"sync"
 
 	"google.golang.org/grpc/balancer"
@@ -10,23 +14,37 @@ import (
 )
 
 func newCustomizeBuilder() {
-	balancer.Register(base.NewBalancerBuilder(
-		RegCenterLoadBalancer,
-		&tdPickerBuilder{},
-		base.Config{HealthCheck: true}))
+	balancer.Register(&tdBalancerBuilder{})
 	return
 }
 
-type tdPickerBuilder struct{}
+// tdBalancerBuilder 每个下级服务连接创建独立的PickerBuilder, 用于按服务记录可用结点
+type tdBalancerBuilder struct{}
+
+func (*tdBalancerBuilder) Name() string { return RegCenterLoadBalancer }
+
+func (*tdBalancerBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	// 连接地址为 RegCenterScheme:///serviceName
+	pb := &tdPickerBuilder{serviceName: strings.TrimPrefix(opts.Target.URL.Path, "/")}
+	return base.NewBalancerBuilder(RegCenterLoadBalancer, pb, base.Config{HealthCheck: true}).Build(cc, opts)
+}
+
+type tdPickerBuilder struct {
+	serviceName string
+}
+
+var readyAddrMap sync.Map // serviceName->map[string]bool, 最近一次生成Picker时连接可用的结点地址
 
 func (r *tdPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
 	if len(info.ReadySCs) == 0 {
+		readyAddrMap.Delete(r.serviceName)
 		return base.NewErrPickerV2(balancer.ErrNoSubConnAvailable)
 	}
 
 	tdp := &tdPicker{
 		k2vn:      make(map[string]*VirtualNode),
 		k2conn:    make(map[string]balancer.SubConn),
+		addr2vn:   make(map[string]*VirtualNode),
 		addr2conn: make(map[string]balancer.SubConn),
 		hash:      ConsistentHash.New(),
 	}
@@ -38,18 +56,28 @@ func (r *tdPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
 
 		tdp.k2vn[key] = vn
 		tdp.k2conn[key] = conn
+		tdp.addr2vn[addr] = vn
 		tdp.addr2conn[addr] = conn
 		tdp.hash.Add(key)
 	}
 	if len(tdp.k2conn) == 0 {
+		readyAddrMap.Delete(r.serviceName)
 		return base.NewErrPickerV2(balancer.ErrNoSubConnAvailable)
 	}
+
+	// 记录可用结点, 用于查看结点连接状态
+	readyAddrs := make(map[string]bool, len(tdp.addr2vn))
+	for addr := range tdp.addr2vn {
+		readyAddrs[addr] = true
+	}
+	readyAddrMap.Store(r.serviceName, readyAddrs)
 	return tdp
 }
 
 type tdPicker struct {
 	k2vn      map[string]*VirtualNode     // key->虚拟结点
 	k2conn    map[string]balancer.SubConn // key->连接
+	addr2vn   map[string]*VirtualNode     // addr->虚拟结点
 	addr2conn map[string]balancer.SubConn // addr->连接
 	hash      *ConsistentHash.Consistent  // 一致性Hash
 	mu        sync.Mutex
@@ -65,15 +93,33 @@ func (p *tdPicker) Pick(pi balancer.PickInfo) (balancer.PickResult, error) {
 
 	filter := getCtxFilter(pi.Ctx)
 	pick_type := filter[Param_PickType]
+
+	_, span := Tracing.Start(pi.Ctx, "Pick", Tracing.SpanKind_Internal)
+	defer span.End()
+	span.SetAttribute("gateway.pick_type", pick_type)
+
+	var result balancer.PickResult
+	var err error
 	if pick_type == PickType_ConsistentHash {
-		return p.PickConsistentHash(pi, filter)
+		result, err = p.PickConsistentHash(pi, filter)
 	} else if pick_type == PickType_RandWeight {
-		return p.PickRandWeight(pi, filter)
+		result, err = p.PickRandWeight(pi, filter)
 	} else if pick_type == PickType_SpecifyAddr {
-		return p.PickSpecifyAddr(pi, filter)
+		result, err = p.PickSpecifyAddr(pi, filter)
 	} else {
-		return balancer.PickResult{}, ErrNotFoundPickType
+		err = ErrNotFoundPickType
 	}
+
+	if err != nil {
+		Metrics.RegCenterPickerErrors.WithLabelValues(pick_type, err.Error()).Inc()
+		span.SetError(err)
+		if record := getPickRecord(pi.Ctx); record != nil {
+			record.fail(err)
+		}
+	} else if record := getPickRecord(pi.Ctx); record != nil {
+		span.SetAttribute("net.peer.name", record.get())
+	}
+	return result, err
 }
 
 func (p *tdPicker) PickConsistentHash(
@@ -85,20 +131,37 @@ func (p *tdPicker) PickConsistentHash(
 		return balancer.PickResult{}, ErrNotFoundPickParam
 	}
 
-	// 获取最近3个结点, 防止有不匹配的情况
-	keys, err := p.hash.GetN(hash_key, 3)
+	// 沿哈希环查找第一个匹配且未熔断的真实结点, 同一地址的虚拟结点只判断一次
+	var sc balancer.SubConn
+	var addr string
+	circuitOpen := false
+	checked := make(map[string]bool)
+	err := p.hash.Walk(hash_key, func(key string) bool {
+		vn := p.k2vn[key]
+		if vn == nil || vn.Rn == nil || checked[vn.Rn.Addr] {
+			return true
+		}
+		checked[vn.Rn.Addr] = true
+		if p.filterNode(vn, filter) && overrideWeighted(vn.Rn.ServiceType, vn.Rn.Addr) {
+			if !breakerAvailable(vn.Rn.Addr) {
+				circuitOpen = true
+			} else {
+				sc, addr = p.k2conn[key], vn.Rn.Addr
+				return false
+			}
+		}
+		// 全部地址已判断过
+		return len(checked) < len(p.addr2vn)
+	})
 	if err != nil {
 		return balancer.PickResult{}, err
 	}
-
-	// 遍历结点, 返回第一个匹配的结点
-	for _, key := range keys {
-		vn := p.k2vn[key]
-		if p.filterNode(vn, getCtxFilter(pi.Ctx)) {
-			sc := p.k2conn[key]
-			// fmt.Println("[DEBUG] consistent_hash choose filter =", filter, "hash_key =", hash_key, "key =", key)
-			return balancer.PickResult{SubConn: sc}, nil
-		}
+	if sc != nil {
+		p.picked(pi, addr)
+		return balancer.PickResult{SubConn: sc}, nil
+	}
+	if circuitOpen {
+		return balancer.PickResult{}, ErrCircuitOpen
 	}
 	return balancer.PickResult{}, ErrNotFoundConn
 }
@@ -108,18 +171,38 @@ func (p *tdPicker) PickRandWeight(
 	filter map[string]string,
 ) (balancer.PickResult, error) {
 	var subConns []balancer.SubConn
+	var addrs []string
+	circuitOpen := false
+	available := make(map[string]bool) // addr->是否未熔断, 同一地址的虚拟结点只判断一次
 	for key, conn := range p.k2conn {
 		vn := p.k2vn[key]
-		if p.filterNode(vn, getCtxFilter(pi.Ctx)) {
-			subConns = append(subConns, conn)
+		if !p.filterNode(vn, filter) || !overrideWeighted(vn.Rn.ServiceType, vn.Rn.Addr) {
+			continue
+		}
+
+		addr := vn.Rn.Addr
+		ok, checked := available[addr]
+		if !checked {
+			ok = breakerAvailable(addr)
+			available[addr] = ok
 		}
+		if !ok {
+			circuitOpen = true
+			continue
+		}
+		subConns = append(subConns, conn)
+		addrs = append(addrs, addr)
 	}
 	if len(subConns) == 0 {
+		if circuitOpen {
+			return balancer.PickResult{}, ErrCircuitOpen
+		}
 		return balancer.PickResult{}, ErrNotFoundConn
 	}
 	// 从满足条件的地址选择一个
 	index := rand.Intn(len(subConns))
 	sc := subConns[index]
+	p.picked(pi, addrs[index])
 	return balancer.PickResult{SubConn: sc}, nil
 }
 
@@ -127,21 +210,68 @@ func (p *tdPicker) PickSpecifyAddr(
 	pi balancer.PickInfo,
 	filter map[string]string,
 ) (balancer.PickResult, error) {
-	if addr, ok := filter[Param_PickParam]; ok {
-		sc := p.addr2conn[addr]
-		return balancer.PickResult{SubConn: sc}, nil
+	addr, ok := filter[Param_PickParam]
+	if !ok {
+		return balancer.PickResult{}, ErrNotFoundPickParam
+	}
+
+	// 指定地址不存在或不满足过滤条件, 不能返回nil SubConn
+	sc, ok := p.addr2conn[addr]
+	if !ok || !p.filterNode(p.addr2vn[addr], filter) {
+		return balancer.PickResult{}, ErrNotFoundConn
+	}
+	if !breakerAvailable(addr) {
+		return balancer.PickResult{}, ErrCircuitOpen
+	}
+	p.picked(pi, addr)
+	return balancer.PickResult{SubConn: sc}, nil
+}
+
+// picked 结点被选中, 记录到熔断器及请求的选择记录中
+func (p *tdPicker) picked(
+	pi balancer.PickInfo,
+	addr string,
+) {
+	breakerPicked(addr)
+	if record := getPickRecord(pi.Ctx); record != nil {
+		record.set(addr)
 	}
-	return balancer.PickResult{}, ErrNotFoundPickParam
 }
 
 func (p *tdPicker) filterNode(
 	vn *VirtualNode,
 	filter map[string]string,
 ) bool {
+	if vn == nil || vn.Rn == nil {
+		return false
+	}
+
 	// node在线
+	if vn.Rn.Status != int32(GateWayProtos.ServiceStatus_Online) {
+		return false
+	}
+
 	// 版本匹配
+	if constraint := filter[Param_Semver]; constraint != "" &&
+		!matchSemver(vn.Rn.Semver, constraint) {
+		return false
+	}
+
+	// 分组匹配
+	if groupTab := filter[Param_GroupTab]; groupTab != "" &&
+		vn.Rn.GroupTab != groupTab {
+		return false
+	}
+
+	// 排除已失败的结点(重试/对冲请求)
+	if exclude := filter[Param_ExcludeAddr]; exclude != "" &&
+		containsAddr(exclude, vn.Rn.Addr) {
+		return false
+	}
+
 	// 接口在线
 	// 接口限流
-	// 接口熔断
+	// 接口熔断: 由 breakerAvailable 单独判断, 以区分结点全部熔断的情况
+	// 权重置零: 由 overrideWeighted 单独判断, 指定地址时仍可选择
 	return true
 }
@@ -0,0 +1,125 @@
+package RegisterCenter
+
+import (
+	"GateWayCommon/ConsistentHash"
+	"GateWayCommon/GateWayProtos"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/resolver"
+)
+
+type testSubConn struct {
+	addr string
+}
+
+func (sc *testSubConn) UpdateAddresses([]resolver.Address) {}
+func (sc *testSubConn) Connect()                           {}
+
+// newTestPicker 每个地址32个虚拟结点
+func newTestPicker(addrs ...string) *tdPicker {
+	p := &tdPicker{
+		k2vn:      make(map[string]*VirtualNode),
+		k2conn:    make(map[string]balancer.SubConn),
+		addr2vn:   make(map[string]*VirtualNode),
+		addr2conn: make(map[string]balancer.SubConn),
+		hash:      ConsistentHash.New(),
+	}
+	for _, addr := range addrs {
+		rn := &RealNode{
+			ServiceType: int32(GateWayProtos.ServiceType_SERVICE_ALGO_CENTER),
+			Addr:        addr,
+			Status:      int32(GateWayProtos.ServiceStatus_Online),
+		}
+		sc := &testSubConn{addr: addr}
+		for i := 0; i < 32; i++ {
+			vn := &VirtualNode{Key: addr + ":" + strconv.Itoa(i), Rn: rn}
+			p.k2vn[vn.Key] = vn
+			p.k2conn[vn.Key] = sc
+			p.addr2vn[addr] = vn
+			p.addr2conn[addr] = sc
+			p.hash.Add(vn.Key)
+		}
+	}
+	return p
+}
+
+func openBreaker(t *testing.T, addr string) {
+	cb := getBreaker(addr)
+	cb.mu.Lock()
+	cb.state = breakerState_Open
+	cb.openUntil = time.Now().Add(time.Minute)
+	cb.mu.Unlock()
+	t.Cleanup(func() { breakerRemove(addr) })
+}
+
+func pickHash(p *tdPicker, key string, data map[string]string) (string, *pickRecord, error) {
+	filter := map[string]string{Param_PickType: PickType_ConsistentHash, Param_PickParam: key}
+	for k, v := range data {
+		filter[k] = v
+	}
+	record := &pickRecord{}
+	ctx := withPickRecord(BuildCtxFilter(context.Background(), filter), record)
+	result, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+	if err != nil {
+		return "", record, err
+	}
+	return result.SubConn.(*testSubConn).addr, record, nil
+}
+
+func TestPickConsistentHash(t *testing.T) {
+	SetBreakerConfig(BreakerConfig{Enable: true})
+	defer SetBreakerConfig(BreakerConfig{})
+
+	addrs := []string{"10.0.0.1:9090", "10.0.0.2:9090", "10.0.0.3:9090"}
+	p := newTestPicker(addrs...)
+	first, _, err := pickHash(p, "user-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _, _ := pickHash(p, "user-1", nil); again != first {
+		t.Fatalf("pick = %s, want stable %s", again, first)
+	}
+
+	// 首选结点熔断时沿哈希环选择其他结点
+	openBreaker(t, first)
+	second, _, err := pickHash(p, "user-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Fatalf("pick = %s, circuit open node selected", second)
+	}
+
+	// 排除结点后仍可选择剩余结点
+	third, _, err := pickHash(p, "user-1", map[string]string{Param_ExcludeAddr: second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == first || third == second {
+		t.Fatalf("pick = %s, want the remaining node", third)
+	}
+
+	// 全部熔断才返回ErrCircuitOpen, 并记录到pickRecord
+	for _, addr := range addrs {
+		if addr != first {
+			openBreaker(t, addr)
+		}
+	}
+	_, record, err := pickHash(p, "user-1", nil)
+	if err != ErrCircuitOpen || record.getErr() != ErrCircuitOpen {
+		t.Fatalf("err = %v, record = %v, want %v", err, record.getErr(), ErrCircuitOpen)
+	}
+
+	// 全部被排除返回ErrNotFoundConn
+	breakerRemove(addrs[0])
+	breakerRemove(addrs[1])
+	breakerRemove(addrs[2])
+	_, record, err = pickHash(p, "user-1", map[string]string{Param_ExcludeAddr: addrs[0] + "," + addrs[1] + "," + addrs[2]})
+	if err != ErrNotFoundConn || record.getErr() != ErrNotFoundConn {
+		t.Fatalf("err = %v, record = %v, want %v", err, record.getErr(), ErrNotFoundConn)
+	}
+}
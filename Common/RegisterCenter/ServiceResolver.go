@@ -58,6 +58,25 @@ func (r *serviceResolver) delAddr(
 
 }
 
+// vnodeCount 地址的虚拟结点数量, 未解析返回0
+func (r *serviceResolver) vnodeCount(addr string) int {
+	val, ok := r.addrs.Load(addr)
+	if !ok {
+		return 0
+	}
+	return val.(int)
+}
+
+// addrCount 已解析地址数量
+func (r *serviceResolver) addrCount() int {
+	count := 0
+	r.addrs.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
 func (r *serviceResolver) update() {
 	r.cc.UpdateState(resolver.State{Addresses: r.getAddress()})
 }
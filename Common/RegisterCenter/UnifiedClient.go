@@ -2,18 +2,25 @@ package RegisterCenter
 
 import (
 	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/Metrics"
+	"GateWayCommon/Tracing"
 	"context"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/mod/semver"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
 )
 
 func newGrpcConn(addr string) (*grpc.ClientConn, error) {
@@ -39,12 +46,15 @@ type unifiedClient struct {
 	serviceName string // 服务名称
 	relySemver  string // 服务依赖版本号
 
+	conn            *grpc.ClientConn                   // 客户端连接
 	client          GateWayProtos.UnifiedServiceClient // 服务客户端
 	serviceResolver *serviceResolver                   // 服务解析器
+	batchers        sync.Map                           // 批量请求 batchKey->*batcher
 
 	rwlock sync.RWMutex                          // 读写锁
 	si_map map[string]*GateWayProtos.ServiceInfo // 客户端信息
 	rn_map map[string]*RealNode                  // 真实结点信息
+	ds_map map[string]bool                       // 服务发现下发的结点地址
 }
 
 func (client *unifiedClient) Init(
@@ -70,6 +80,7 @@ func (client *unifiedClient) Init(
 	client.rwlock.Lock()
 	client.si_map = make(map[string]*GateWayProtos.ServiceInfo)
 	client.rn_map = make(map[string]*RealNode)
+	client.ds_map = make(map[string]bool)
 	client.rwlock.Unlock()
 
 	// 初始化服务解析器
@@ -84,6 +95,7 @@ func (client *unifiedClient) connection(addr string) error {
 	if conn, err := newGrpcConn(addr); err != nil {
 		return err
 	} else {
+		client.conn = conn
 		client.client = GateWayProtos.NewUnifiedServiceClient(conn)
 		return nil
 	}
@@ -94,24 +106,282 @@ func (client *unifiedClient) callService(
 	cmd int32,
 	request []byte,
 ) ([]byte, int32, error) {
-	data := getCtxFilter(ctx)
+	data := copyCtxFilter(ctx)
 	data[Param_CMD] = strconv.Itoa(int(cmd))
 	if _, ok := data[Param_PickType]; !ok {
 		data[Param_PickType] = PickType_RandWeight
 	}
-	ctx = BuildCtxFilter(ctx, data)
+
+	// 随机权重的请求可以合并为批量请求, 指定结点的请求不合并
+	var r *attemptResult
+	if policy := getBatchPolicy(cmd); policy != nil &&
+		data[Param_PickType] == PickType_RandWeight {
+		r = client.callBatch(ctx, cmd, request, data, policy)
+	} else {
+		r = client.callUnbatched(BuildCtxFilter(ctx, data), cmd, request)
+	}
 
 	// 调用服务, 失败返回错误信息即可
-	if resp, err := client.client.CallService(ctx,
+	if r.err != nil {
+		// 结点全部熔断
+		if r.pickErr == ErrCircuitOpen {
+			errStr := "no available server, " + ErrCircuitOpen.Error() + ", serviceType = " + client.serviceName
+			return []byte(errStr), int32(GateWayProtos.ResultType_ERR_NO_Server), nil
+		}
+		return []byte(""), int32(GateWayProtos.ResultType_ERR_Call_Service), r.err
+	}
+	return r.response, r.result, nil
+}
+
+// callUnbatched 按重试策略请求下级服务, ctx中需已设置过滤参数
+func (client *unifiedClient) callUnbatched(
+	ctx context.Context,
+	cmd int32,
+	request []byte,
+) *attemptResult {
+	return client.callWithPolicy(ctx, cmd, request, getRetryPolicy(cmd))
+}
+
+// callWithPolicy 按指定的重试策略请求下级服务, policy为nil时只请求一次
+func (client *unifiedClient) callWithPolicy(
+	ctx context.Context,
+	cmd int32,
+	request []byte,
+	policy *retryPolicy,
+) *attemptResult {
+	data := copyCtxFilter(ctx)
+	data[Param_CMD] = strconv.Itoa(int(cmd))
+
+	// 未配置重试策略或指定地址时只请求一次
+	if policy == nil || policy.maxAttempts <= 1 ||
+		data[Param_PickType] == PickType_SpecifyAddr {
+		return client.attempt(ctx, cmd, request, data, nil, 0, nil)
+	}
+	return client.callWithRetry(ctx, cmd, request, data, policy)
+}
+
+// attemptResult 单次请求结果
+type attemptResult struct {
+	response []byte
+	result   int32
+	err      error
+	addr     string // 选中的结点地址, 未选中结点为空
+	pickErr  error  // 负载均衡选择结点失败的原因, 由Picker写入pickRecord
+}
+
+func (r *attemptResult) code() codes.Code {
+	return status.Code(r.err)
+}
+
+// noServer 没有可选择的结点(全部熔断或被排除)
+func (r *attemptResult) noServer() bool {
+	if r.err == nil {
+		return false
+	}
+	return r.pickErr == ErrCircuitOpen || r.pickErr == ErrNotFoundConn
+}
+
+// attempt 发送一次请求, exclude为需要排除的结点, timeout为单次请求超时(0为不限制)
+func (client *unifiedClient) attempt(
+	ctx context.Context,
+	cmd int32,
+	request []byte,
+	data map[string]string,
+	exclude []string,
+	timeout time.Duration,
+	record *pickRecord,
+) *attemptResult {
+	filter := data
+	if len(exclude) > 0 {
+		filter = make(map[string]string, len(data)+1)
+		for k, v := range data {
+			filter[k] = v
+		}
+		filter[Param_ExcludeAddr] = strings.Join(exclude, ",")
+	}
+	ctx = BuildCtxFilter(ctx, filter)
+
+	if record == nil {
+		record = &pickRecord{}
+	}
+	ctx = withPickRecord(ctx, record)
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// 下级服务调用Span, traceparent通过metadata传递
+	ctx, span := Tracing.Start(ctx, "CallService "+GateWayProtos.CmdType(cmd).String(), Tracing.SpanKind_Client)
+	defer span.End()
+	Tracing.Inject(ctx, func(key string, value string) {
+		ctx = metadata.AppendToOutgoingContext(ctx, key, value)
+	})
+
+	st := time.Now()
+	var p peer.Peer
+	resp, err := client.client.CallService(ctx,
 		&GateWayProtos.UnifiedRequest{
 			Cmd:     cmd,
 			Request: request,
 		},
-	); err != nil {
-		return []byte(""), int32(GateWayProtos.ResultType_ERR_Call_Service), err
-	} else {
-		return resp.Response, resp.Result, nil
+		grpc.Peer(&p),
+	)
+
+	r := &attemptResult{
+		err:  err,
+		addr: record.get(),
+	}
+	if err != nil {
+		r.pickErr = record.getErr()
 	}
+	if r.addr == "" && p.Addr != nil {
+		r.addr = p.Addr.String()
+	}
+	if resp != nil {
+		r.response = resp.Response
+		r.result = resp.Result
+	}
+
+	span.SetAttributes(
+		Tracing.Attribute{Key: "rpc.system", Value: "grpc"},
+		Tracing.Attribute{Key: "rpc.service", Value: client.serviceName},
+		Tracing.Attribute{Key: "gateway.cmd", Value: cmd},
+		Tracing.Attribute{Key: "gateway.result", Value: r.result},
+		Tracing.Attribute{Key: "net.peer.name", Value: r.addr},
+		Tracing.Attribute{Key: "rpc.grpc.status_code", Value: int(status.Code(err))},
+	)
+	if err != nil {
+		span.SetError(err)
+	} else if r.result != int32(GateWayProtos.ResultType_OK) {
+		span.SetStatus(false, GateWayProtos.ResultType(r.result).String())
+	}
+
+	// 记录结点调用结果, 用于熔断; 调用方取消的请求不计入
+	if r.addr != "" && status.Code(err) != codes.Canceled {
+		breakerRecord(r.addr, !isBreakerFailure(err, r.result))
+	}
+	// 记录成功请求耗时, 用于计算对冲请求延迟
+	if err == nil && r.result == int32(GateWayProtos.ResultType_OK) {
+		getLatencyTracker(cmd).record(time.Since(st))
+	}
+	return r
+}
+
+// callWithRetry 按重试策略发送请求, 重试时排除已失败的结点, 全部请求受调用方超时限制
+func (client *unifiedClient) callWithRetry(
+	ctx context.Context,
+	cmd int32,
+	request []byte,
+	data map[string]string,
+	policy *retryPolicy,
+) *attemptResult {
+	var exclude []string
+	var last *attemptResult
+	attempts := 0
+	for {
+		r, sent, addrs := client.hedgedAttempt(ctx, cmd, request, data, exclude, policy, policy.maxAttempts-attempts)
+		attempts += sent
+
+		// 排除失败结点后没有可用结点, 返回上次的失败结果
+		if last != nil && r.noServer() {
+			return last
+		}
+		last = r
+		if !policy.shouldRetry(r) || attempts >= policy.maxAttempts || ctx.Err() != nil {
+			return r
+		}
+		exclude = append(exclude, addrs...)
+
+		if policy.backoff > 0 {
+			timer := time.NewTimer(policy.backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return r
+			case <-timer.C:
+			}
+		}
+		Metrics.UpstreamRetries.WithLabelValues(Metrics.CmdLabel(cmd), "retry").Inc()
+	}
+}
+
+// hedgedAttempt 发送请求, 超过对冲延迟未返回时向其他结点发送对冲请求, 取先成功的结果
+// 返回请求结果, 发送的请求数, 以及请求的结点地址
+func (client *unifiedClient) hedgedAttempt(
+	ctx context.Context,
+	cmd int32,
+	request []byte,
+	data map[string]string,
+	exclude []string,
+	policy *retryPolicy,
+	remaining int,
+) (*attemptResult, int, []string) {
+	addrsOf := func(list ...*attemptResult) []string {
+		var addrs []string
+		for _, r := range list {
+			if r.addr != "" {
+				addrs = append(addrs, r.addr)
+			}
+		}
+		return addrs
+	}
+
+	var delay time.Duration
+	if remaining >= 2 {
+		delay = policy.getHedgeDelay(cmd)
+	}
+	if delay == 0 {
+		r := client.attempt(ctx, cmd, request, data, exclude, policy.attemptTimeout, nil)
+		return r, 1, addrsOf(r)
+	}
+
+	// 先返回的请求取消另一个请求
+	hedgeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan *attemptResult, 2)
+	primary := &pickRecord{}
+	go func() {
+		results <- client.attempt(hedgeCtx, cmd, request, data, exclude, policy.attemptTimeout, primary)
+	}()
+
+	timer := time.NewTimer(delay)
+	select {
+	case r := <-results:
+		timer.Stop()
+		return r, 1, addrsOf(r)
+	case <-ctx.Done():
+		timer.Stop()
+		r := <-results
+		return r, 1, addrsOf(r)
+	case <-timer.C:
+	}
+
+	// 对冲请求排除首次请求的结点
+	hedgeExclude := exclude[:len(exclude):len(exclude)]
+	if addr := primary.get(); addr != "" {
+		hedgeExclude = append(hedgeExclude, addr)
+	}
+	go func() {
+		results <- client.attempt(hedgeCtx, cmd, request, data, hedgeExclude, policy.attemptTimeout, nil)
+	}()
+	Metrics.UpstreamRetries.WithLabelValues(Metrics.CmdLabel(cmd), "hedge").Inc()
+
+	var first *attemptResult
+	var all []*attemptResult
+	for i := 0; i < 2; i++ {
+		r := <-results
+		all = append(all, r)
+		if !r.noServer() && !policy.shouldRetry(r) {
+			return r, 2, addrsOf(all...)
+		}
+		// 优先返回有结点的失败结果
+		if first == nil || first.noServer() {
+			first = r
+		}
+	}
+	return first, 2, addrsOf(all...)
 }
 
 func (client *unifiedClient) updateAddr(
@@ -126,6 +396,15 @@ func (client *unifiedClient) updateAddr(
 		Addr:        serviceInfo.Addr,
 		Semver:      serviceInfo.Semver,
 		Status:      serviceInfo.Status,
+		GroupTab:    serviceInfo.GroupTab,
+	}
+
+	// 本地覆盖: 强制下线/固定在线, 忽略注册中心下发的状态
+	switch getOverrideAction(serviceInfo.ServiceType, serviceInfo.Addr) {
+	case OverrideAction_Offline:
+		rn.Status = int32(GateWayProtos.ServiceStatus_Offline)
+	case OverrideAction_Pin:
+		rn.Status = int32(GateWayProtos.ServiceStatus_Online)
 	}
 
 	// 服务信息写回map
@@ -146,7 +425,7 @@ func (client *unifiedClient) updateAddr(
 		weight = 32
 	}
 
-	if serviceInfo.Status == int32(GateWayProtos.ServiceStatus_Online) &&
+	if rn.Status == int32(GateWayProtos.ServiceStatus_Online) &&
 		client.checkVersion(serviceInfo.Semver) {
 		client.serviceResolver.setAddr(addr, weight)
 		for idx := 0; idx < weight; idx++ {
@@ -156,6 +435,9 @@ func (client *unifiedClient) updateAddr(
 		client.serviceResolver.delAddr(addr)
 	}
 	client.serviceResolver.update()
+
+	Metrics.RegCenterResolvedAddrs.WithLabelValues(client.serviceName).
+		Set(float64(client.serviceResolver.addrCount()))
 	return nil
 }
 
@@ -197,12 +479,23 @@ func (client *unifiedClient) getWatchServiceInfo() *GateWayProtos.WatchServiceIn
 
 	client.rwlock.RLock()
 	defer client.rwlock.RUnlock()
-	for _, info := range client.si_map {
+	for addr, info := range client.si_map {
+		// 服务发现的结点不是注册中心下发的, 不上报
+		if client.ds_map[addr] {
+			continue
+		}
 		watchServiceInfo.ServiceList = append(watchServiceInfo.ServiceList, info)
 	}
 	return watchServiceInfo
 }
 
+// setDiscovered 记录服务发现下发的结点地址
+func (client *unifiedClient) setDiscovered(addr string) {
+	client.rwlock.Lock()
+	client.ds_map[addr] = true
+	client.rwlock.Unlock()
+}
+
 func (client *unifiedClient) Build(
 	target resolver.Target,
 	cc resolver.ClientConn,
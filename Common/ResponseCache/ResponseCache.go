@@ -0,0 +1,248 @@
+package ResponseCache
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// 缓存状态
+const (
+	Status_Hit   = "hit"   // 命中
+	Status_Miss  = "miss"  // 未命中, 请求下级服务
+	Status_Stale = "stale" // 命中过期数据, 后台刷新
+)
+
+const (
+	default_max_entries  = 10000
+	default_load_timeout = 3 * time.Second
+)
+
+// Config 缓存配置
+type Config struct {
+	TTL        int64 // 缓存有效期, 单位ms
+	StaleTTL   int64 // 过期后仍可返回旧数据的时长, 单位ms; 0为不启用 stale-while-revalidate
+	MaxEntries int   // 最大缓存条数, 不填默认10000
+	MaxBytes   int64 // 最大缓存字节数, 0为不限制
+}
+
+// LoadFunc 请求下级服务
+type LoadFunc func(ctx context.Context) ([]byte, int32, error)
+
+type entry struct {
+	key      string
+	response []byte
+	result   int32
+	expireAt time.Time // 过期时间
+	staleAt  time.Time // 超过该时间不再返回旧数据
+}
+
+// call 正在请求下级服务的调用, 相同Key的并发请求共用结果
+type call struct {
+	done     chan struct{}
+	response []byte
+	result   int32
+	err      error
+}
+
+// Cache LRU缓存, 只缓存下级服务返回OK的结果
+type Cache struct {
+	conf        Config
+	ttl         time.Duration
+	staleTTL    time.Duration
+	loadTimeout time.Duration
+
+	mu        sync.Mutex
+	ll        *list.List               // 最近使用的在前
+	items     map[string]*list.Element // key->entry
+	bytes     int64
+	calls     map[string]*call // key->正在进行的调用
+	refreshes map[string]bool  // key->正在后台刷新
+}
+
+// New 创建缓存, loadTimeout为调用load的超时时间(0为默认3s)
+func New(conf Config, loadTimeout time.Duration) *Cache {
+	if conf.MaxEntries <= 0 {
+		conf.MaxEntries = default_max_entries
+	}
+	if loadTimeout <= 0 {
+		loadTimeout = default_load_timeout
+	}
+	return &Cache{
+		conf:        conf,
+		ttl:         time.Duration(conf.TTL) * time.Millisecond,
+		staleTTL:    time.Duration(conf.StaleTTL) * time.Millisecond,
+		loadTimeout: loadTimeout,
+		ll:          list.New(),
+		items:       make(map[string]*list.Element),
+		calls:       make(map[string]*call),
+		refreshes:   make(map[string]bool),
+	}
+}
+
+// Get 获取缓存, 未命中时调用load并写入缓存, 返回缓存状态
+//	命中过期数据且在StaleTTL内时, 直接返回旧数据并在后台刷新
+func (c *Cache) Get(
+	ctx context.Context,
+	key string,
+	load LoadFunc,
+) ([]byte, int32, string, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry)
+		if now.Before(e.expireAt) {
+			c.ll.MoveToFront(elem)
+			c.mu.Unlock()
+			return e.response, e.result, Status_Hit, nil
+		}
+		if now.Before(e.staleAt) {
+			c.ll.MoveToFront(elem)
+			if !c.refreshes[key] {
+				c.refreshes[key] = true
+				go c.refresh(ctx, key, load)
+			}
+			c.mu.Unlock()
+			return e.response, e.result, Status_Stale, nil
+		}
+		c.removeElement(elem)
+	}
+	c.mu.Unlock()
+
+	response, result, err := c.do(ctx, key, load)
+	return response, result, Status_Miss, err
+}
+
+// do 相同Key的并发请求只调用一次load
+//	load使用脱离请求的ctx(保留ctx中的值, 超时为loadTimeout), 不受发起请求的取消及超时影响;
+//	每个请求只等待到自己的ctx结束
+func (c *Cache) do(
+	ctx context.Context,
+	key string,
+	load LoadFunc,
+) ([]byte, int32, error) {
+	c.mu.Lock()
+	cl, ok := c.calls[key]
+	if !ok {
+		cl = &call{done: make(chan struct{})}
+		c.calls[key] = cl
+		go c.load(detach(ctx), key, cl, load)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-cl.done:
+		return cl.response, cl.result, cl.err
+	case <-ctx.Done():
+		return nil, int32(GateWayProtos.ResultType_ERR_Call_Service), ctx.Err()
+	}
+}
+
+// load 调用load并写入缓存, 完成后通知全部等待的请求
+func (c *Cache) load(
+	ctx context.Context,
+	key string,
+	cl *call,
+	load LoadFunc,
+) {
+	ctx, cancel := context.WithTimeout(ctx, c.loadTimeout)
+	defer cancel()
+
+	cl.response, cl.result, cl.err = load(ctx)
+	c.mu.Lock()
+	if cl.err == nil && cl.result == int32(GateWayProtos.ResultType_OK) {
+		c.set(key, cl.response, cl.result)
+	}
+	delete(c.calls, key)
+	c.mu.Unlock()
+	close(cl.done)
+}
+
+// refresh 后台刷新, 不受原请求取消的影响
+//	load通过IsRefresh判断是否为后台刷新, 为刷新请求生成新的请求ID及链路
+func (c *Cache) refresh(
+	ctx context.Context,
+	key string,
+	load LoadFunc,
+) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.refreshes, key)
+		c.mu.Unlock()
+	}()
+
+	c.do(context.WithValue(detach(ctx), ctxKeyRefresh, true), key, load)
+}
+
+type ctxKey int
+
+const ctxKeyRefresh ctxKey = 0
+
+// IsRefresh load是否为命中过期数据后的后台刷新
+func IsRefresh(ctx context.Context) bool {
+	refresh, _ := ctx.Value(ctxKeyRefresh).(bool)
+	return refresh
+}
+
+// need c.mu.Lock() before calling
+func (c *Cache) set(key string, response []byte, result int32) {
+	now := time.Now()
+	e := &entry{
+		key:      key,
+		response: response,
+		result:   result,
+		expireAt: now.Add(c.ttl),
+		staleAt:  now.Add(c.ttl + c.staleTTL),
+	}
+	if elem, ok := c.items[key]; ok {
+		c.bytes -= entrySize(elem.Value.(*entry))
+		elem.Value = e
+		c.ll.MoveToFront(elem)
+	} else {
+		c.items[key] = c.ll.PushFront(e)
+	}
+	c.bytes += entrySize(e)
+
+	// 超出大小限制, 淘汰最久未使用的缓存
+	for c.ll.Len() > c.conf.MaxEntries ||
+		(c.conf.MaxBytes > 0 && c.bytes > c.conf.MaxBytes && c.ll.Len() > 0) {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// need c.mu.Lock() before calling
+func (c *Cache) removeElement(elem *list.Element) {
+	e := elem.Value.(*entry)
+	c.ll.Remove(elem)
+	delete(c.items, e.key)
+	c.bytes -= entrySize(e)
+}
+
+func entrySize(e *entry) int64 {
+	return int64(len(e.key) + len(e.response))
+}
+
+// Len 缓存条数
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// detachedContext 保留ctx中的值, 但不继承取消及超时
+type detachedContext struct {
+	parent context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
@@ -0,0 +1,53 @@
+package TokenAuth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const Header_APIKey = "X-Api-Key"
+
+// APIKeyConfig 静态API Key
+type APIKeyConfig struct {
+	Name   string   // 调用方名称
+	Key    string   // API Key
+	Scopes []string // 可访问的Scope, 为空则不限制
+}
+
+func buildAPIKeys(confList []APIKeyConfig) (map[string]*Identity, error) {
+	apiKeys := make(map[string]*Identity, len(confList))
+	for _, conf := range confList {
+		if conf.Key == "" {
+			return nil, errors.New("api key empty, name = " + conf.Name)
+		}
+		// 使用Key的摘要作为map key, 避免按Key查找时的时间差异泄露Key
+		sum := sha256.Sum256([]byte(conf.Key))
+		if _, ok := apiKeys[string(sum[:])]; ok {
+			return nil, errors.New("api key repeated, name = " + conf.Name)
+		}
+		apiKeys[string(sum[:])] = &Identity{
+			Type:   "api_key",
+			Name:   conf.Name,
+			Scopes: newScopes(conf.Scopes),
+		}
+	}
+	return apiKeys, nil
+}
+
+// CheckAPIKey 校验请求Header中的API Key
+//	X-Api-Key: <key>
+func CheckAPIKey(r *http.Request) (*Identity, error) {
+	key := strings.TrimSpace(r.Header.Get(Header_APIKey))
+	if key == "" {
+		return nil, ErrTokenMissing
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	identity, ok := getChecker().apiKeys[string(sum[:])]
+	if !ok {
+		return nil, ErrTokenInvalid
+	}
+	return identity, nil
+}
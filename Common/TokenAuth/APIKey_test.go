@@ -0,0 +1,78 @@
+package TokenAuth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckAPIKey(t *testing.T) {
+	c, err := Build(Config{
+		APIKeys: []APIKeyConfig{
+			{Name: "app", Key: "key-app", Scopes: []string{"download"}},
+			{Name: "all", Key: "key-all"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Store(c)
+	defer Store(&Checker{})
+
+	tests := []struct {
+		name     string
+		key      string
+		wantErr  error
+		wantName string
+		scope    string
+		allow    bool
+	}{
+		{name: "missing", key: "", wantErr: ErrTokenMissing},
+		{name: "blank", key: "   ", wantErr: ErrTokenMissing},
+		{name: "wrong key", key: "key-other", wantErr: ErrTokenInvalid},
+		{name: "prefix of key", key: "key-ap", wantErr: ErrTokenInvalid},
+		{name: "valid", key: "key-app", wantName: "app", scope: "download", allow: true},
+		{name: "valid trim", key: " key-app ", wantName: "app", scope: "download", allow: true},
+		{name: "scope denied", key: "key-app", wantName: "app", scope: "admin", allow: false},
+		{name: "no scope limit", key: "key-all", wantName: "all", scope: "admin", allow: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api", nil)
+			if tt.key != "" {
+				r.Header.Set(Header_APIKey, tt.key)
+			}
+			identity, err := CheckAPIKey(r)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if identity.Type != "api_key" || identity.Name != tt.wantName {
+				t.Fatalf("identity = %+v, want name %s", identity, tt.wantName)
+			}
+			if identity.Allow(tt.scope) != tt.allow {
+				t.Fatalf("Allow(%s) = %v, want %v", tt.scope, !tt.allow, tt.allow)
+			}
+		})
+	}
+}
+
+func TestBuildAPIKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    []APIKeyConfig
+		wantErr bool
+	}{
+		{name: "empty key", conf: []APIKeyConfig{{Name: "a"}}, wantErr: true},
+		{name: "repeated key", conf: []APIKeyConfig{{Name: "a", Key: "k"}, {Name: "b", Key: "k"}}, wantErr: true},
+		{name: "valid", conf: []APIKeyConfig{{Name: "a", Key: "k1"}, {Name: "b", Key: "k2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := buildAPIKeys(tt.conf); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package TokenAuth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Header_AppId     = "X-App-Id"
+	Header_Timestamp = "X-Timestamp"
+	Header_Nonce     = "X-Nonce"
+	Header_Signature = "X-Signature"
+
+	default_hmac_skew = 300 // 默认时间戳允许误差, 单位s
+	max_nonce_len     = 64
+)
+
+// HMACConfig HMAC签名配置
+//	签名串: METHOD\nPATH\nRAW_QUERY\nTIMESTAMP\nNONCE\nhex(sha256(BODY))
+//	签名:   hex(hmac_sha256(secret, 签名串))
+type HMACConfig struct {
+	MaxSkew int64           // 时间戳允许误差, 单位s, 不填默认300s
+	Apps    []HMACAppConfig // 调用方
+}
+
+// HMACAppConfig HMAC调用方
+type HMACAppConfig struct {
+	AppId  string   // 调用方ID
+	Secret string   // 签名密钥
+	Scopes []string // 可访问的Scope, 为空则不限制
+}
+
+type hmacApp struct {
+	secret   []byte
+	identity *Identity
+}
+
+func buildHMAC(conf HMACConfig) (map[string]*hmacApp, int64, error) {
+	skew := conf.MaxSkew
+	if skew < 0 {
+		return nil, 0, errors.New("hmac max skew invalid")
+	}
+	if skew == 0 {
+		skew = default_hmac_skew
+	}
+
+	apps := make(map[string]*hmacApp, len(conf.Apps))
+	for _, app := range conf.Apps {
+		if app.AppId == "" || app.Secret == "" {
+			return nil, 0, errors.New("hmac app_id or secret empty, app_id = " + app.AppId)
+		}
+		if _, ok := apps[app.AppId]; ok {
+			return nil, 0, errors.New("hmac app_id repeated, app_id = " + app.AppId)
+		}
+		apps[app.AppId] = &hmacApp{
+			secret: []byte(app.Secret),
+			identity: &Identity{
+				Type:   "hmac",
+				Name:   app.AppId,
+				Scopes: newScopes(app.Scopes),
+			},
+		}
+	}
+	return apps, skew, nil
+}
+
+// HMACSign 计算请求签名, 调用方可使用相同算法生成签名
+func HMACSign(
+	secret []byte,
+	method string,
+	path string,
+	rawQuery string,
+	timestamp string,
+	nonce string,
+	body []byte,
+) string {
+	bodySum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{
+		method,
+		path,
+		rawQuery,
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodySum[:]),
+	}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckHMAC 校验请求签名, 同一app_id的nonce在有效期内只能使用一次
+func CheckHMAC(r *http.Request, body []byte) (*Identity, error) {
+	appId := r.Header.Get(Header_AppId)
+	timestamp := r.Header.Get(Header_Timestamp)
+	nonce := r.Header.Get(Header_Nonce)
+	signature := r.Header.Get(Header_Signature)
+	if appId == "" || timestamp == "" || nonce == "" || signature == "" {
+		return nil, ErrTokenMissing
+	}
+	if len(nonce) > max_nonce_len {
+		return nil, errors.New("hmac nonce too long")
+	}
+
+	c := getChecker()
+	app, ok := c.hmacApps[appId]
+	if !ok {
+		return nil, ErrTokenInvalid
+	}
+
+	// 时间戳校验
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("hmac timestamp invalid")
+	}
+	now := time.Now().Unix()
+	if ts < now-c.hmacSkew || ts > now+c.hmacSkew {
+		return nil, errors.New("hmac timestamp expired")
+	}
+
+	// 签名校验
+	expected := HMACSign(app.secret, r.Method, r.URL.Path, r.URL.RawQuery, timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return nil, ErrTokenInvalid
+	}
+
+	// 防重放: 签名通过后才记录nonce, nonce有效期覆盖时间戳误差范围
+	if !nonces.add(appId+"\n"+nonce, ts+c.hmacSkew) {
+		return nil, errors.New("hmac nonce replayed")
+	}
+	return app.identity, nil
+}
+
+// nonceCache 已使用的nonce, 按nonce哈希分片, 分片内按过期时间分桶
+//	过期清理时整桶删除, 不遍历nonce
+type nonceCache struct {
+	shards [nonce_shards]nonceShard
+}
+
+type nonceShard struct {
+	mu      sync.Mutex
+	buckets map[int64]map[string]struct{} // 过期时间/nonce_bucket_seconds->nonce集合
+}
+
+const (
+	nonce_shards         = 32 // 分片数量
+	nonce_bucket_seconds = 60 // 每个桶覆盖的过期时间范围, 单位s
+)
+
+var nonces = &nonceCache{}
+
+// add 记录nonce, 已存在且未过期返回false
+func (nc *nonceCache) add(nonce string, expire int64) bool {
+	h := fnv.New32a()
+	h.Write([]byte(nonce))
+	return nc.shards[h.Sum32()%nonce_shards].add(nonce, expire, time.Now().Unix())
+}
+
+// add 整桶过期后才删除, 桶内已过期的nonce仍视为已使用; 此时时间戳校验已先失败, 不影响正常请求
+func (shard *nonceShard) add(nonce string, expire int64, now int64) bool {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if shard.buckets == nil {
+		shard.buckets = make(map[int64]map[string]struct{})
+	}
+	current := now / nonce_bucket_seconds
+	for idx, bucket := range shard.buckets {
+		if idx < current {
+			delete(shard.buckets, idx)
+			continue
+		}
+		if _, ok := bucket[nonce]; ok {
+			return false
+		}
+	}
+
+	idx := expire / nonce_bucket_seconds
+	bucket, ok := shard.buckets[idx]
+	if !ok {
+		bucket = make(map[string]struct{})
+		shard.buckets[idx] = bucket
+	}
+	bucket[nonce] = struct{}{}
+	return true
+}
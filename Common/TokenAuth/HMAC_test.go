@@ -0,0 +1,229 @@
+package TokenAuth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newHMACRequest(
+	secret string,
+	appId string,
+	timestamp int64,
+	nonce string,
+	body string,
+) (*http.Request, []byte) {
+	r := httptest.NewRequest("POST", "/api/v1/web/download/?user_id=1", strings.NewReader(body))
+	ts := strconv.FormatInt(timestamp, 10)
+	r.Header.Set(Header_AppId, appId)
+	r.Header.Set(Header_Timestamp, ts)
+	r.Header.Set(Header_Nonce, nonce)
+	r.Header.Set(Header_Signature, HMACSign([]byte(secret), r.Method, r.URL.Path, r.URL.RawQuery, ts, nonce, []byte(body)))
+	return r, []byte(body)
+}
+
+func TestCheckHMAC(t *testing.T) {
+	c, err := Build(Config{
+		HMAC: HMACConfig{
+			MaxSkew: 60,
+			Apps:    []HMACAppConfig{{AppId: "app", Secret: "secret", Scopes: []string{"download"}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Store(c)
+	defer Store(&Checker{})
+
+	now := time.Now().Unix()
+	prefix := strconv.FormatInt(time.Now().UnixNano(), 10) + "-"
+	tests := []struct {
+		name    string
+		build   func() (*http.Request, []byte)
+		wantErr string
+	}{
+		{
+			name: "valid",
+			build: func() (*http.Request, []byte) {
+				return newHMACRequest("secret", "app", now, prefix+"valid", `{"user_id":1}`)
+			},
+		},
+		{
+			name: "upper case signature",
+			build: func() (*http.Request, []byte) {
+				r, body := newHMACRequest("secret", "app", now, prefix+"upper", "")
+				r.Header.Set(Header_Signature, strings.ToUpper(r.Header.Get(Header_Signature)))
+				return r, body
+			},
+		},
+		{
+			name: "missing header",
+			build: func() (*http.Request, []byte) {
+				r, body := newHMACRequest("secret", "app", now, prefix+"missing", "")
+				r.Header.Del(Header_Signature)
+				return r, body
+			},
+			wantErr: ErrTokenMissing.Error(),
+		},
+		{
+			name: "unknown app",
+			build: func() (*http.Request, []byte) {
+				return newHMACRequest("secret", "other", now, prefix+"unknown", "")
+			},
+			wantErr: ErrTokenInvalid.Error(),
+		},
+		{
+			name: "wrong secret",
+			build: func() (*http.Request, []byte) {
+				return newHMACRequest("wrong", "app", now, prefix+"secret", "")
+			},
+			wantErr: ErrTokenInvalid.Error(),
+		},
+		{
+			name: "body tampered",
+			build: func() (*http.Request, []byte) {
+				r, _ := newHMACRequest("secret", "app", now, prefix+"body", `{"user_id":1}`)
+				return r, []byte(`{"user_id":2}`)
+			},
+			wantErr: ErrTokenInvalid.Error(),
+		},
+		{
+			name: "query tampered",
+			build: func() (*http.Request, []byte) {
+				r, body := newHMACRequest("secret", "app", now, prefix+"query", "")
+				r.URL.RawQuery = "user_id=2"
+				return r, body
+			},
+			wantErr: ErrTokenInvalid.Error(),
+		},
+		{
+			name: "timestamp too old",
+			build: func() (*http.Request, []byte) {
+				return newHMACRequest("secret", "app", now-120, prefix+"old", "")
+			},
+			wantErr: "hmac timestamp expired",
+		},
+		{
+			name: "timestamp in future",
+			build: func() (*http.Request, []byte) {
+				return newHMACRequest("secret", "app", now+120, prefix+"future", "")
+			},
+			wantErr: "hmac timestamp expired",
+		},
+		{
+			name: "timestamp invalid",
+			build: func() (*http.Request, []byte) {
+				r, body := newHMACRequest("secret", "app", now, prefix+"ts", "")
+				r.Header.Set(Header_Timestamp, "abc")
+				return r, body
+			},
+			wantErr: "hmac timestamp invalid",
+		},
+		{
+			name: "nonce too long",
+			build: func() (*http.Request, []byte) {
+				return newHMACRequest("secret", "app", now, strings.Repeat("n", max_nonce_len+1), "")
+			},
+			wantErr: "hmac nonce too long",
+		},
+		{
+			name: "nonce replayed",
+			build: func() (*http.Request, []byte) {
+				return newHMACRequest("secret", "app", now, prefix+"valid", `{"user_id":1}`)
+			},
+			wantErr: "hmac nonce replayed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, body := tt.build()
+			identity, err := CheckHMAC(r, body)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.Type != "hmac" || identity.Name != "app" || !identity.Allow("download") || identity.Allow("admin") {
+				t.Fatalf("identity = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestHMACNonceNotRecordedOnBadSignature(t *testing.T) {
+	c, err := Build(Config{HMAC: HMACConfig{Apps: []HMACAppConfig{{AppId: "app", Secret: "secret"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Store(c)
+	defer Store(&Checker{})
+
+	now := time.Now().Unix()
+	nonce := "bad-sign-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	r, body := newHMACRequest("wrong", "app", now, nonce, "")
+	if _, err := CheckHMAC(r, body); err != ErrTokenInvalid {
+		t.Fatalf("err = %v, want %v", err, ErrTokenInvalid)
+	}
+	// 签名错误的请求不能占用nonce
+	r, body = newHMACRequest("secret", "app", now, nonce, "")
+	if _, err := CheckHMAC(r, body); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNonceShard(t *testing.T) {
+	shard := &nonceShard{}
+	now := int64(1000 * nonce_bucket_seconds)
+
+	if !shard.add("a", now+300, now) {
+		t.Fatal("first add should succeed")
+	}
+	if shard.add("a", now+300, now+10) {
+		t.Fatal("replayed nonce should be rejected")
+	}
+	if !shard.add("b", now+30, now) {
+		t.Fatal("other nonce should succeed")
+	}
+
+	// 整桶过期后删除, 同一nonce可以再次使用
+	later := now + 400 + nonce_bucket_seconds
+	if !shard.add("a", later+300, later) {
+		t.Fatal("expired nonce should be accepted again")
+	}
+	if len(shard.buckets) != 1 {
+		t.Fatalf("expired buckets not dropped, buckets = %d", len(shard.buckets))
+	}
+}
+
+func TestBuildHMAC(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     HMACConfig
+		wantErr  bool
+		wantSkew int64
+	}{
+		{name: "default skew", conf: HMACConfig{}, wantSkew: default_hmac_skew},
+		{name: "negative skew", conf: HMACConfig{MaxSkew: -1}, wantErr: true},
+		{name: "empty secret", conf: HMACConfig{Apps: []HMACAppConfig{{AppId: "a"}}}, wantErr: true},
+		{name: "repeated app", conf: HMACConfig{Apps: []HMACAppConfig{{AppId: "a", Secret: "s"}, {AppId: "a", Secret: "t"}}}, wantErr: true},
+		{name: "valid", conf: HMACConfig{MaxSkew: 10, Apps: []HMACAppConfig{{AppId: "a", Secret: "s"}}}, wantSkew: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, skew, err := buildHMAC(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && skew != tt.wantSkew {
+				t.Fatalf("skew = %d, want %d", skew, tt.wantSkew)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package TokenAuth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// JWTConfig JWT校验配置, 密钥由本地配置, 不支持远程获取
+type JWTConfig struct {
+	Issuer     string         // 签发方, 为空则不校验iss
+	Audience   string         // 接收方, 为空则不校验aud
+	Leeway     int64          // exp/nbf允许误差, 单位s
+	AllowNoExp bool           // 是否接受无exp的JWT, 默认拒绝
+	Keys       []JWTKeyConfig // 验签密钥
+}
+
+// JWTKeyConfig JWT验签密钥
+type JWTKeyConfig struct {
+	Kid           string // 密钥ID, 与JWT Header中的kid匹配, 为空则匹配无kid的JWT
+	Alg           string // 算法: HS256/HS384/HS512/RS256/RS384/RS512/ES256/ES384/ES512
+	Secret        string // HS*算法密钥
+	PublicKeyFile string // RS*/ES*算法公钥文件(PEM)
+}
+
+type jwtKey struct {
+	kid  string
+	alg  string
+	hash crypto.Hash
+	key  interface{} // []byte/*rsa.PublicKey/*ecdsa.PublicKey
+}
+
+type jwtChecker struct {
+	issuer     string
+	audience   string
+	leeway     int64
+	allowNoExp bool
+	keys       []*jwtKey
+}
+
+var jwtHashMap = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+func buildJWT(conf JWTConfig) (*jwtChecker, error) {
+	if conf.Leeway < 0 {
+		return nil, errors.New("jwt leeway invalid")
+	}
+	jc := &jwtChecker{
+		issuer:     conf.Issuer,
+		audience:   conf.Audience,
+		leeway:     conf.Leeway,
+		allowNoExp: conf.AllowNoExp,
+	}
+	for _, keyConf := range conf.Keys {
+		key, err := buildJWTKey(keyConf)
+		if err != nil {
+			return nil, err
+		}
+		jc.keys = append(jc.keys, key)
+	}
+	return jc, nil
+}
+
+func buildJWTKey(conf JWTKeyConfig) (*jwtKey, error) {
+	if len(conf.Alg) != 5 {
+		return nil, errors.New("jwt alg not support, alg = " + conf.Alg)
+	}
+	hash, ok := jwtHashMap[conf.Alg[2:]]
+	if !ok {
+		return nil, errors.New("jwt alg not support, alg = " + conf.Alg)
+	}
+	key := &jwtKey{
+		kid:  conf.Kid,
+		alg:  conf.Alg,
+		hash: hash,
+	}
+
+	switch conf.Alg[:2] {
+	case "HS":
+		if conf.Secret == "" {
+			return nil, errors.New("jwt secret empty, kid = " + conf.Kid)
+		}
+		key.key = []byte(conf.Secret)
+	case "RS", "ES":
+		pub, err := loadPublicKey(conf.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		switch pub.(type) {
+		case *rsa.PublicKey:
+			if conf.Alg[:2] != "RS" {
+				return nil, errors.New("jwt public key type mismatch, kid = " + conf.Kid)
+			}
+		case *ecdsa.PublicKey:
+			if conf.Alg[:2] != "ES" {
+				return nil, errors.New("jwt public key type mismatch, kid = " + conf.Kid)
+			}
+		default:
+			return nil, errors.New("jwt public key type not support, kid = " + conf.Kid)
+		}
+		key.key = pub
+	default:
+		return nil, errors.New("jwt alg not support, alg = " + conf.Alg)
+	}
+	return key, nil
+}
+
+// loadPublicKey 从PEM文件加载公钥, 支持 PUBLIC KEY 与 CERTIFICATE
+func loadPublicKey(fileName string) (interface{}, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("jwt public key pem decode failed, file = " + fileName)
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Iss   string          `json:"iss"`
+	Sub   string          `json:"sub"`
+	Aud   json.RawMessage `json:"aud"`   // string 或 []string
+	Exp   *float64        `json:"exp"`   // 过期时间
+	Nbf   *float64        `json:"nbf"`   // 生效时间
+	Scope string          `json:"scope"` // 空格分隔的Scope
+	Scp   []string        `json:"scp"`   // Scope列表
+}
+
+// CheckJWT 校验请求Header中的JWT
+//	Authorization: Bearer <jwt>
+func CheckJWT(r *http.Request) (*Identity, error) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return nil, ErrTokenMissing
+	}
+	token := strings.TrimSpace(auth[7:])
+
+	jc := getChecker().jwt
+	if jc == nil || len(jc.keys) == 0 {
+		return nil, ErrTokenInvalid
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenInvalid
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	// 算法以本地配置为准, 不信任JWT Header中的alg(防止alg=none或算法混淆)
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range jc.keys {
+		if key.kid != header.Kid || key.alg != header.Alg {
+			continue
+		}
+		if key.verify(signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrTokenInvalid
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if err := jc.checkClaims(&claims); err != nil {
+		return nil, err
+	}
+
+	scopeList := strings.Fields(claims.Scope)
+	scopeList = append(scopeList, claims.Scp...)
+	return &Identity{
+		Type:   "jwt",
+		Name:   claims.Sub,
+		Scopes: newScopes(scopeList),
+	}, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (key *jwtKey) verify(signed []byte, signature []byte) bool {
+	h := key.hash.New()
+	switch k := key.key.(type) {
+	case []byte:
+		mac := hmac.New(key.hash.New, k)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case *rsa.PublicKey:
+		h.Write(signed)
+		return rsa.VerifyPKCS1v15(k, key.hash, h.Sum(nil), signature) == nil
+	case *ecdsa.PublicKey:
+		// ES* 签名为定长 r||s
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		h.Write(signed)
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(k, h.Sum(nil), r, s)
+	default:
+		return false
+	}
+}
+
+func (jc *jwtChecker) checkClaims(claims *jwtClaims) error {
+	now := float64(time.Now().Unix())
+	leeway := float64(jc.leeway)
+	if claims.Exp == nil {
+		// 无exp的JWT永久有效, 需显式配置才接受
+		if !jc.allowNoExp {
+			return errors.New("jwt exp missing")
+		}
+	} else if now > *claims.Exp+leeway {
+		return errors.New("jwt expired")
+	}
+	if claims.Nbf != nil && now < *claims.Nbf-leeway {
+		return errors.New("jwt not valid yet")
+	}
+	if jc.issuer != "" && claims.Iss != jc.issuer {
+		return errors.New("jwt issuer invalid")
+	}
+	if jc.audience != "" && !audienceContains(claims.Aud, jc.audience) {
+		return errors.New("jwt audience invalid")
+	}
+	return nil
+}
+
+func audienceContains(raw json.RawMessage, audience string) bool {
+	if len(raw) == 0 {
+		return false
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == audience
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		for _, aud := range list {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
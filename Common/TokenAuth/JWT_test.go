@@ -0,0 +1,279 @@
+package TokenAuth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// signJWT 按alg生成JWT, key为[]byte/*rsa.PrivateKey/*ecdsa.PrivateKey
+func signJWT(t *testing.T, alg string, kid string, claims map[string]interface{}, key interface{}) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	headerJson, _ := json.Marshal(header)
+	claimsJson, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(headerJson) + "." + base64.RawURLEncoding.EncodeToString(claimsJson)
+
+	var signature []byte
+	switch k := key.(type) {
+	case nil:
+	case []byte:
+		mac := hmac.New(jwtHashMap[alg[2:]].New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		h := jwtHashMap[alg[2:]].New()
+		h.Write([]byte(signed))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, jwtHashMap[alg[2:]], h.Sum(nil)); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		h := crypto.SHA256.New()
+		h.Write([]byte(signed))
+		r, s, err := ecdsa.Sign(rand.Reader, k, h.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// writePublicKey 公钥写入PEM文件
+func writePublicKey(t *testing.T, dir string, name string, pub interface{}) (string, []byte) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	fileName := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(fileName, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName, data
+}
+
+func TestCheckJWT(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFile, rsaPem := writePublicKey(t, dir, "rsa.pem", &rsaKey.PublicKey)
+	ecFile, _ := writePublicKey(t, dir, "ec.pem", &ecKey.PublicKey)
+	secret := []byte("jwt-secret")
+
+	c, err := Build(Config{
+		JWT: JWTConfig{
+			Issuer:   "auth.example.com",
+			Audience: "gateway",
+			Leeway:   30,
+			Keys: []JWTKeyConfig{
+				{Kid: "hs", Alg: "HS256", Secret: string(secret)},
+				{Kid: "rs", Alg: "RS256", PublicKeyFile: rsaFile},
+				{Kid: "es", Alg: "ES256", PublicKeyFile: ecFile},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Store(c)
+	defer Store(&Checker{})
+
+	now := time.Now().Unix()
+	claims := func(modify func(map[string]interface{})) map[string]interface{} {
+		m := map[string]interface{}{
+			"iss":   "auth.example.com",
+			"sub":   "user-1",
+			"aud":   "gateway",
+			"exp":   now + 600,
+			"nbf":   now - 10,
+			"scope": "download admin",
+		}
+		if modify != nil {
+			modify(m)
+		}
+		return m
+	}
+
+	tests := []struct {
+		name    string
+		auth    string
+		wantErr string
+	}{
+		{name: "missing", auth: "", wantErr: ErrTokenMissing.Error()},
+		{name: "not bearer", auth: "Basic abc", wantErr: ErrTokenMissing.Error()},
+		{name: "malformed", auth: "Bearer a.b", wantErr: ErrTokenInvalid.Error()},
+		{name: "HS256 valid", auth: "Bearer " + signJWT(t, "HS256", "hs", claims(nil), secret)},
+		{name: "RS256 valid", auth: "Bearer " + signJWT(t, "RS256", "rs", claims(nil), rsaKey)},
+		{name: "ES256 valid", auth: "Bearer " + signJWT(t, "ES256", "es", claims(nil), ecKey)},
+		{name: "lower case bearer", auth: "bearer " + signJWT(t, "HS256", "hs", claims(nil), secret)},
+		{
+			name:    "signature mismatch",
+			auth:    "Bearer " + signJWT(t, "HS256", "hs", claims(nil), []byte("other-secret")),
+			wantErr: ErrTokenInvalid.Error(),
+		},
+		{
+			name:    "unknown kid",
+			auth:    "Bearer " + signJWT(t, "HS256", "other", claims(nil), secret),
+			wantErr: ErrTokenInvalid.Error(),
+		},
+		{
+			name:    "alg none",
+			auth:    "Bearer " + signJWT(t, "none", "hs", claims(nil), nil),
+			wantErr: ErrTokenInvalid.Error(),
+		},
+		{
+			// 使用RSA公钥作为HS256密钥签名, 本地配置的rs密钥算法为RS256, 不能通过
+			name:    "alg confusion RS256 to HS256",
+			auth:    "Bearer " + signJWT(t, "HS256", "rs", claims(nil), rsaPem),
+			wantErr: ErrTokenInvalid.Error(),
+		},
+		{
+			name:    "alg mismatch with kid",
+			auth:    "Bearer " + signJWT(t, "HS512", "hs", claims(nil), secret),
+			wantErr: ErrTokenInvalid.Error(),
+		},
+		{
+			name:    "expired",
+			auth:    "Bearer " + signJWT(t, "HS256", "hs", claims(func(m map[string]interface{}) { m["exp"] = now - 60 }), secret),
+			wantErr: "jwt expired",
+		},
+		{
+			name:    "missing exp",
+			auth:    "Bearer " + signJWT(t, "HS256", "hs", claims(func(m map[string]interface{}) { delete(m, "exp") }), secret),
+			wantErr: "jwt exp missing",
+		},
+		{
+			name: "expired within leeway",
+			auth: "Bearer " + signJWT(t, "HS256", "hs", claims(func(m map[string]interface{}) { m["exp"] = now - 10 }), secret),
+		},
+		{
+			name:    "not valid yet",
+			auth:    "Bearer " + signJWT(t, "HS256", "hs", claims(func(m map[string]interface{}) { m["nbf"] = now + 60 }), secret),
+			wantErr: "jwt not valid yet",
+		},
+		{
+			name:    "wrong issuer",
+			auth:    "Bearer " + signJWT(t, "HS256", "hs", claims(func(m map[string]interface{}) { m["iss"] = "evil" }), secret),
+			wantErr: "jwt issuer invalid",
+		},
+		{
+			name:    "wrong audience",
+			auth:    "Bearer " + signJWT(t, "HS256", "hs", claims(func(m map[string]interface{}) { m["aud"] = "other" }), secret),
+			wantErr: "jwt audience invalid",
+		},
+		{
+			name:    "missing audience",
+			auth:    "Bearer " + signJWT(t, "HS256", "hs", claims(func(m map[string]interface{}) { delete(m, "aud") }), secret),
+			wantErr: "jwt audience invalid",
+		},
+		{
+			name: "audience list",
+			auth: "Bearer " + signJWT(t, "HS256", "hs", claims(func(m map[string]interface{}) { m["aud"] = []string{"other", "gateway"} }), secret),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api", nil)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			identity, err := CheckJWT(r)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.Type != "jwt" || identity.Name != "user-1" ||
+				!identity.Allow("download") || !identity.Allow("admin") || identity.Allow("other") {
+				t.Fatalf("identity = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestCheckJWTOptionalClaims(t *testing.T) {
+	secret := []byte("jwt-secret")
+	c, err := Build(Config{
+		JWT: JWTConfig{
+			AllowNoExp: true,
+			Keys:       []JWTKeyConfig{{Kid: "hs", Alg: "HS256", Secret: string(secret)}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Store(c)
+	defer Store(&Checker{})
+
+	// 配置AllowNoExp后接受无exp的JWT, 未携带scope时只能访问不需要scope的接口
+	r := httptest.NewRequest("GET", "/api", nil)
+	r.Header.Set("Authorization", "Bearer "+signJWT(t, "HS256", "hs", map[string]interface{}{"sub": "user-1"}, secret))
+	identity, err := CheckJWT(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !identity.Allow("") || identity.Allow("download") {
+		t.Fatalf("identity = %+v, jwt without scope should only pass unscoped check", identity)
+	}
+}
+
+func TestBuildJWTKey(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFile, _ := writePublicKey(t, dir, "rsa.pem", &rsaKey.PublicKey)
+
+	tests := []struct {
+		name    string
+		conf    JWTKeyConfig
+		wantErr bool
+	}{
+		{name: "alg none", conf: JWTKeyConfig{Alg: "none"}, wantErr: true},
+		{name: "alg unknown hash", conf: JWTKeyConfig{Alg: "HS111", Secret: "s"}, wantErr: true},
+		{name: "hs empty secret", conf: JWTKeyConfig{Alg: "HS256"}, wantErr: true},
+		{name: "rsa key as ES256", conf: JWTKeyConfig{Alg: "ES256", PublicKeyFile: rsaFile}, wantErr: true},
+		{name: "key file missing", conf: JWTKeyConfig{Alg: "RS256", PublicKeyFile: filepath.Join(dir, "none.pem")}, wantErr: true},
+		{name: "rs valid", conf: JWTKeyConfig{Alg: "RS256", PublicKeyFile: rsaFile}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := buildJWTKey(tt.conf); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := buildJWT(JWTConfig{Leeway: -1}); err == nil {
+		t.Fatal("negative leeway should be rejected")
+	}
+}
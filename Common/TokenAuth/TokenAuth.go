@@ -0,0 +1,87 @@
+package TokenAuth
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+// Config Token校验配置
+type Config struct {
+	APIKeys []APIKeyConfig // 静态API Key
+	HMAC    HMACConfig     // HMAC签名
+	JWT     JWTConfig      // JWT
+}
+
+// Identity 校验通过的调用方身份
+type Identity struct {
+	Type   string          // 校验方式: api_key/hmac/jwt
+	Name   string          // 调用方名称
+	Scopes map[string]bool // 调用方可访问的Scope, 为空则不限制(jwt除外)
+}
+
+// Allow 判断调用方是否可以访问scope, scope为空则不校验
+// P.s> jwt由外部签发, 未携带scope/scp时不能访问需要scope的接口
+func (identity *Identity) Allow(scope string) bool {
+	if scope == "" {
+		return true
+	}
+	if len(identity.Scopes) == 0 {
+		return identity.Type != "jwt"
+	}
+	return identity.Scopes[scope]
+}
+
+func newScopes(scopeList []string) map[string]bool {
+	scopes := make(map[string]bool, len(scopeList))
+	for _, scope := range scopeList {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes[scope] = true
+		}
+	}
+	return scopes
+}
+
+// Checker 校验配置解析后的结果, 通过Build生成
+type Checker struct {
+	apiKeys  map[string]*Identity // sha256(key)->调用方
+	hmacApps map[string]*hmacApp  // app_id->app
+	hmacSkew int64                // 时间戳允许误差, 单位s
+	jwt      *jwtChecker
+}
+
+var checker atomic.Value // *Checker
+
+func init() {
+	checker.Store(&Checker{})
+}
+
+// Build 校验配置并生成Checker, 失败不影响当前配置
+func Build(conf Config) (*Checker, error) {
+	c := &Checker{}
+	var err error
+	if c.apiKeys, err = buildAPIKeys(conf.APIKeys); err != nil {
+		return nil, err
+	}
+	if c.hmacApps, c.hmacSkew, err = buildHMAC(conf.HMAC); err != nil {
+		return nil, err
+	}
+	if c.jwt, err = buildJWT(conf.JWT); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Store 替换当前Checker
+func Store(c *Checker) {
+	if c != nil {
+		checker.Store(c)
+	}
+}
+
+func getChecker() *Checker {
+	return checker.Load().(*Checker)
+}
+
+var ErrTokenMissing = errors.New("token missing")
+var ErrTokenInvalid = errors.New("token invalid")
@@ -0,0 +1,439 @@
+package Tracing
+
+import (
+	"GateWayCommon/logger"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 导出方式
+const (
+	Exporter_OTLP = "otlp" // OTLP/HTTP Json, 如: http://127.0.0.1:4318/v1/traces
+	Exporter_File = "file" // 本地文件, 每行一个OTLP Json导出请求
+)
+
+const (
+	default_service_name   = "algo_gateway"
+	default_queue_size     = 2048
+	default_batch_size     = 512
+	default_flush_interval = 1000 // ms
+	default_export_timeout = 3000 // ms
+	scope_name             = "GateWayCommon/Tracing"
+)
+
+// Config 链路追踪配置
+type Config struct {
+	Enable        bool              // 是否启用, 不启用时仍透传上级服务的traceparent
+	ServiceName   string            // 服务名称, 不填默认algo_gateway
+	SampleRatio   *float64          // 没有上级Span时的采样比例 0-1, 不填默认1; 有上级Span时沿用上级的采样标记
+	Exporter      string            // 导出方式: otlp/file
+	Endpoint      string            // OTLP/HTTP 地址, Exporter为otlp时必填
+	Headers       map[string]string // OTLP 请求Header, 如鉴权信息
+	FileName      string            // 导出文件, Exporter为file时必填
+	QueueSize     int               // 导出队列长度, 队列满时丢弃; 不填默认2048
+	BatchSize     int               // 单次导出最多Span数, 不填默认512
+	FlushInterval int               // 导出间隔, 单位ms; 不填默认1000
+	Timeout       int               // 单次导出超时, 单位ms; 不填默认3000
+}
+
+// exporter 导出一批Span
+type exporter interface {
+	export(ctx context.Context, data []byte) error
+	close() error
+}
+
+// Tracer 解析后的追踪配置, 通过Build生成, 负责异步导出Span
+type Tracer struct {
+	conf          Config
+	serviceName   string
+	ratio         float64
+	batchSize     int
+	flushInterval time.Duration
+	timeout       time.Duration
+	exporter      exporter
+
+	queue    chan *Span
+	dropped  uint64
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var tracer atomic.Value // *Tracer, nil为不启用
+
+func init() {
+	tracer.Store((*Tracer)(nil))
+}
+
+func getTracer() *Tracer {
+	return tracer.Load().(*Tracer)
+}
+
+// Build 校验配置并生成Tracer, 不启用返回nil; 配置未改变时沿用当前Tracer
+func Build(conf Config) (*Tracer, error) {
+	if !conf.Enable {
+		return nil, nil
+	}
+	if old := getTracer(); old != nil && reflect.DeepEqual(old.conf, conf) {
+		return old, nil
+	}
+
+	t := &Tracer{
+		conf:          conf,
+		serviceName:   conf.ServiceName,
+		ratio:         1,
+		batchSize:     conf.BatchSize,
+		flushInterval: time.Duration(conf.FlushInterval) * time.Millisecond,
+		timeout:       time.Duration(conf.Timeout) * time.Millisecond,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	if conf.SampleRatio != nil {
+		ratio := *conf.SampleRatio
+		if math.IsNaN(ratio) || ratio < 0 || ratio > 1 {
+			return nil, errors.New("tracing sample ratio invalid")
+		}
+		t.ratio = ratio
+	}
+	if conf.QueueSize < 0 || conf.BatchSize < 0 || conf.FlushInterval < 0 || conf.Timeout < 0 {
+		return nil, errors.New("tracing config invalid")
+	}
+	queueSize := conf.QueueSize
+	if queueSize == 0 {
+		queueSize = default_queue_size
+	}
+	if t.batchSize == 0 {
+		t.batchSize = default_batch_size
+	}
+	if t.flushInterval == 0 {
+		t.flushInterval = default_flush_interval * time.Millisecond
+	}
+	if t.timeout == 0 {
+		t.timeout = default_export_timeout * time.Millisecond
+	}
+	if t.serviceName == "" {
+		t.serviceName = default_service_name
+	}
+
+	switch conf.Exporter {
+	case Exporter_OTLP:
+		if conf.Endpoint == "" {
+			return nil, errors.New("tracing otlp endpoint is empty")
+		}
+		t.exporter = &otlpExporter{
+			endpoint: conf.Endpoint,
+			headers:  conf.Headers,
+			client:   &http.Client{},
+		}
+	case Exporter_File:
+		if conf.FileName == "" {
+			return nil, errors.New("tracing file name is empty")
+		}
+		file, err := os.OpenFile(conf.FileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		t.exporter = &fileExporter{file: file}
+	default:
+		return nil, errors.New("tracing exporter not support: " + conf.Exporter)
+	}
+
+	t.queue = make(chan *Span, queueSize)
+	go t.run()
+	return t, nil
+}
+
+// Store 替换当前Tracer, 原Tracer导出剩余Span后关闭
+func Store(t *Tracer) {
+	old := getTracer()
+	tracer.Store(t)
+	if old != nil && old != t {
+		go old.shutdown()
+	}
+}
+
+// Shutdown 停止追踪, 导出剩余Span, 用于进程退出
+func Shutdown() {
+	old := getTracer()
+	tracer.Store((*Tracer)(nil))
+	if old != nil {
+		old.shutdown()
+	}
+}
+
+func (t *Tracer) sample(id TraceID) bool {
+	return traceIDRatio(id, t.ratio)
+}
+
+// enqueue 加入导出队列, 队列满或已关闭时丢弃
+func (t *Tracer) enqueue(s *Span) {
+	select {
+	case <-t.stop:
+		return
+	default:
+	}
+	select {
+	case t.queue <- s:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+func (t *Tracer) shutdown() {
+	t.stopOnce.Do(func() {
+		close(t.stop)
+	})
+	<-t.done
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	defer t.exporter.close()
+
+	ticker := time.NewTicker(t.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, t.batchSize)
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= t.batchSize {
+				t.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			t.flush(batch)
+			batch = batch[:0]
+		case <-t.stop:
+			// 导出队列中剩余的Span
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+					if len(batch) >= t.batchSize {
+						t.flush(batch)
+						batch = batch[:0]
+					}
+				default:
+					t.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracer) flush(batch []*Span) {
+	if dropped := atomic.SwapUint64(&t.dropped, 0); dropped > 0 {
+		logger.Log().WithField("dropped", dropped).Warn("Tracing queue full, spans dropped")
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(t.exportRequest(batch))
+	if err != nil {
+		logger.Log().WithField("err", err).Warn("Tracing encode spans failed")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	if err := t.exporter.export(ctx, data); err != nil {
+		logger.Log().WithFields(logger.Fields{
+			"exporter": t.conf.Exporter,
+			"spans":    len(batch),
+			"err":      err,
+		}).Warn("Tracing export failed")
+	}
+}
+
+// otlpExporter OTLP/HTTP Json导出
+type otlpExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+func (e *otlpExporter) export(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("otlp export status " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
+
+func (e *otlpExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// fileExporter 本地文件导出, 每批一行, 可由OpenTelemetry Collector的otlpjsonfile读取
+type fileExporter struct {
+	file *os.File
+}
+
+func (e *fileExporter) export(ctx context.Context, data []byte) error {
+	_, err := e.file.Write(append(data, '\n'))
+	return err
+}
+
+func (e *fileExporter) close() error {
+	return e.file.Close()
+}
+
+// OTLP Json 编码, 见 opentelemetry-proto ExportTraceServiceRequest
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	TraceState        string         `json:"traceState,omitempty"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Links             []otlpLink     `json:"links,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 0:Unset 1:Ok 2:Error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func (t *Tracer) exportRequest(batch []*Span) *otlpRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		spans = append(spans, s.otlp())
+	}
+	return &otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: []otlpKeyValue{
+				otlpAttribute(Attribute{Key: "service.name", Value: t.serviceName}),
+			}},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: scope_name},
+				Spans: spans,
+			}},
+		}},
+	}
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := otlpSpan{
+		TraceID:           s.sc.TraceID.String(),
+		SpanID:            s.sc.SpanID.String(),
+		TraceState:        s.sc.TraceState,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: itoa(s.start.UnixNano()),
+		EndTimeUnixNano:   itoa(s.end.UnixNano()),
+	}
+	if s.parent.IsValid() {
+		span.ParentSpanID = s.parent.String()
+	}
+	for _, attr := range s.attrs {
+		span.Attributes = append(span.Attributes, otlpAttribute(attr))
+	}
+	for _, link := range s.links {
+		span.Links = append(span.Links, otlpLink{
+			TraceID: link.TraceID.String(),
+			SpanID:  link.SpanID.String(),
+		})
+	}
+	if s.hasStatus {
+		if s.hasError {
+			span.Status = otlpStatus{Code: 2, Message: s.errMsg}
+		} else {
+			span.Status = otlpStatus{Code: 1}
+		}
+	}
+	return span
+}
+
+// otlpAttribute 属性值转为OTLP AnyValue, 整数按字符串编码
+func otlpAttribute(attr Attribute) otlpKeyValue {
+	var value map[string]interface{}
+	switch v := attr.Value.(type) {
+	case string:
+		value = map[string]interface{}{"stringValue": v}
+	case bool:
+		value = map[string]interface{}{"boolValue": v}
+	case int:
+		value = map[string]interface{}{"intValue": itoa(int64(v))}
+	case int32:
+		value = map[string]interface{}{"intValue": itoa(int64(v))}
+	case int64:
+		value = map[string]interface{}{"intValue": itoa(v)}
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			value = map[string]interface{}{"stringValue": strconv.FormatFloat(v, 'f', -1, 64)}
+		} else {
+			value = map[string]interface{}{"doubleValue": v}
+		}
+	default:
+		b, _ := json.Marshal(v)
+		value = map[string]interface{}{"stringValue": string(b)}
+	}
+	return otlpKeyValue{Key: attr.Key, Value: value}
+}
@@ -0,0 +1,324 @@
+package Tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// W3C Trace Context 传递的Header/metadata名称
+const (
+	Header_Traceparent = "traceparent"
+	Header_Tracestate  = "tracestate"
+)
+
+// SpanKind 与OTLP的SpanKind取值一致
+type SpanKind int
+
+const (
+	SpanKind_Internal SpanKind = 1
+	SpanKind_Server   SpanKind = 2
+	SpanKind_Client   SpanKind = 3
+)
+
+// TraceID 16字节, 全0无效
+type TraceID [16]byte
+
+// SpanID 8字节, 全0无效
+type SpanID [8]byte
+
+func (id TraceID) IsValid() bool  { return id != TraceID{} }
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) IsValid() bool   { return id != SpanID{} }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// SpanContext 跨进程传递的Span信息
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string // 原样透传的tracestate
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent 生成traceparent, 格式: 00-{trace_id}-{span_id}-{flags}
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent 解析traceparent, 格式不正确返回false
+//	未知版本按00版本解析前55个字符, ff版本无效
+func ParseTraceparent(str string) (SpanContext, bool) {
+	var sc SpanContext
+	str = strings.TrimSpace(str)
+	if len(str) < 55 || (len(str) > 55 && (str[:2] == "00" || str[55] != '-')) {
+		return sc, false
+	}
+	if str[2] != '-' || str[35] != '-' || str[52] != '-' {
+		return sc, false
+	}
+	version, ok := parseHex(str[0:2])
+	if !ok || len(version) != 1 || version[0] == 0xff {
+		return sc, false
+	}
+	traceID, ok := parseHex(str[3:35])
+	if !ok {
+		return sc, false
+	}
+	spanID, ok := parseHex(str[36:52])
+	if !ok {
+		return sc, false
+	}
+	flags, ok := parseHex(str[53:55])
+	if !ok {
+		return sc, false
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&0x01 == 0x01
+	return sc, sc.IsValid()
+}
+
+// parseHex 只接受小写十六进制
+func parseHex(str string) ([]byte, bool) {
+	if strings.ToLower(str) != str {
+		return nil, false
+	}
+	b, err := hex.DecodeString(str)
+	return b, err == nil
+}
+
+// Extract 从Header/metadata中读取上级Span, get为取值函数
+func Extract(get func(key string) string) (SpanContext, bool) {
+	sc, ok := ParseTraceparent(get(Header_Traceparent))
+	if ok {
+		sc.TraceState = get(Header_Tracestate)
+	}
+	return sc, ok
+}
+
+// Inject 将ctx中的Span写入Header/metadata, set为赋值函数; 没有Span不写入
+func Inject(ctx context.Context, set func(key string, value string)) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	set(Header_Traceparent, sc.Traceparent())
+	if sc.TraceState != "" {
+		set(Header_Tracestate, sc.TraceState)
+	}
+}
+
+type ctxKey int
+
+const (
+	ctxKeySpan   ctxKey = iota // *Span
+	ctxKeyRemote               // SpanContext, 上级服务传入
+)
+
+// ContextWithRemote 设置上级服务传入的Span, 作为后续Span的父结点
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, ctxKeyRemote, sc)
+}
+
+// WithoutParent 去掉ctx中的Span及上级服务传入的Span, 之后创建的Span为新链路的根结点
+func WithoutParent(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, ctxKeySpan, (*Span)(nil))
+	return context.WithValue(ctx, ctxKeyRemote, SpanContext{})
+}
+
+// FromContext 获取ctx中的Span, 没有返回nil
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(ctxKeySpan).(*Span)
+	return span
+}
+
+// SpanContextFromContext 获取ctx中的Span信息, 没有本地Span时返回上级服务传入的Span
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := FromContext(ctx); span != nil {
+		return span.sc
+	}
+	sc, _ := ctx.Value(ctxKeyRemote).(SpanContext)
+	return sc
+}
+
+// Attribute Span属性
+type Attribute struct {
+	Key   string
+	Value interface{} // string/bool/int/int32/int64/float64, 其余按字符串输出
+}
+
+// Span 一次操作的耗时记录, nil Span的方法均为空操作
+//	Start生成, End后加入导出队列; 未采样的Span只用于传递traceparent
+type Span struct {
+	tracer *Tracer
+	name   string
+	kind   SpanKind
+	sc     SpanContext
+	parent SpanID
+	start  time.Time
+
+	mu        sync.Mutex
+	end       time.Time
+	attrs     []Attribute
+	links     []SpanContext
+	errMsg    string
+	hasError  bool
+	hasStatus bool
+}
+
+// Start 创建Span, ctx中有Span(或上级服务传入的Span)时作为子Span
+//	未启用追踪时返回nil Span, ctx中已有的上级Span不受影响, 仍可以继续传递
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	t := getTracer()
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent := SpanContextFromContext(ctx)
+	span := &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+	}
+	span.sc.SpanID = newSpanID()
+	if parent.IsValid() {
+		span.sc.TraceID = parent.TraceID
+		span.sc.Sampled = parent.Sampled
+		span.sc.TraceState = parent.TraceState
+		span.parent = parent.SpanID
+	} else {
+		span.sc.TraceID = newTraceID()
+		span.sc.Sampled = t.sample(span.sc.TraceID)
+	}
+	return context.WithValue(ctx, ctxKeySpan, span), span
+}
+
+// SpanContext 用于传递的Span信息
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttributes 设置属性, 同名属性覆盖
+func (s *Span) SetAttributes(kv ...Attribute) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attr := range kv {
+		replaced := false
+		for i := range s.attrs {
+			if s.attrs[i].Key == attr.Key {
+				s.attrs[i].Value = attr.Value
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.attrs = append(s.attrs, attr)
+		}
+	}
+}
+
+// SetAttribute 设置单个属性
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.SetAttributes(Attribute{Key: key, Value: value})
+}
+
+// AddLink 关联其他Span, 用于合并的批量请求
+func (s *Span) AddLink(sc SpanContext) {
+	if s == nil || !s.sc.Sampled || !sc.IsValid() {
+		return
+	}
+	s.mu.Lock()
+	s.links = append(s.links, sc)
+	s.mu.Unlock()
+}
+
+// SetError 标记失败, err为nil标记成功
+func (s *Span) SetError(err error) {
+	if err == nil {
+		s.SetStatus(true, "")
+	} else {
+		s.SetStatus(false, err.Error())
+	}
+}
+
+// SetStatus 设置状态, 未设置时导出为Unset
+func (s *Span) SetStatus(ok bool, msg string) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	s.hasStatus = true
+	s.hasError = !ok
+	s.errMsg = msg
+	s.mu.Unlock()
+}
+
+// End 结束Span, 只有第一次调用生效
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sc.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// traceIDRatio 按TraceID后8字节计算采样, 同一Trace的采样结果一致
+func traceIDRatio(id TraceID, ratio float64) bool {
+	if ratio >= 1 {
+		return true
+	}
+	if ratio <= 0 {
+		return false
+	}
+	bound := uint64(ratio * (1 << 63))
+	return binary.BigEndian.Uint64(id[8:])>>1 < bound
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
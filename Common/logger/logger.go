@@ -13,6 +13,7 @@ import (
 
 type Fields = logrus.Fields
 type Level = logrus.Level
+type Entry = logrus.Entry
 
 const (
 	PanicLevel = logrus.PanicLevel
@@ -31,6 +32,16 @@ func Log() *logrus.Logger {
 	return log
 }
 
+// ParseLevel 解析日志等级, 如: debug/info/warning/error
+func ParseLevel(lvl string) (Level, error) {
+	return logrus.ParseLevel(lvl)
+}
+
+// SetLevel 修改输出日志等级
+func SetLevel(log_level Level) {
+	log.SetLevel(log_level)
+}
+
 const (
 	timestamp_format string = "2006-01-02 15:04:05.000000" // 时间戳格式
 	file_rorate      string = ".%Y%m%d_%H"                 // 日期格式
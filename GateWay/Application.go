@@ -4,8 +4,8 @@ import (
 	"AlgoGateWay/GateWay/HTTPMessage"
 	"GateWayCommon/GateWayProtos"
 	"GateWayCommon/RegisterCenter"
+	"GateWayCommon/Tracing"
 	"GateWayCommon/logger"
-	"context"
 	"net"
 	"net/http"
 	"os"
@@ -63,22 +63,25 @@ func (app *Application) Init(
 		logger.Log().Error("Config Init error")
 		return false
 	}
+	conf := app.Conf.GetConfig()
 
-	app.GrpcReceiver = new(GrpcMessage)
-	if app.GrpcReceiver.Init() == false {
-		logger.Log().Error("GrpcReceiver Init error")
+	// 校验配置, 加载路由及兜底物料池
+	prepared, err := prepareConfig(&conf, nil)
+	if err != nil {
+		logger.Log().WithField("err", err).Error("Config Prepare error")
 		return false
 	}
+	app.applyConfig(prepared)
 
-	// 判断注册中心地址的长度大于0
-	if len(app.Conf.g_config.RegisterCenterAddr) == 0 {
-		logger.Log().Error("Config RegisterCenterAddr Size error")
+	app.GrpcReceiver = new(GrpcMessage)
+	if app.GrpcReceiver.Init() == false {
+		logger.Log().Error("GrpcReceiver Init error")
 		return false
 	}
 
 	hostname, _ := os.Hostname()
 	localAddr := app.localIP + ":" + app.listenPort
-	regAddrList := app.Conf.g_config.RegisterCenterAddr
+	regAddrList := conf.RegisterCenterAddr
 	serviceInfo := &GateWayProtos.ServiceInfo{
 		ServiceType:   int32(GateWayProtos.ServiceType_SERVICE_ALGO_GATE_WAY),
 		Semver:        GateWayVersion,
@@ -87,7 +90,7 @@ func (app *Application) Init(
 		Status:        int32(GateWayProtos.ServiceStatus_Online),
 		ServiceWeight: 32,
 		ConnectMode:   int32(GateWayProtos.ConnectMode_GRPC),
-		GroupTab:      app.Conf.g_config.ServiceGroupTab,
+		GroupTab:      conf.ServiceGroupTab,
 		ServiceName:   srvExe,
 		Nickname:      nickname,
 	}
@@ -97,8 +100,22 @@ func (app *Application) Init(
 		RelySemver:      AlgoCenterVersion,
 	})
 
+	// 服务发现, 与注册中心下发的结点一同参与负载均衡
+	var discoveries []RegisterCenter.Discovery
+	for _, discoveryConf := range conf.Discovery {
+		discovery, err := RegisterCenter.BuildDiscovery(discoveryConf)
+		if err != nil {
+			logger.Log().WithFields(logger.Fields{
+				"type": discoveryConf.Type,
+				"err":  err,
+			}).Error("Discovery Build error")
+			return false
+		}
+		discoveries = append(discoveries, discovery)
+	}
+
 	app.RegCenter = new(RegisterCenter.RegisterCenter)
-	if err := app.RegCenter.Init(serviceInfo, regAddrList); err != nil {
+	if err := app.RegCenter.Init(serviceInfo, regAddrList, discoveries...); err != nil {
 		logger.Log().WithFields(logger.Fields{
 			"version":   GateWayVersion,
 			"localAddr": localAddr,
@@ -112,7 +129,7 @@ func (app *Application) Init(
 
 	// 将HttpMessage注册后移, 放到注册中心之后
 	app.HttpReceiver = new(HTTPMessage.HttpMessage)
-	if app.HttpReceiver.Init(localAddr, app.RegCenter) == false {
+	if app.HttpReceiver.Init(localAddr, app.RegCenter, prepared.routes) == false {
 		logger.Log().Error("HttpReceiver Init error")
 		return false
 	}
@@ -156,17 +173,28 @@ func (app *Application) Start() {
 	}
 
 	// http服务
+	httpConf := app.Conf.GetConfig().Http
 	s := &http.Server{
-		Addr:         listenAddr,
-		Handler:      app.HandlerFunc(),
-		ReadTimeout:  time.Duration(app.Conf.GetConfig().Http.ReadTimeout) * time.Millisecond,
-		WriteTimeout: time.Duration(app.Conf.GetConfig().Http.WriteTimeout) * time.Millisecond,
+		Addr:              listenAddr,
+		Handler:           app.HandlerFunc(),
+		ReadTimeout:       time.Duration(httpConf.ReadTimeout) * time.Millisecond,
+		WriteTimeout:      time.Duration(httpConf.WriteTimeout) * time.Millisecond,
+		ReadHeaderTimeout: time.Duration(httpConf.ReadHeaderTimeout) * time.Millisecond, // 防止慢速客户端占用连接
+		IdleTimeout:       time.Duration(httpConf.IdleTimeout) * time.Millisecond,
+		MaxHeaderBytes:    httpConf.MaxHeaderBytes,
 	}
 
 	// 监听退出消息
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, os.Kill, syscall.SIGTERM, syscall.SIGQUIT)
 
+	// 监听配置文件修改及SIGHUP, 热更新配置
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	watchDone := make(chan struct{})
+	defer close(watchDone)
+	go app.watchConfig(hup, watchDone)
+
 	// 协程处理服务
 	go func() {
 		logger.Log().Info("Serving...")
@@ -185,28 +213,50 @@ func (app *Application) Start() {
 
 	logger.Log().Info("Application Exiting...")
 
-	// 注册中心客户端下线
-	app.RegCenter.Offline()
+	// 优雅退出, 等待正在处理的请求完成
+	app.drain(s)
 
-	// 设定1秒超时, 停止Http服务
-	logger.Log().Info("Shutdown Http Server...")
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-	if err := s.Shutdown(ctx); err != nil {
-		logger.Log().WithField("err", err).Info("Shutdown Http Server Error")
-	}
+	// 停止服务发现
+	app.RegCenter.Close()
 
-	// 停止grpc服务
-	app.GrpcReceiver.Stop()
+	// 导出剩余的链路追踪数据
+	Tracing.Shutdown()
 }
 
 // grpc/http 消息分发
 func (app *Application) HandlerFunc() http.Handler {
+	httpConf := app.Conf.GetConfig().Http
 	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.ProtoMajor == 2 && strings.Contains(r.Header.Get("Content-Type"), "application/grpc") {
+		if httpConf.MaxHeaderCount > 0 && headerCount(r.Header) > httpConf.MaxHeaderCount {
+			logger.Log().WithFields(logger.Fields{
+				"Method": r.Method,
+				"Host":   r.Host,
+				"URL":    r.URL.String(),
+				"count":  headerCount(r.Header),
+			}).Warn("request header count exceeds limit")
+			http.Error(w, "request header fields too large", http.StatusRequestHeaderFieldsTooLarge)
+			return
+		}
+
+		if isGrpcWebRequest(r) {
+			defer app.HttpReceiver.TrackInFlight(HTTPMessage.Protocol_GrpcWeb)()
+			app.GrpcReceiver.WebHandler(w, r)
+		} else if r.ProtoMajor == 2 && strings.Contains(r.Header.Get("Content-Type"), "application/grpc") {
+			defer app.HttpReceiver.TrackInFlight(HTTPMessage.Protocol_Grpc)()
 			app.GrpcReceiver.Handler(w, r)
 		} else {
 			app.HttpReceiver.Handler(w, r)
 		}
-	}), &http2.Server{})
+	}), &http2.Server{
+		IdleTimeout: time.Duration(httpConf.IdleTimeout) * time.Millisecond,
+	})
+}
+
+// headerCount 请求Header数量, 同名Header按值计数
+func headerCount(header http.Header) int {
+	n := 0
+	for _, vals := range header {
+		n += len(vals)
+	}
+	return n
 }
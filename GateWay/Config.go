@@ -1,10 +1,32 @@
 package main
 
-import "GateWayCommon"
+import (
+	"AlgoGateWay/GateWay/HTTPMessage"
+	"GateWayCommon"
+	"GateWayCommon/AddrLimiter"
+	"GateWayCommon/RateLimiter"
+	"GateWayCommon/RegisterCenter"
+	"GateWayCommon/TokenAuth"
+	"GateWayCommon/Tracing"
+	"GateWayCommon/logger"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
 
 type s_http struct {
-	ReadTimeout  int
-	WriteTimeout int
+	ReadTimeout       int // 读取请求超时, 单位ms
+	WriteTimeout      int // 写回超时, 单位ms
+	ReadHeaderTimeout int // 读取请求Header超时, 单位ms; 0则使用ReadTimeout
+	IdleTimeout       int // keep-alive空闲连接超时, 单位ms; 0则使用ReadTimeout
+	MaxHeaderBytes    int // 请求Header最大长度, 单位字节; 0为默认1MB
+	MaxHeaderCount    int // 请求Header最大数量, 超出返回431; 0为不限制
+}
+
+type s_drain struct {
+	PropagationDelay int // 下线后等待注册中心通知下游的时间, 单位ms; 不填默认3000
+	Timeout          int // 等待正在处理的请求完成的最长时间, 单位ms; 不填默认10000
 }
 
 type s_swagger struct {
@@ -19,22 +41,136 @@ type s_ground_rules struct {
 	FileName string
 }
 
+// s_serverConfig 服务配置, 修改配置文件或SIGHUP时重新加载
+//	标注"修改后需重启"的配置项被修改时拒绝重新加载, 保留原有配置
 type s_serverConfig struct {
-	IP                 string
-	Http               s_http
-	RegisterCenterAddr []string
-	ServiceGroupTab    string
+	IP                 string                           // 监听IP, 修改后需重启
+	Http               s_http                           // 修改后需重启
+	Drain              s_drain                          // 优雅退出配置
+	RegisterCenterAddr []string                         // 注册中心地址, 为空则不使用注册中心; 启动时为空则修改后需重启
+	Discovery          []RegisterCenter.DiscoveryConfig // 注册中心之外的服务发现, 修改后需重启
+	ServiceGroupTab    string                           // 服务分组, 修改后需重启
+	LogLevel           string                           // 日志等级, 为空默认info
+	IPWhiteList        []string                         // IP白名单, 合并到默认名单(default)的Allow中
+	AddrLimiter        AddrLimiter.Config
+	GroundRules        []s_ground_rules
+	CircuitBreaker     RegisterCenter.BreakerConfig  // 下级结点熔断配置
+	Retry              []RegisterCenter.RetryConfig  // 下级服务接口重试及对冲
+	Batch              []RegisterCenter.BatchConfig  // 下级服务接口批量请求
+	TokenAuth          TokenAuth.Config              // Token校验配置
+	RateLimit          RateLimiter.Config            // 全局及下级服务接口限流
+	GrpcWeb            s_grpc_web                    // gRPC-Web配置
+	Compression        HTTPMessage.CompressionConfig // HTTP压缩配置
+	Tracing            Tracing.Config                // 链路追踪配置
+	Admin              HTTPMessage.AdminConfig       // 管理接口配置
+	Routes             []HTTPMessage.RouteConfig
 }
 
 type Config struct {
+	rwlock   sync.RWMutex
 	g_config s_serverConfig
+
+	filename string    // 配置文件路径
+	modTime  time.Time // 配置文件修改时间
 }
 
 func (conf *Config) Init(filename string) bool {
+	conf.filename = filename
+	g_config, err := conf.Load()
+	if err != nil {
+		logger.Log().WithFields(logger.Fields{
+			"filename": filename,
+			"err":      err,
+		}).Error("Config Load error")
+		return false
+	}
+	conf.Set(g_config)
+	return true
+}
+
+// Load 读取并校验配置文件, 不影响当前配置
+func (conf *Config) Load() (*s_serverConfig, error) {
+	info, err := os.Stat(conf.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// 无论校验是否通过都记录修改时间, 避免错误配置被重复加载
+	conf.rwlock.Lock()
+	conf.modTime = info.ModTime()
+	conf.rwlock.Unlock()
+
+	g_config := &s_serverConfig{}
 	JsonParse := GateWayCommon.NewJsonStruct()
-	return JsonParse.Load(filename, &conf.g_config)
+	if err := JsonParse.LoadFile(conf.filename, g_config); err != nil {
+		return nil, err
+	}
+	if err := g_config.check(); err != nil {
+		return nil, err
+	}
+	return g_config, nil
+}
+
+// Modified 判断配置文件是否有修改
+func (conf *Config) Modified() bool {
+	info, err := os.Stat(conf.filename)
+	if err != nil {
+		return false
+	}
+
+	conf.rwlock.RLock()
+	defer conf.rwlock.RUnlock()
+	return !info.ModTime().Equal(conf.modTime)
+}
+
+// Set 替换当前配置
+func (conf *Config) Set(g_config *s_serverConfig) {
+	conf.rwlock.Lock()
+	conf.g_config = *g_config
+	conf.rwlock.Unlock()
 }
 
 func (conf *Config) GetConfig() s_serverConfig {
+	conf.rwlock.RLock()
+	defer conf.rwlock.RUnlock()
 	return conf.g_config
 }
+
+// check 配置校验
+func (g_config *s_serverConfig) check() error {
+	// 注册中心地址与服务发现至少配置一项
+	if len(g_config.RegisterCenterAddr) == 0 && len(g_config.Discovery) == 0 {
+		return errors.New("RegisterCenterAddr and Discovery are both empty")
+	}
+	for _, discovery := range g_config.Discovery {
+		if _, err := RegisterCenter.BuildDiscovery(discovery); err != nil {
+			return err
+		}
+		if err := discovery.CheckGroupTab(g_config.ServiceGroupTab); err != nil {
+			return err
+		}
+	}
+
+	if g_config.Http.ReadTimeout < 0 || g_config.Http.WriteTimeout < 0 ||
+		g_config.Http.ReadHeaderTimeout < 0 || g_config.Http.IdleTimeout < 0 ||
+		g_config.Http.MaxHeaderBytes < 0 || g_config.Http.MaxHeaderCount < 0 {
+		return errors.New("Http config invalid")
+	}
+
+	if g_config.Drain.PropagationDelay < 0 || g_config.Drain.Timeout < 0 {
+		return errors.New("Drain config invalid")
+	}
+
+	if _, err := g_config.logLevel(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// logLevel 解析日志等级
+func (g_config *s_serverConfig) logLevel() (logger.Level, error) {
+	if g_config.LogLevel == "" {
+		return logger.InfoLevel, nil
+	}
+	return logger.ParseLevel(g_config.LogLevel)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"AlgoGateWay/GateWay/HTTPMessage"
+	"GateWayCommon/logger"
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultDrainPropagationDelay = 3000  // 默认等待注册中心通知下游的时间, 单位ms
+	defaultDrainTimeout          = 10000 // 默认等待正在处理的请求完成的最长时间, 单位ms
+
+	drainPollInterval     = 100 * time.Millisecond // 检查正在处理的请求数的间隔
+	drainProgressInterval = time.Second            // 打印等待进度的间隔
+)
+
+// drain 优雅退出, 依次执行:
+//	1. 标记下线中, /readyz返回503, 负载均衡不再转发新请求
+//	2. 注册中心下线
+//	3. 等待注册中心将下线通知到上游服务
+//	4. 等待正在处理的HTTP/gRPC请求完成, 最长Drain.Timeout
+//	5. 关闭Http服务及grpc服务, 仍有未完成请求时强制关闭
+func (app *Application) drain(s *http.Server) {
+	conf := app.Conf.GetConfig().Drain
+	propagationDelay := conf.PropagationDelay
+	if propagationDelay == 0 {
+		propagationDelay = defaultDrainPropagationDelay
+	}
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = defaultDrainTimeout
+	}
+
+	// 1. 标记下线中
+	app.HttpReceiver.SetDraining(true)
+	logger.Log().Info("Drain: marked not ready")
+
+	// 2. 注册中心客户端下线
+	if err := app.RegCenter.Offline(); err != nil {
+		logger.Log().WithField("err", err).Warn("Drain: RegisterCenter Offline Failed")
+	} else {
+		logger.Log().Info("Drain: RegisterCenter Offline Succ")
+	}
+
+	// 3. 等待下线通知扩散, 期间仍正常处理请求
+	logger.Log().WithField("delay_ms", propagationDelay).Info("Drain: waiting for register center propagation")
+	time.Sleep(time.Duration(propagationDelay) * time.Millisecond)
+
+	// 4. 等待正在处理的请求完成
+	deadline := time.Now().Add(time.Duration(timeout) * time.Millisecond)
+	drained := app.waitInFlight(deadline)
+
+	// 5. 停止Http服务, 至少保留1秒关闭空闲连接
+	logger.Log().Info("Shutdown Http Server...")
+	shutdownTimeout := time.Until(deadline)
+	if shutdownTimeout < time.Second {
+		shutdownTimeout = time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		logger.Log().WithField("err", err).Warn("Shutdown Http Server Error")
+		s.Close()
+		drained = false
+	}
+
+	// 停止grpc服务
+	if drained {
+		app.GrpcReceiver.Stop()
+	} else {
+		logger.Log().WithFields(inflightFields(app.HttpReceiver.InFlight())).Warn("Drain: force stop grpc server")
+		app.GrpcReceiver.ForceStop()
+	}
+	logger.Log().Info("Drain: finished")
+}
+
+// waitInFlight 等待正在处理的请求数归零, 超过deadline返回false
+func (app *Application) waitInFlight(deadline time.Time) bool {
+	st := time.Now()
+	lastLog := st
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		stat := app.HttpReceiver.InFlight()
+		if stat.Total <= 0 {
+			logger.Log().WithField("dur", time.Since(st).String()).Info("Drain: all in-flight requests finished")
+			return true
+		}
+
+		now := time.Now()
+		if now.After(deadline) {
+			logger.Log().WithFields(inflightFields(stat)).Warn("Drain: timeout waiting for in-flight requests")
+			return false
+		}
+		if now.Sub(lastLog) >= drainProgressInterval {
+			lastLog = now
+			fields := inflightFields(stat)
+			fields["remaining"] = time.Until(deadline).Truncate(time.Millisecond).String()
+			logger.Log().WithFields(fields).Info("Drain: waiting for in-flight requests")
+		}
+		<-ticker.C
+	}
+}
+
+// inflightFields 正在处理的请求数日志字段
+func inflightFields(stat HTTPMessage.InFlightStat) logger.Fields {
+	return logger.Fields{
+		"http":     stat.Http,
+		"grpc":     stat.Grpc,
+		"grpc_web": stat.GrpcWeb,
+		"total":    stat.Total,
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"AlgoGateWay/GateWay/HTTPMessage"
 	"GateWayCommon/GateWayProtos"
 	"context"
 	"net/http"
@@ -42,6 +43,12 @@ func (grpcMsg *GrpcMessage) Stop() {
 	grpcMsg.grpcServer.GracefulStop()
 }
 
+// ForceStop 强制退出, 关闭所有连接
+// P.s> 经ServeHTTP处理的请求不支持GracefulStop中的Drain, 仍有未完成请求时只能强制退出
+func (grpcMsg *GrpcMessage) ForceStop() {
+	grpcMsg.grpcServer.Stop()
+}
+
 func (grpcMsg *GrpcMessage) Handler(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -60,11 +67,24 @@ func (grpcMsg *GrpcMessage) CallService(
 	} else if cmd == int32(GateWayProtos.CmdType_CMD_HELLO) {
 		return GetApplication().RegCenter.OnHello(ctx, req)
 	} else {
-		resp := &GateWayProtos.UnifiedResponse{
-			Cmd:      cmd,
+		// 业务CMD透传到下级服务
+		return grpcMsg.callBusiness(ctx, HTTPMessage.Protocol_Grpc, req), nil
+	}
+}
+
+// callBusiness 透传业务CMD, 复用HTTP路由的校验、限流及日志
+func (grpcMsg *GrpcMessage) callBusiness(
+	ctx context.Context,
+	protocol string,
+	req *GateWayProtos.UnifiedRequest,
+) *GateWayProtos.UnifiedResponse {
+	httpReceiver := GetApplication().HttpReceiver
+	if httpReceiver == nil {
+		return &GateWayProtos.UnifiedResponse{
+			Cmd:      req.GetCmd(),
 			Result:   int32(GateWayProtos.ResultType_ERR_Service_CMD),
 			Response: []byte("unsupported cmd."),
 		}
-		return resp, nil
 	}
+	return httpReceiver.CallService(ctx, protocol, req)
 }
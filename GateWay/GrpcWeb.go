@@ -0,0 +1,286 @@
+package main
+
+import (
+	"AlgoGateWay/GateWay/HTTPMessage"
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/logger"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	protoV2 "google.golang.org/protobuf/proto"
+)
+
+// gRPC-Web 协议: https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md
+//	请求/返回Body由帧组成, 帧格式: flag(1字节) + length(4字节, 大端) + message
+//	flag: 0x00 数据帧, 0x80 trailer帧(内容为 HTTP/1 Header 格式)
+//	application/grpc-web-text 为base64编码后的Body
+// 只支持 UnifiedService.CallService 一元调用, 不支持压缩帧
+const (
+	grpc_web_content_type      = "application/grpc-web"
+	grpc_web_text_content_type = "application/grpc-web-text"
+	grpc_web_default_max_size  = 4 << 20 // 默认最大消息长度, 与grpc服务端默认值一致
+
+	grpc_web_frame_header_len = 5
+	grpc_web_flag_compressed  = 0x01
+	grpc_web_flag_trailer     = 0x80
+)
+
+// s_grpc_web gRPC-Web配置
+type s_grpc_web struct {
+	AllowOrigins   []string // 跨域允许的Origin, "*"为全部允许; 为空则不返回跨域Header
+	MaxMessageSize int      // 最大消息长度, 单位字节; 不填默认4MB
+}
+
+// isGrpcWebRequest 判断是否为gRPC-Web请求(含跨域预检请求)
+func isGrpcWebRequest(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), grpc_web_content_type) {
+		return true
+	}
+	return r.Method == http.MethodOptions && r.URL.Path == HTTPMessage.GrpcMethod_CallService
+}
+
+// WebHandler 处理gRPC-Web请求, 与gRPC请求使用相同的业务CMD透传流程
+func (grpcMsg *GrpcMessage) WebHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	conf := GetApplication().Conf.GetConfig().GrpcWeb
+
+	// 跨域
+	allowed := setGrpcWebCORS(w, r, conf.AllowOrigins)
+	if r.Method == http.MethodOptions {
+		if !allowed {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", http.MethodPost)
+		w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+		w.Header().Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	text := strings.HasPrefix(contentType, grpc_web_text_content_type)
+	w.Header().Set("Content-Type", contentType)
+
+	if r.URL.Path != HTTPMessage.GrpcMethod_CallService {
+		writeGrpcWebStatus(w, text, nil, codes.Unimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+
+	maxSize := conf.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = grpc_web_default_max_size
+	}
+	message, code, err := readGrpcWebMessage(r.Body, text, maxSize)
+	if err != nil {
+		logger.Log().WithFields(logger.Fields{
+			"RemoteAddr": r.RemoteAddr,
+			"URL":        r.URL.String(),
+			"err":        err,
+		}).Warn("grpc-web read message error")
+		writeGrpcWebStatus(w, text, nil, code, err.Error())
+		return
+	}
+
+	req := &GateWayProtos.UnifiedRequest{}
+	if err := protoV2.Unmarshal(message, req); err != nil {
+		writeGrpcWebStatus(w, text, nil, codes.InvalidArgument, "grpc-web unmarshal request error: "+err.Error())
+		return
+	}
+
+	ctx, cancel, err := grpcWebContext(r)
+	if err != nil {
+		writeGrpcWebStatus(w, text, nil, codes.InvalidArgument, err.Error())
+		return
+	}
+	defer cancel()
+
+	resp := grpcMsg.callBusiness(ctx, HTTPMessage.Protocol_GrpcWeb, req)
+	data, err := protoV2.Marshal(resp)
+	if err != nil {
+		writeGrpcWebStatus(w, text, nil, codes.Internal, "grpc-web marshal response error: "+err.Error())
+		return
+	}
+	writeGrpcWebStatus(w, text, data, codes.OK, "")
+}
+
+// setGrpcWebCORS 设置跨域Header, 返回Origin是否允许
+func setGrpcWebCORS(
+	w http.ResponseWriter,
+	r *http.Request,
+	allowOrigins []string,
+) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	for _, allow := range allowOrigins {
+		if allow == "*" || allow == origin {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", "grpc-status, grpc-message")
+			w.Header().Add("Vary", "Origin")
+			return true
+		}
+	}
+	return false
+}
+
+// readGrpcWebMessage 读取请求Body中的数据帧, 失败时返回对应的grpc错误码
+func readGrpcWebMessage(
+	body io.Reader,
+	text bool,
+	maxSize int,
+) ([]byte, codes.Code, error) {
+	if text {
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	// 多读1字节, 用于判断是否超出长度限制
+	payload, err := ioutil.ReadAll(io.LimitReader(body, int64(grpc_web_frame_header_len+maxSize+1)))
+	if err != nil {
+		return nil, codes.InvalidArgument, fmt.Errorf("grpc-web read body error: %v", err)
+	}
+	if len(payload) < grpc_web_frame_header_len {
+		return nil, codes.InvalidArgument, fmt.Errorf("grpc-web frame too short")
+	}
+
+	flag := payload[0]
+	length := binary.BigEndian.Uint32(payload[1:grpc_web_frame_header_len])
+	if flag&grpc_web_flag_compressed != 0 {
+		return nil, codes.Unimplemented, fmt.Errorf("grpc-web compressed message not supported")
+	}
+	if flag&grpc_web_flag_trailer != 0 {
+		return nil, codes.InvalidArgument, fmt.Errorf("grpc-web request frame flag invalid")
+	}
+	if uint64(length) > uint64(maxSize) {
+		return nil, codes.ResourceExhausted, fmt.Errorf("grpc-web message larger than max (%d vs. %d)", length, maxSize)
+	}
+	if len(payload)-grpc_web_frame_header_len != int(length) {
+		return nil, codes.InvalidArgument, fmt.Errorf("grpc-web frame length mismatch")
+	}
+	return payload[grpc_web_frame_header_len:], codes.OK, nil
+}
+
+// grpcWebContext 将请求Header转为metadata, RemoteAddr转为peer, 并设置调用方超时(grpc-timeout)
+func grpcWebContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	md := metadata.MD{}
+	for k, vals := range r.Header {
+		k = strings.ToLower(k)
+		switch k {
+		case "content-type", "content-length", "grpc-timeout":
+			continue
+		}
+		md[k] = vals
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: strAddr(r.RemoteAddr)})
+
+	if val := r.Header.Get("grpc-timeout"); val != "" {
+		timeout, err := parseGrpcTimeout(val)
+		if err != nil {
+			return nil, nil, err
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, cancel, nil
+}
+
+// parseGrpcTimeout 解析grpc-timeout, 格式: 最多8位数字 + 单位(H/M/S/m/u/n)
+func parseGrpcTimeout(val string) (time.Duration, error) {
+	if len(val) < 2 || len(val) > 9 {
+		return 0, fmt.Errorf("grpc-timeout invalid: %s", val)
+	}
+	n, err := strconv.ParseInt(val[:len(val)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("grpc-timeout invalid: %s", val)
+	}
+	var unit time.Duration
+	switch val[len(val)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, fmt.Errorf("grpc-timeout invalid: %s", val)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// writeGrpcWebStatus 写回数据帧(data为nil则不写)及trailer帧
+func writeGrpcWebStatus(
+	w http.ResponseWriter,
+	text bool,
+	data []byte,
+	code codes.Code,
+	msg string,
+) {
+	var buf bytes.Buffer
+	if data != nil {
+		writeGrpcWebFrame(&buf, 0, data)
+	}
+	trailer := "grpc-status: " + strconv.Itoa(int(code)) + "\r\n" +
+		"grpc-message: " + encodeGrpcMessage(msg) + "\r\n"
+	writeGrpcWebFrame(&buf, grpc_web_flag_trailer, []byte(trailer))
+
+	w.WriteHeader(http.StatusOK)
+	if text {
+		w.Write([]byte(base64.StdEncoding.EncodeToString(buf.Bytes())))
+	} else {
+		w.Write(buf.Bytes())
+	}
+}
+
+func writeGrpcWebFrame(buf *bytes.Buffer, flag byte, data []byte) {
+	var header [grpc_web_frame_header_len]byte
+	header[0] = flag
+	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
+	buf.Write(header[:])
+	buf.Write(data)
+}
+
+// encodeGrpcMessage 按grpc协议对grpc-message做百分号编码
+func encodeGrpcMessage(msg string) string {
+	var builder strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			builder.WriteByte(c)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", c)
+		}
+	}
+	return builder.String()
+}
+
+// strAddr 以字符串表示的网络地址
+type strAddr string
+
+func (a strAddr) Network() string { return "tcp" }
+func (a strAddr) String() string  { return string(a) }
@@ -3,7 +3,11 @@ package HTTPMessage
 import (
 	"GateWayCommon/AddrLimiter"
 	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/Metrics"
+	"GateWayCommon/RateLimiter"
 	"GateWayCommon/RegisterCenter"
+	"GateWayCommon/ResponseCache"
+	"GateWayCommon/Tracing"
 	"GateWayCommon/jsonpb"
 	"GateWayCommon/logger"
 	"bytes"
@@ -22,48 +26,6 @@ import (
 	protoV2 "google.golang.org/protobuf/proto"
 )
 
-// Strval 获取变量的字符串值
-// 浮点型 3.0将会转换成字符串3, "3"
-// 非数值或字符类型的变量将会被转换成JSON格式字符串
-func val2str(value interface{}) string {
-	if value == nil {
-		return ""
-	}
-	switch value.(type) {
-	case float64:
-		return strconv.FormatFloat(value.(float64), 'f', -1, 64)
-	case float32:
-		return strconv.FormatFloat(float64(value.(float32)), 'f', -1, 64)
-	case int:
-		return strconv.Itoa(value.(int))
-	case uint:
-		return strconv.Itoa(int(value.(uint)))
-	case int8:
-		return strconv.Itoa(int(value.(int8)))
-	case uint8:
-		return strconv.Itoa(int(value.(uint8)))
-	case int16:
-		return strconv.Itoa(int(value.(int16)))
-	case uint16:
-		return strconv.Itoa(int(value.(uint16)))
-	case int32:
-		return strconv.Itoa(int(value.(int32)))
-	case uint32:
-		return strconv.Itoa(int(value.(uint32)))
-	case int64:
-		return strconv.FormatInt(value.(int64), 10)
-	case uint64:
-		return strconv.FormatUint(value.(uint64), 10)
-	case string:
-		return value.(string)
-	case []byte:
-		return string(value.([]byte))
-	default:
-		newValue, _ := json.Marshal(value)
-		return string(newValue)
-	}
-}
-
 // 获取正在运行的函数名
 func get_func_name() string {
 	pc := make([]uintptr, 1)
@@ -73,32 +35,6 @@ func get_func_name() string {
 	return name
 }
 
-// Convert json to map[string]string
-func json2KVMap(byte_json []byte) (map[string]string, error) {
-	// json 2 map[string]interface{}
-	kimap := make(map[string]interface{})
-	if err := json.Unmarshal(byte_json, &kimap); err != nil {
-		return nil, err
-	}
-
-	// map[string]interface{} 2 map[string]string
-	kvmap := make(map[string]string)
-	for k, v := range kimap {
-		kvmap[k] = val2str(v)
-	}
-	return kvmap, nil
-}
-
-func getQueryKVMap(r *http.Request) map[string]string {
-	// 从Query读取数据
-	var kvmap map[string]string = make(map[string]string)
-	query_values := r.URL.Query()
-	for k, v := range query_values {
-		kvmap[k] = v[0]
-	}
-	return kvmap
-}
-
 // func getFormKVMap(r *http.Request) map[string]string {
 // 	// 从Form读取数据
 // 	var kvmap map[string]string = make(map[string]string)
@@ -108,53 +44,44 @@ func getQueryKVMap(r *http.Request) map[string]string {
 // 	return kvmap
 // }
 
-func read_body(r *http.Request) []byte {
-	body, _ := ioutil.ReadAll(r.Body)
-	r.Body.Close() //  must close
-	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
-	return body
-}
-
-func getBodyKVMap(r *http.Request) (map[string]string, error) {
-	// 读取body, 将Json数据转为 kvMap
-	kvmap, err := json2KVMap(read_body(r))
+// read_body 读取请求Body(解压后), 读取后重置Body, 可重复读取
+func read_body(r *http.Request) ([]byte, error) {
+	body, err := readRequestBody(r)
 	if err != nil {
 		return nil, err
 	}
-	return kvmap, nil
-}
-
-func getKVMap(r *http.Request, pt string) (map[string]string, error) {
-	if pt == "query" {
-		return getQueryKVMap(r), nil
-	} else if pt == "body" {
-		return getBodyKVMap(r)
-	} else {
-		return nil, errors.New("ParamType not support, check gateway code.")
-	}
+	// 已解压, 再次读取时不再解压
+	r.Header.Del("Content-Encoding")
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+	return body, nil
 }
 
 // HTTPMessage Json Response
 type jsonResponse struct {
-	Code int32       `json:"code"`
-	Msg  string      `json:"msg"`
-	Dur  float64     `json:"dur"`
-	Data interface{} `json:"data"`
+	Code        int32       `json:"code"`
+	Msg         string      `json:"msg"`
+	Dur         float64     `json:"dur"`
+	RequestId   string      `json:"request_id,omitempty"`   // 请求ID, 同 X-Request-Id
+	GroundRules bool        `json:"ground_rules,omitempty"` // 是否为兜底返回
+	Cache       string      `json:"cache,omitempty"`        // 缓存状态: hit/miss/stale, 未启用缓存为空
+	Data        interface{} `json:"data"`
 }
 type emptyData struct{}
 
-// pb2json_raw 将Proto结构编码为 json.RawMessage
+// 默认Json选项: 枚举为数值, 输出默认值, 使用proto字段名
+var default_json_marshaler = newJsonMarshaler(RouteJson{})
+
+// pb2json_raw 将Proto结构编码为 json.RawMessage, marshaler为nil时使用默认选项
 func pb2jsonRaw(
 	protoMessage protoV2.Message,
+	marshaler *jsonpb.Marshaler,
 ) (json.RawMessage, error) {
-	jsonpbMarshaler := &jsonpb.Marshaler{
-		EnumsAsInts:  true, // 是否将枚举值设定为整数，而不是字符串类型
-		EmitDefaults: true, // 是否将字段值为空的渲染到JSON结构中
-		OrigName:     true, // 是否使用原生的proto协议中的字段
+	if marshaler == nil {
+		marshaler = default_json_marshaler
 	}
 
 	// ProtoV2 to ProtoV1 to json.RawMessage
-	data, err := jsonpbMarshaler.MarshalToString(proto.MessageV1(protoMessage))
+	data, err := marshaler.MarshalToString(proto.MessageV1(protoMessage))
 	if err != nil {
 		return nil, err
 	}
@@ -172,18 +99,25 @@ func responseJson(
 	st time.Time,
 	data interface{},
 ) {
-	dur := time.Since(st).Seconds()
-	jsonResponse := &jsonResponse{
+	writeJsonResponse(w, header, &jsonResponse{
 		Code: code,
 		Msg:  msg,
-		Dur:  dur,
+		Dur:  time.Since(st).Seconds(),
 		Data: data,
-	}
+	})
+}
 
+// writeJsonResponse 将jsonResponse编码后写回
+func writeJsonResponse(
+	w http.ResponseWriter,
+	header int,
+	jsonResponse *jsonResponse,
+) {
 	// Data应保证不为nil, 否则返回的Json不符合要求.
 	if jsonResponse.Data == nil {
 		jsonResponse.Data = &emptyData{}
 	}
+	jsonResponse.RequestId = w.Header().Get(header_request_id)
 
 	response, err := json.Marshal(jsonResponse)
 	if err != nil {
@@ -194,61 +128,166 @@ func responseJson(
 		return
 	}
 
+	w.Header().Set("Content-Type", content_type_json)
 	w.Header().Set("header", strconv.Itoa(header))
 	w.WriteHeader(header)
 	w.Write(response)
 }
 
-// responseError 返回Json结构
+// writeResponse 按返回格式将jsonResponse编码后写回, msgpack编码失败时返回Json
+//	protobuf 没有对应的返回结构, 返回Json并通过Header返回code
+func writeResponse(
+	w http.ResponseWriter,
+	header int,
+	format string,
+	jsonResponse *jsonResponse,
+) {
+	if format == format_protobuf {
+		w.Header().Set(header_result_code, strconv.Itoa(int(jsonResponse.Code)))
+	}
+	if format != format_msgpack {
+		writeJsonResponse(w, header, jsonResponse)
+		return
+	}
+
+	if jsonResponse.Data == nil {
+		jsonResponse.Data = &emptyData{}
+	}
+	jsonResponse.RequestId = w.Header().Get(header_request_id)
+	data, err := json.Marshal(jsonResponse)
+	if err == nil {
+		data, err = json2msgpack(data)
+	}
+	if err != nil {
+		writeJsonResponse(w, header, jsonResponse)
+		return
+	}
+	w.Header().Set("Content-Type", content_type_msgpack)
+	w.Header().Set("header", strconv.Itoa(header))
+	w.WriteHeader(header)
+	w.Write(data)
+}
+
+// responseError 按返回格式返回错误信息
 func responseError(
 	w http.ResponseWriter,
 	header int,
+	format string,
 	code int32,
 	msg string,
 	st time.Time,
 ) {
-	responseJson(w, header, code, msg, st, &emptyData{})
+	writeResponse(w, header, format, &jsonResponse{
+		Code: code,
+		Msg:  msg,
+		Dur:  time.Since(st).Seconds(),
+		Data: &emptyData{},
+	})
 }
 
-// responseProto 将Proto结构作为data返回
-func responseProto(
+// responseResult 返回下级服务结果, cache为缓存状态, 未启用缓存为空
+func responseResult(
 	w http.ResponseWriter,
-	header int,
+	format string,
 	code int32,
-	msg string,
+	st time.Time,
+	data json.RawMessage,
+	cache string,
+) {
+	if cache != "" {
+		w.Header().Set(header_cache, cache)
+	}
+	writeResponse(w, http.StatusOK, format, &jsonResponse{
+		Code:  code,
+		Msg:   "ok",
+		Dur:   time.Since(st).Seconds(),
+		Cache: cache,
+		Data:  data,
+	})
+}
+
+// responseProtobuf 直接返回下级服务的Proto编码, code及缓存状态通过Header返回
+func responseProtobuf(
+	w http.ResponseWriter,
+	code int32,
+	data []byte,
+	cache string,
+) {
+	if cache != "" {
+		w.Header().Set(header_cache, cache)
+	}
+	w.Header().Set("Content-Type", content_type_protobuf)
+	w.Header().Set(header_result_code, strconv.Itoa(int(code)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// responseGroundRules 返回兜底结果, 以ground_rules字段及Header标识
+func responseGroundRules(
+	w http.ResponseWriter,
+	format string,
+	marshaler *jsonpb.Marshaler,
 	st time.Time,
 	data protoV2.Message,
 ) {
-	if data == nil {
-		responseJson(w, header, code, msg, st, &emptyData{})
+	if format == format_protobuf {
+		pb_data, err := protoV2.Marshal(data)
+		if err != nil {
+			header := http.StatusInternalServerError
+			result := int32(GateWayProtos.ResultType_ERR_Encode_Response)
+			responseError(w, header, format, result, err.Error(), st)
+			return
+		}
+		w.Header().Set(header_ground_rules, "1")
+		responseProtobuf(w, int32(GateWayProtos.ResultType_OK), pb_data, "")
 		return
 	}
 
-	json_raw, err := pb2jsonRaw(data)
+	json_raw, err := pb2jsonRaw(data, marshaler)
 	if err != nil {
-		header = http.StatusInternalServerError
+		header := http.StatusInternalServerError
 		result := int32(GateWayProtos.ResultType_ERR_Encode_Response)
-		responseError(w, header, result, err.Error(), st)
+		responseError(w, header, format, result, err.Error(), st)
 		return
 	}
-	responseJson(w, header, code, msg, st, json_raw)
+
+	w.Header().Set(header_ground_rules, "1")
+	writeResponse(w, http.StatusOK, format, &jsonResponse{
+		Code:        int32(GateWayProtos.ResultType_OK),
+		Msg:         "ground_rules",
+		Dur:         time.Since(st).Seconds(),
+		GroundRules: true,
+		Data:        json_raw,
+	})
 }
 
 type requestParam struct {
-	FuncName    string `json:"func_name,omitempty"`    // 请求来源函数
-	Method      string `json:"method,omitempty"`       // 允许请求方法
-	ParamType   string `json:"param_type,omitempty"`   // 读取参数类型
-	ServiceType int32  `json:"service_type,omitempty"` // 服务类型
-	CMD         int32  `json:"cmd,omitempty"`          // 服务接口
+	FuncName    string   `json:"func_name,omitempty"`    // 请求来源函数
+	Methods     []string `json:"methods,omitempty"`      // 允许请求方法
+	ParamType   string   `json:"param_type,omitempty"`   // 读取参数类型
+	ServiceType int32    `json:"service_type,omitempty"` // 服务类型
+	CMD         int32    `json:"cmd,omitempty"`          // 服务接口
 }
 
 // Token校验 - API Token Check 版本
 type CheckToken int
 
 const (
-	CheckToken_None CheckToken = 0
+	CheckToken_None   CheckToken = 0 // 不校验
+	CheckToken_APIKey CheckToken = 1 // 静态API Key
+	CheckToken_HMAC   CheckToken = 2 // HMAC签名, 时间戳+nonce防重放
+	CheckToken_JWT    CheckToken = 3 // JWT
 )
 
+// Token校验版本 名称->版本
+var checkTokenValue = map[string]CheckToken{
+	"":        CheckToken_None,
+	"none":    CheckToken_None,
+	"api_key": CheckToken_APIKey,
+	"hmac":    CheckToken_HMAC,
+	"jwt":     CheckToken_JWT,
+}
+
 // 负载均衡策略 - Load Balancing Policy
 type LBPolicy string
 
@@ -258,23 +297,34 @@ const (
 	LBPolicy_ConsistentHash LBPolicy = LBPolicy(RegisterCenter.PickType_ConsistentHash)
 )
 
-// 兜底函数, 成功返回nil, 失败返回错误信息
-type GroundRulesFunc func() error
+// 兜底函数, 根据请求Proto生成兜底返回Proto, 失败返回错误信息
+type GroundRulesFunc func(cmd int32, request protoV2.Message) (protoV2.Message, error)
 
-// 获取负载均衡Key函数
-type GetLBKeyFunc func() string
+// 获取负载均衡Key函数, request为解析后的请求Proto(可能为nil)
+type GetLBKeyFunc func(r *http.Request, request protoV2.Message) string
 
 type requestOption struct {
 	Timeout       int64           `json:"timeout,omitempty"`        // 超时时间, 单位ms; 默认3s超时
+	MaxBodySize   int64           `json:"max_body_size,omitempty"`  // 请求Body最大长度, 0为全局配置
 	CheckToken    CheckToken      `json:"check_token,omitempty"`    // Token校验
-	CheckIP       bool            `json:"check_ip,omitempty"`       // IP白名单校验
+	TokenScope    string          `json:"token_scope,omitempty"`    // Token需具备的Scope
+	CheckIP       string          `json:"check_ip,omitempty"`       // IP名单校验, 为空不校验
+	RateLimitKey  string          `json:"rate_limit_key,omitempty"` // 路由限流Key
 	LBPolicy      LBPolicy        `json:"lb_policy,omitempty"`      // 负载均衡策略
+	Semver        string          `json:"semver,omitempty"`         // 下级服务版本约束
 	GroundRules   bool            `json:"ground_rules,omitempty"`   // 启用兜底方案
+	Cache         bool            `json:"cache,omitempty"`          // 启用返回结果缓存
+	Msgpack       bool            `json:"msgpack,omitempty"`        // 支持msgpack返回
 	RequestProto  protoV2.Message `json:"request_proto,omitempty"`  // 请求Proto
 	ResponseProto protoV2.Message `json:"response_proto,omitempty"` // 返回Proto, nil为Json返回
 
 	groundRulesFunc GroundRulesFunc
 	getLBKeyFunc    GetLBKeyFunc
+	rateLimiter     *RateLimiter.KeyedLimiter
+	responseCache   *ResponseCache.Cache
+	cacheKeyFields  []string
+	validator       *requestValidator
+	jsonMarshaler   *jsonpb.Marshaler
 }
 
 type RequestOption interface {
@@ -300,7 +350,7 @@ func defaultOptions() *requestOption {
 	return &requestOption{
 		Timeout:         3000,                // 默认3s超时
 		CheckToken:      CheckToken_None,     // Token校验方案
-		CheckIP:         false,               // 校验请求来源IP
+		CheckIP:         "",                  // 校验请求来源IP
 		LBPolicy:        LBPolicy_RandWeight, // 默认使用随机负载均衡
 		GroundRules:     false,               // 默认不启用兜底方案
 		groundRulesFunc: nil,                 // 兜底方案
@@ -317,27 +367,76 @@ func withTimeout(timeout int64) RequestOption {
 	})
 }
 
-// // 检查token
-// func withCheckToken(version CheckToken) RequestOption {
-// 	return newFuncOption(func(o *requestOption) {
-// 		o.CheckToken = version
-// 	})
-// }
+// withMaxBodySize 请求Body最大长度, 单位字节
+func withMaxBodySize(size int64) RequestOption {
+	return newFuncOption(func(o *requestOption) {
+		o.MaxBodySize = size
+	})
+}
 
-// // 检查请求来源IP地址在白名单中
-// func withCheckIP() RequestOption {
-// 	return newFuncOption(func(o *requestOption) {
-// 		o.CheckIP = true
-// 	})
-// }
+// 检查token, scope为空则只校验token有效
+func withCheckToken(version CheckToken, scope string) RequestOption {
+	return newFuncOption(func(o *requestOption) {
+		o.CheckToken = version
+		o.TokenScope = scope
+	})
+}
 
-// // 请求负载均衡策略
-// func withLBPolicy(p LBPolicy, f GetLBKeyFunc) RequestOption {
-// 	return newFuncOption(func(o *requestOption) {
-// 		o.LBPolicy = p
-// 		o.getLBKeyFunc = f
-// 	})
-// }
+// 检查请求来源IP地址通过名单校验, 名单在AddrLimiter中配置
+func withCheckIP(listName string) RequestOption {
+	return newFuncOption(func(o *requestOption) {
+		o.CheckIP = listName
+	})
+}
+
+// 路由限流, key为限流Key(为空为整个路由, ip/token, 其他为请求字段名)
+func withRateLimit(limiter *RateLimiter.KeyedLimiter, key string) RequestOption {
+	return newFuncOption(func(o *requestOption) {
+		o.rateLimiter = limiter
+		o.RateLimitKey = key
+	})
+}
+
+// 返回结果缓存, keyFields为缓存Key字段(为空则使用整个请求)
+func withResponseCache(cache *ResponseCache.Cache, keyFields []string) RequestOption {
+	return newFuncOption(func(o *requestOption) {
+		if cache != nil {
+			o.Cache = true
+			o.responseCache = cache
+			o.cacheKeyFields = keyFields
+		}
+	})
+}
+
+// 返回格式选项, Json选项只对Proto返回生效
+func withResponseFormat(jsonConf RouteJson, msgpack bool) RequestOption {
+	return newFuncOption(func(o *requestOption) {
+		o.jsonMarshaler = newJsonMarshaler(jsonConf)
+		o.Msgpack = msgpack
+	})
+}
+
+// 请求字段校验
+func withValidator(validator *requestValidator) RequestOption {
+	return newFuncOption(func(o *requestOption) {
+		o.validator = validator
+	})
+}
+
+// 请求负载均衡策略
+func withLBPolicy(p LBPolicy, f GetLBKeyFunc) RequestOption {
+	return newFuncOption(func(o *requestOption) {
+		o.LBPolicy = p
+		o.getLBKeyFunc = f
+	})
+}
+
+// 下级服务版本约束, 如: ">=1.2.0, <2.0.0"
+func withSemver(constraint string) RequestOption {
+	return newFuncOption(func(o *requestOption) {
+		o.Semver = constraint
+	})
+}
 
 // 发送请求Proto
 func withRequestProto(proto protoV2.Message) RequestOption {
@@ -353,14 +452,15 @@ func withResponseProto(proto protoV2.Message) RequestOption {
 	})
 }
 
-// func withGroundRules(f GroundRulesFunc) RequestOption {
-// 	return newFuncOption(func(o *requestOption) {
-// 		if f != nil {
-// 			o.GroundRules = true
-// 			o.groundRulesFunc = f
-// 		}
-// 	})
-// }
+// 启用兜底方案, 下级服务调用失败时由f生成返回结果
+func withGroundRules(f GroundRulesFunc) RequestOption {
+	return newFuncOption(func(o *requestOption) {
+		if f != nil {
+			o.GroundRules = true
+			o.groundRulesFunc = f
+		}
+	})
+}
 
 // GetClientIP 获取HTTP请求真实客户端IP地址
 //	X-Real-IP:
@@ -373,30 +473,52 @@ func withResponseProto(proto protoV2.Message) RequestOption {
 //		包含客户端的'真实IP地址',
 //		这是Web服务器从其接收连接并将响应发送到的实际物理IP地址.
 //		如果客户端通过代理连接, 它将提供'代理的IP地址'.
+//	P.s> Header可以被客户端伪造, 只有RemoteAddr为可信代理时才读取Header;
+//		X-Forwarded-For 从右向左跳过可信代理, 取第一个非可信代理的地址.
 func GetClientIP(r *http.Request) (string, error) {
-	ip := r.Header.Get("X-Real-IP")
+	remote_ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(remote_ip) == nil {
+		return "", errors.New("no valid ip found")
+	}
+	if !AddrLimiter.IsTrustedProxy(remote_ip) {
+		return remote_ip, nil
+	}
+
+	ip := strings.TrimSpace(r.Header.Get("X-Real-IP"))
 	if net.ParseIP(ip) != nil {
 		return ip, nil
 	}
 
-	xff := r.Header.Get("X-Forwarded-For")
-	for _, xff_ip := range strings.Split(xff, ",") {
-		i := strings.TrimSpace(xff_ip)
-		if net.ParseIP(i) != nil {
-			return i, nil
+	xff_list := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	first_ip := ""
+	for i := len(xff_list) - 1; i >= 0; i-- {
+		xff_ip := strings.TrimSpace(xff_list[i])
+		if net.ParseIP(xff_ip) == nil {
+			break
 		}
+		if !AddrLimiter.IsTrustedProxy(xff_ip) {
+			return xff_ip, nil
+		}
+		first_ip = xff_ip
 	}
-
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return "", err
+	// 全部为可信代理, 取最左侧地址
+	if first_ip != "" {
+		return first_ip, nil
 	}
+	return remote_ip, nil
+}
 
-	if net.ParseIP(ip) != nil {
-		return ip, nil
+// methodAllowed 判断请求方法是否在允许列表中
+func methodAllowed(method string, methods []string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
 	}
-
-	return "", errors.New("no valid ip found")
+	return false
 }
 
 func (httpMsg *HttpMessage) common_request_v3(
@@ -418,112 +540,143 @@ func (httpMsg *HttpMessage) common_request_v3(
 		header := http.StatusInternalServerError
 		code := int32(GateWayProtos.ResultType_ERR_Unknown)
 		err := errors.New("http.r or httpMsg.RegCenter or req_param is nil")
-		responseError(w, header, code, err.Error(), st)
+		responseError(w, header, format_json, code, err.Error(), st)
 		return err
 	}
 
+	// 请求ID, 用于日志及返回
+	rc := newRequestContext(w, r, req_param, req_opts)
+
+	// 根据Accept选择返回格式, 错误信息同样按该格式返回
+	format := negotiateFormat(r.Header.Get("Accept"), req_opts)
+	w.Header().Add("Vary", "Accept")
+
 	// 检查请求类型是否满足
-	if r.Method != req_param.Method {
+	if !methodAllowed(r.Method, req_param.Methods) {
 		header := http.StatusMethodNotAllowed
 		code := int32(GateWayProtos.ResultType_ERR_Decode_Request)
 		msg := "method not allowed"
-		logger.Log().WithFields(logger.Fields{
-			"http.Request": logger.Fields{
-				"Header": r.Header,
-				"Method": r.Method,
-				"Host":   r.Host,
-				"URL":    r.URL.String(),
-			},
-			"req.param": req_param,
-			"req.opts":  req_opts,
+		rc.log().WithFields(logger.Fields{
+			"http.Header": r.Header,
 		}).Warn(msg)
-		responseError(w, header, code, msg, st)
+		responseError(w, header, format, code, msg, st)
 		return errors.New(msg)
 	}
 
 	// 获取客户端真实IP地址
 	client_ip, err := GetClientIP(r)
+	rc.ClientIP = client_ip
 	if err != nil {
 		header := http.StatusBadRequest
 		code := int32(GateWayProtos.ResultType_ERR_Decode_Request)
-		logger.Log().WithFields(logger.Fields{
-			"http.Request": logger.Fields{
-				"ClientIP": client_ip,
-				"Method":   r.Method,
-				"Host":     r.Host,
-				"URL":      r.URL.String(),
-				"Header":   r.Header, // ip 获取失败, 打印Header, 方便查日志
-			},
-			"req.param": req_param,
-			"req.opts":  req_opts,
+		rc.log().WithFields(logger.Fields{
+			"http.Header": r.Header, // ip 获取失败, 打印Header, 方便查日志
 		}).Warn(err)
-		responseError(w, header, code, err.Error(), st)
+		responseError(w, header, format, code, err.Error(), st)
 		return err
 	}
 
-	// ip 白名单校验
-	if req_opts.CheckIP {
-		if check, err := AddrLimiter.IPEnable(client_ip); !check {
+	// ip 名单校验
+	if req_opts.CheckIP != "" {
+		if check, err := AddrLimiter.ListEnable(req_opts.CheckIP, client_ip); !check {
 			header := http.StatusForbidden
+			code := int32(GateWayProtos.ResultType_ERR_Forbidden)
+			rc.log().WithFields(logger.Fields{
+				"http.Header": r.Header, // ip 校验不通过的情况下, 打印Header, 方便查日志
+			}).Warn(err)
+			responseError(w, header, format, code, err.Error(), st)
+			return err
+		}
+	}
+
+	// 请求Body长度限制, Content-Length超出直接返回, 否则读取时校验
+	if req_opts.MaxBodySize > 0 && r.Body != nil {
+		if r.ContentLength > req_opts.MaxBodySize {
+			header := http.StatusRequestEntityTooLarge
 			code := int32(GateWayProtos.ResultType_ERR_Decode_Request)
-			logger.Log().WithFields(logger.Fields{
-				"http.Request": logger.Fields{
-					"ClientIP": client_ip,
-					"Method":   r.Method,
-					"Host":     r.Host,
-					"URL":      r.URL.String(),
-					"Header":   r.Header, // ip 校验不通过的情况下, 打印Header, 方便查日志
-				},
-				"req.param": req_param,
-				"req.opts":  req_opts,
+			rc.log().WithFields(logger.Fields{
+				"http.ContentLength": r.ContentLength,
+			}).Warn(ErrBodyTooLarge)
+			responseError(w, header, format, code, ErrBodyTooLarge.Error(), st)
+			return ErrBodyTooLarge
+		}
+		r.Body = newLimitedBody(r.Body, req_opts.MaxBodySize)
+	}
+
+	// token 校验
+	token_name := ""
+	if req_opts.CheckToken != CheckToken_None {
+		identity, header, err := checkToken(r, req_opts)
+		if err != nil {
+			code := tokenResultCode(header)
+			rc.log().WithFields(logger.Fields{
+				"identity": identity,
 			}).Warn(err)
-			responseError(w, header, code, err.Error(), st)
+			responseError(w, header, format, code, err.Error(), st)
 			return err
 		}
+		token_name = identity.Type + ":" + identity.Name
 	}
 
-	// 根据参数类型获取kvMap
-	kvMap, err := getKVMap(r, req_param.ParamType)
-	if err != nil {
-		header := http.StatusInternalServerError
-		code := int32(GateWayProtos.ResultType_ERR_Decode_Request)
-		logger.Log().WithFields(logger.Fields{
-			"http.Request": logger.Fields{
-				"ClientIP": client_ip,
-				"Method":   r.Method,
-				"Host":     r.Host,
-				"URL":      r.URL.String(),
-			},
-			"req.param": req_param,
-			"req.opts":  req_opts,
-		}).Error(err)
-		responseError(w, header, code, err.Error(), st)
-		return err
+	// 全局限流, 在IP/Token校验之后, 未通过校验的请求不占用全局配额
+	if !RateLimiter.AllowGlobal() {
+		rc.log().Warn("rate limit global")
+		responseRateLimit(w, format, req_param, rate_limit_scope_global, st)
+		return errors.New("rate limit global")
 	}
 
-	// kvMap 转换为 proto 转换为 []byte
+	// 根据参数类型将请求解析为 proto 转换为 []byte
 	// P.s> 如果 RequestProto 为nil, 说明没有请求Proto
 	var request []byte
 	if req_opts.RequestProto != nil {
-		request, err = kvMap2pb(kvMap, req_opts.RequestProto)
+		_, decode_span := Tracing.Start(r.Context(), "Decode", Tracing.SpanKind_Internal)
+		request, err = decodeRequest(r, req_param.ParamType, req_opts.RequestProto, req_opts.validator, rc.RequestId)
 		if err != nil {
-			header := http.StatusInternalServerError
+			decode_span.SetError(err)
+		}
+		decode_span.End()
+		rc.setParamRequestId(getRequestId(req_opts.RequestProto.ProtoReflect()))
+		if err != nil {
+			header := http.StatusBadRequest
+			if errors.Is(err, ErrBodyTooLarge) {
+				header = http.StatusRequestEntityTooLarge
+			}
 			code := int32(GateWayProtos.ResultType_ERR_Decode_Request)
-			logger.Log().WithFields(logger.Fields{
-				"http.Request": logger.Fields{
-					"ClientIP": client_ip,
-					"Method":   r.Method,
-					"Host":     r.Host,
-					"URL":      r.URL.String(),
-				},
-				"req.param": req_param,
-				"req.opts":  req_opts,
-			}).Error(err)
-			responseError(w, header, code, err.Error(), st)
+			rc.log().Warn(err)
+			// 校验错误返回全部不通过的字段
+			if verr, ok := err.(*ValidationError); ok {
+				writeResponse(w, header, format, &jsonResponse{
+					Code: code,
+					Msg:  "request validation failed",
+					Dur:  time.Since(st).Seconds(),
+					Data: verr,
+				})
+			} else {
+				responseError(w, header, format, code, err.Error(), st)
+			}
 			return err
 		}
 	}
 
+	// 路由限流
+	if req_opts.rateLimiter != nil {
+		key := rateLimitKey(r, req_opts.RateLimitKey, client_ip, token_name, req_opts.RequestProto)
+		if !req_opts.rateLimiter.Allow(key) {
+			rc.log().WithFields(logger.Fields{
+				"rate_limit_key": key,
+			}).Warn("rate limit route")
+			responseRateLimit(w, format, req_param, rate_limit_scope_route, st)
+			return errors.New("rate limit route")
+		}
+	}
+
+	// 下级服务接口限流
+	if !RateLimiter.AllowCMD(req_param.CMD) {
+		rc.log().Warn("rate limit cmd")
+		responseRateLimit(w, format, req_param, rate_limit_scope_cmd, st)
+		return errors.New("rate limit cmd")
+	}
+
 	// 设置超时时间, 如果设置为0标识不超时
 	var ctx context.Context
 	var cancel context.CancelFunc
@@ -536,129 +689,129 @@ func (httpMsg *HttpMessage) common_request_v3(
 	defer cancel()
 
 	// 设置负载均衡方案
+	data := make(map[string]string)
 	if req_opts.LBPolicy == LBPolicy_ConsistentHash ||
 		req_opts.LBPolicy == LBPolicy_SpecifyAddr {
 		if req_opts.getLBKeyFunc == nil {
 			header := http.StatusInternalServerError
 			code := int32(GateWayProtos.ResultType_ERR_Decode_Request)
 			msg := "get load balancer key failed"
-			logger.Log().WithFields(logger.Fields{
-				"http.Request": logger.Fields{
-					"ClientIP": client_ip,
-					"Method":   r.Method,
-					"Host":     r.Host,
-					"URL":      r.URL.String(),
-				},
-				"req.param": req_param,
-				"req.opts":  req_opts,
-			}).Warn(msg)
-			responseError(w, header, code, msg, st)
+			rc.log().Warn(msg)
+			responseError(w, header, format, code, msg, st)
 			return errors.New(msg)
 		}
 
-		data := make(map[string]string)
 		data[RegisterCenter.Param_PickType] = string(req_opts.LBPolicy)
-		data[RegisterCenter.Param_PickParam] = req_opts.getLBKeyFunc()
+		data[RegisterCenter.Param_PickParam] = req_opts.getLBKeyFunc(r, req_opts.RequestProto)
+	}
+
+	// 设置下级服务版本约束
+	if req_opts.Semver != "" {
+		data[RegisterCenter.Param_Semver] = req_opts.Semver
+	}
+	if len(data) > 0 {
 		ctx = RegisterCenter.BuildCtxFilter(ctx, data)
 	}
+	ctx = rc.outgoing(ctx)
 
-	// 发送请求
+	// 发送请求, 启用缓存时优先读取缓存
 	var response []byte
 	var result int32
-	response, result, err = httpMsg.RegCenter.CallService(
-		ctx, req_param.ServiceType, req_param.CMD, request)
+	cache_status := ""
+	if req_opts.responseCache != nil {
+		key := cacheKey(req_param.CMD, req_opts.cacheKeyFields, req_opts.RequestProto, request)
+		response, result, cache_status, err = req_opts.responseCache.Get(ctx, key,
+			httpMsg.cacheLoad(req_param.ServiceType, req_param.CMD, req_opts.RequestProto, request))
+		Metrics.HttpCacheTotal.WithLabelValues(req_param.FuncName, cache_status).Inc()
+	} else {
+		response, result, err = httpMsg.RegCenter.CallService(
+			ctx, req_param.ServiceType, req_param.CMD, request)
+	}
 
 	// 判断返回错误
 	if err != nil {
 		// 启用兜底返回
 		if req_opts.GroundRules && req_opts.groundRulesFunc != nil {
-			if ground_err := req_opts.groundRulesFunc(); ground_err == nil {
+			if ground_resp, ground_err := req_opts.groundRulesFunc(req_param.CMD, req_opts.RequestProto); ground_err == nil {
 				// 统计兜底返回的日志
-				logger.Log().WithFields(logger.Fields{
-					"http.Request": logger.Fields{
-						"ClientIP": client_ip,
-						"Method":   r.Method,
-						"Host":     r.Host,
-						"URL":      r.URL.String(),
-					},
-					"req.param":    req_param,
-					"req.opts":     req_opts,
+				rc.log().WithFields(logger.Fields{
+					"code":         result,
 					"ground_rules": "succ",
 				}).Warn(err)
+				responseGroundRules(w, format, req_opts.jsonMarshaler, st, ground_resp)
 				return nil
+			} else {
+				rc.log().WithFields(logger.Fields{
+					"ground_rules": "failed",
+					"err":          ground_err,
+				}).Error("GroundRules Failed")
 			}
 		}
 
 		header := http.StatusInternalServerError
 		code := result
-		logger.Log().WithFields(logger.Fields{
-			"http.Request": logger.Fields{
-				"ClientIP": client_ip,
-				"Method":   r.Method,
-				"Host":     r.Host,
-				"URL":      r.URL.String(),
-			},
-			"req.param": req_param,
-			"req.opts":  req_opts,
-		}).Error(err)
-		responseError(w, header, code, err.Error(), st)
+		rc.log().Error(err)
+		responseError(w, header, format, code, err.Error(), st)
 		return err
 	}
 
 	// 判断返回结果
 	if result != int32(GateWayProtos.ResultType_OK) {
-		// 启用兜底返回
 		err = errors.New(string(response))
+		// 启用兜底返回
 		if req_opts.GroundRules && req_opts.groundRulesFunc != nil {
-			if ground_err := req_opts.groundRulesFunc(); ground_err == nil {
+			if ground_resp, ground_err := req_opts.groundRulesFunc(req_param.CMD, req_opts.RequestProto); ground_err == nil {
 				// 统计兜底返回的日志
-				logger.Log().WithFields(logger.Fields{
-					"http.Request": logger.Fields{
-						"ClientIP": client_ip,
-						"Method":   r.Method,
-						"Host":     r.Host,
-						"URL":      r.URL.String(),
-					},
-					"req.param":    req_param,
-					"req.opts":     req_opts,
+				rc.log().WithFields(logger.Fields{
+					"code":         result,
 					"ground_rules": "succ",
 				}).Warn(err)
+				responseGroundRules(w, format, req_opts.jsonMarshaler, st, ground_resp)
 				return nil
+			} else {
+				rc.log().WithFields(logger.Fields{
+					"ground_rules": "failed",
+					"err":          ground_err,
+				}).Error("GroundRules Failed")
 			}
 		}
 
 		header := http.StatusOK
 		code := result
-		logger.Log().WithFields(logger.Fields{
-			"http.Request": logger.Fields{
-				"ClientIP": client_ip,
-				"Method":   r.Method,
-				"Host":     r.Host,
-				"URL":      r.URL.String(),
-			},
-			"req.param": req_param,
-			"req.opts":  req_opts,
-			"code":      result,
+		rc.log().WithFields(logger.Fields{
+			"code": result,
 		}).Error(err)
-		responseError(w, header, code, err.Error(), st)
+		responseError(w, header, format, code, err.Error(), st)
 		return err
 	}
 
+	// 编码返回结果
+	_, encode_span := Tracing.Start(r.Context(), "Encode", Tracing.SpanKind_Internal)
+	encode_span.SetAttribute("gateway.format", format)
+	defer encode_span.End()
+
 	// 如果返回Proto为nil, 则说明下级服务采用Json格式返回
 	if req_opts.ResponseProto == nil {
-		logger.Log().WithFields(logger.Fields{
-			"http.Request": logger.Fields{
-				"ClientIP": client_ip,
-				"Method":   r.Method,
-				"Host":     r.Host,
-				"URL":      r.URL.String(),
-			},
-			"req.param": req_param,
-			"req.opts":  req_opts,
-			"code":      result,
-			"data":      response, // 将Response直接作为Json返回
+		rc.log().WithFields(logger.Fields{
+			"code":  result,
+			"data":  response, // 将Response直接作为Json返回
+			"cache": cache_status,
+		}).Debug("ok")
+		responseResult(w, format, result, st, json.RawMessage(response), cache_status)
+		return nil
+	}
+
+	// Proto返回, 直接返回下级服务的编码
+	if format == format_protobuf {
+		rc.log().WithFields(logger.Fields{
+			"code":   result,
+			"cache":  cache_status,
+			"format": format,
 		}).Debug("ok")
-		responseJson(w, http.StatusOK, result, "ok", st, json.RawMessage(response))
+		if string(response) == "ok" { // 针对房间服返回的补丁
+			response = nil
+		}
+		responseProtobuf(w, result, response, cache_status)
 		return nil
 	}
 
@@ -667,37 +820,30 @@ func (httpMsg *HttpMessage) common_request_v3(
 		if err := protoV2.Unmarshal(response, req_opts.ResponseProto); err != nil {
 			code := int32(GateWayProtos.ResultType_ERR_Decode_Response)
 			msg := "ResponseProto Unmarshal Error"
-			logger.Log().WithFields(logger.Fields{
-				"http.Request": logger.Fields{
-					"ClientIP": client_ip,
-					"Method":   r.Method,
-					"Host":     r.Host,
-					"URL":      r.URL.String(),
-				},
-				"req.param": req_param,
-				"req.opts":  req_opts,
-				"code":      code,
-				"err":       err,
+			rc.log().WithFields(logger.Fields{
+				"code": code,
+				"err":  err,
 				// "response":  string(response),
 			}).Error(msg)
-			responseError(w, http.StatusOK, code, msg, st)
+			responseError(w, http.StatusOK, format, code, msg, st)
 			return err
 		}
 	}
 
-	logger.Log().WithFields(logger.Fields{
-		"http.Request": logger.Fields{
-			"ClientIP": client_ip,
-			"Method":   r.Method,
-			"Host":     r.Host,
-			"URL":      r.URL.String(),
-		},
-		"req.param": req_param,
-		"req.opts":  req_opts,
-		"code":      result,
+	rc.log().WithFields(logger.Fields{
+		"code":   result,
+		"cache":  cache_status,
+		"format": format,
 	}).Debug("ok")
 
 	// 返回结果
-	responseProto(w, http.StatusOK, result, "ok", st, req_opts.ResponseProto)
+	json_raw, err := pb2jsonRaw(req_opts.ResponseProto, req_opts.jsonMarshaler)
+	if err != nil {
+		header := http.StatusInternalServerError
+		code := int32(GateWayProtos.ResultType_ERR_Encode_Response)
+		responseError(w, header, format, code, err.Error(), st)
+		return err
+	}
+	responseResult(w, format, result, st, json_raw, cache_status)
 	return nil
 }
@@ -2,9 +2,12 @@ package HTTPMessage
 
 import (
 	_ "AlgoGateWay/GateWay/docs" // swagger docs
+	"GateWayCommon/Metrics"
 	"GateWayCommon/RegisterCenter"
 	"net/http"
 	"net/http/pprof"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	httpSwagger "github.com/swaggo/http-swagger"
@@ -17,6 +20,11 @@ import (
 
 const (
 	url_path_hello               = "/hello/"
+	url_path_healthz             = "/healthz"
+	url_path_readyz              = "/readyz"
+	url_path_admin_inflight      = "/admin/inflight"
+	url_path_admin_services      = "/admin/services"
+	url_path_admin_overrides     = "/admin/overrides"
 	url_path_swagger             = "/swagger/"
 	url_path_metrics             = "/metrics"
 	url_path_debug_pprof         = "/debug/pprof/"
@@ -26,15 +34,40 @@ const (
 	url_path_debug_pprof_trace   = "/debug/pprof/trace/"
 )
 
+// 内置路由, 配置文件中的路由不能与之重复
+var builtinPathMap = map[string]bool{
+	url_path_hello:               true,
+	url_path_healthz:             true,
+	url_path_readyz:              true,
+	url_path_admin_inflight:      true,
+	url_path_admin_services:      true,
+	url_path_admin_overrides:     true,
+	url_path_swagger:             true,
+	url_path_metrics:             true,
+	url_path_debug_pprof:         true,
+	url_path_debug_pprof_cmdline: true,
+	url_path_debug_pprof_profile: true,
+	url_path_debug_pprof_symbol:  true,
+	url_path_debug_pprof_trace:   true,
+}
+
 type HttpMessage struct {
+	inflight inflightCounter // 正在处理的请求数, 优雅退出时等待其归零
+
 	mux       *http.ServeMux
 	host      string
 	RegCenter *RegisterCenter.RegisterCenter // 注册中心
+
+	routeLock  sync.Mutex      // 路由注册锁
+	mounted    map[string]bool // 已注册到mux的路径
+	routeTable atomic.Value    // 当前路由表 *RouteTable
+	draining   int32           // 下线中, 1表示/readyz返回503
 }
 
 func (httpMsg *HttpMessage) Init(
 	addr string,
 	RegCenter *RegisterCenter.RegisterCenter,
+	routes *RouteTable,
 ) bool {
 	if RegCenter == nil {
 		return false
@@ -43,7 +76,13 @@ func (httpMsg *HttpMessage) Init(
 	httpMsg.RegCenter = RegCenter
 
 	httpMsg.mux = http.NewServeMux()
+	httpMsg.mounted = make(map[string]bool)
 	httpMsg.mux.HandleFunc(url_path_hello, httpMsg.hello)
+	httpMsg.mux.HandleFunc(url_path_healthz, httpMsg.healthz)
+	httpMsg.mux.HandleFunc(url_path_readyz, httpMsg.readyz)
+	httpMsg.mux.HandleFunc(url_path_admin_inflight, httpMsg.adminHandler(httpMsg.adminInFlight))
+	httpMsg.mux.HandleFunc(url_path_admin_services, httpMsg.adminHandler(httpMsg.adminServices))
+	httpMsg.mux.HandleFunc(url_path_admin_overrides, httpMsg.adminHandler(httpMsg.adminOverrides))
 	httpMsg.mux.HandleFunc(url_path_debug_pprof, pprof.Index)
 	httpMsg.mux.HandleFunc(url_path_debug_pprof_cmdline, pprof.Cmdline)
 	httpMsg.mux.HandleFunc(url_path_debug_pprof_profile, pprof.Profile)
@@ -51,8 +90,10 @@ func (httpMsg *HttpMessage) Init(
 	httpMsg.mux.HandleFunc(url_path_debug_pprof_trace, pprof.Trace)
 
 	httpMsg.mux.Handle(url_path_swagger, httpSwagger.Handler())
+	httpMsg.mux.Handle(url_path_metrics, Metrics.Handler())
 
-	httpMsg.init_download()
+	// 注册配置文件中声明的路由
+	httpMsg.SetRoutes(routes)
 
 	return true
 }
@@ -61,7 +102,7 @@ func (httpMsg *HttpMessage) Handler(
 	w http.ResponseWriter,
 	r *http.Request,
 ) {
-	httpMsg.mux.ServeHTTP(w, r) //	执行
+	compressHandler(w, r, httpMsg.mux.ServeHTTP) //	执行, 按Accept-Encoding压缩返回
 }
 
 func (httpMsg *HttpMessage) hello(
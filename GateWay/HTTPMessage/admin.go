@@ -0,0 +1,278 @@
+package HTTPMessage
+
+import (
+	"GateWayCommon/AddrLimiter"
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/RegisterCenter"
+	"GateWayCommon/logger"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	default_admin_scope        = "admin"
+	default_admin_override_ttl = 600 // 默认覆盖有效期, 单位s
+)
+
+// AdminConfig 管理接口配置
+//	管理接口必须校验Token, 且Token需显式具备Scope(不限制Scope的Token也不能访问)
+type AdminConfig struct {
+	Enable     bool   // 是否开启管理接口, 关闭时返回404
+	CheckToken string // Token校验方式: api_key/hmac/jwt; 不填默认api_key
+	Scope      string // Token需具备的Scope; 不填默认admin
+	CheckIP    string // IP名单名称, 如: default; 为空不校验
+}
+
+// Admin 解析后的管理接口配置, 通过BuildAdmin生成
+type Admin struct {
+	enable     bool
+	checkToken CheckToken
+	scope      string
+	checkIP    string
+}
+
+var admin atomic.Value // *Admin
+
+func init() {
+	admin.Store(&Admin{})
+}
+
+// BuildAdmin 校验管理接口配置
+func BuildAdmin(conf AdminConfig) (*Admin, error) {
+	a := &Admin{
+		enable:     conf.Enable,
+		checkToken: CheckToken_APIKey,
+		scope:      conf.Scope,
+		checkIP:    conf.CheckIP,
+	}
+	if conf.CheckToken != "" {
+		checkToken, ok := checkTokenValue[conf.CheckToken]
+		if !ok || checkToken == CheckToken_None {
+			return nil, errors.New("admin check_token invalid: " + conf.CheckToken)
+		}
+		a.checkToken = checkToken
+	}
+	if a.scope == "" {
+		a.scope = default_admin_scope
+	}
+	return a, nil
+}
+
+// StoreAdmin 替换当前管理接口配置
+func StoreAdmin(a *Admin) {
+	if a != nil {
+		admin.Store(a)
+	}
+}
+
+func getAdmin() *Admin {
+	return admin.Load().(*Admin)
+}
+
+// adminFunc 管理接口, operator为校验通过的调用方
+type adminFunc func(w http.ResponseWriter, r *http.Request, operator string, st time.Time)
+
+// adminHandler 管理接口校验: 开关 -> IP名单 -> Token及Scope
+func (httpMsg *HttpMessage) adminHandler(handler adminFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		st := time.Now()
+		a := getAdmin()
+		if !a.enable {
+			http.NotFound(w, r)
+			return
+		}
+
+		code := int32(GateWayProtos.ResultType_ERR_Decode_Request)
+		client_ip, err := GetClientIP(r)
+		if err != nil {
+			adminAudit(r, "", client_ip).Warn(err)
+			responseError(w, http.StatusBadRequest, format_json, code, err.Error(), st)
+			return
+		}
+		if a.checkIP != "" {
+			if check, err := AddrLimiter.ListEnable(a.checkIP, client_ip); !check {
+				adminAudit(r, "", client_ip).Warn(err)
+				responseError(w, http.StatusForbidden, format_json, code, err.Error(), st)
+				return
+			}
+		}
+
+		identity, header, err := checkToken(r, &requestOption{CheckToken: a.checkToken})
+		if err == nil && !identity.Scopes[a.scope] {
+			header, err = http.StatusForbidden, errors.New("token scope forbidden")
+		}
+		if err != nil {
+			operator := ""
+			if identity != nil {
+				operator = identity.Type + ":" + identity.Name
+			}
+			adminAudit(r, operator, client_ip).Warn(err)
+			responseError(w, header, format_json, code, err.Error(), st)
+			return
+		}
+		handler(w, r, identity.Type+":"+identity.Name+"@"+client_ip, st)
+	}
+}
+
+// adminAudit 管理接口审计日志
+func adminAudit(r *http.Request, operator string, client_ip string) *logger.Entry {
+	return logger.Log().WithFields(logger.Fields{
+		"audit":     "admin",
+		"operator":  operator,
+		"client_ip": client_ip,
+		"method":    r.Method,
+		"path":      r.URL.Path,
+	})
+}
+
+// adminServices 查看全部下级服务的结点, 及结点连接状态/熔断状态/本地覆盖/是否可选中
+func (httpMsg *HttpMessage) adminServices(
+	w http.ResponseWriter,
+	r *http.Request,
+	operator string,
+	st time.Time,
+) {
+	if r.Method != http.MethodGet {
+		responseError(w, http.StatusMethodNotAllowed, format_json, int32(GateWayProtos.ResultType_ERR_Decode_Request), "method not allowed", st)
+		return
+	}
+	responseJson(w, http.StatusOK, int32(GateWayProtos.ResultType_OK), "ok", st, httpMsg.RegCenter.Services())
+}
+
+// adminInFlight 查看下线状态及正在处理的请求数
+func (httpMsg *HttpMessage) adminInFlight(
+	w http.ResponseWriter,
+	r *http.Request,
+	operator string,
+	st time.Time,
+) {
+	responseJson(w, http.StatusOK, int32(GateWayProtos.ResultType_OK), "ok", st, &inflightData{
+		Draining: httpMsg.IsDraining(),
+		InFlight: httpMsg.InFlight(),
+	})
+}
+
+// overrideRequest 设置结点本地覆盖请求
+type overrideRequest struct {
+	ServiceType int32  `json:"service_type"`
+	ServiceName string `json:"service_name"` // 服务名称, 如: SERVICE_ALGO_CENTER; 与service_type二选一
+	Addr        string `json:"addr"`
+	Action      string `json:"action"` // zero_weight/offline/pin
+	TTL         int64  `json:"ttl"`    // 有效期, 单位s; 不填默认600, 最长24h
+	Reason      string `json:"reason"`
+}
+
+// adminOverrides 结点本地覆盖
+//	GET    查看全部覆盖
+//	POST   设置覆盖, Body为overrideRequest
+//	DELETE 取消覆盖, ?service_name=SERVICE_ALGO_CENTER&addr=ip:port, service_name可用service_type代替
+func (httpMsg *HttpMessage) adminOverrides(
+	w http.ResponseWriter,
+	r *http.Request,
+	operator string,
+	st time.Time,
+) {
+	code := int32(GateWayProtos.ResultType_ERR_Decode_Request)
+	client_ip, _ := GetClientIP(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		responseJson(w, http.StatusOK, int32(GateWayProtos.ResultType_OK), "ok", st, httpMsg.RegCenter.NodeOverrides())
+
+	case http.MethodPost:
+		body, err := read_body(r)
+		if err != nil {
+			header := http.StatusBadRequest
+			if errors.Is(err, ErrBodyTooLarge) {
+				header = http.StatusRequestEntityTooLarge
+			}
+			adminAudit(r, operator, client_ip).Warn(err)
+			responseError(w, header, format_json, code, err.Error(), st)
+			return
+		}
+		req := &overrideRequest{}
+		if err := json.Unmarshal(body, req); err != nil {
+			adminAudit(r, operator, client_ip).WithField("body", string(body)).Warn(err)
+			responseError(w, http.StatusBadRequest, format_json, code, err.Error(), st)
+			return
+		}
+		if req.ServiceName != "" {
+			serviceType, ok := GateWayProtos.ServiceType_value[req.ServiceName]
+			if !ok {
+				err := errors.New("service_name invalid: " + req.ServiceName)
+				adminAudit(r, operator, client_ip).WithField("body", string(body)).Warn(err)
+				responseError(w, http.StatusBadRequest, format_json, code, err.Error(), st)
+				return
+			}
+			req.ServiceType = serviceType
+		}
+		if req.TTL == 0 {
+			req.TTL = default_admin_override_ttl
+		}
+
+		entry := adminAudit(r, operator, client_ip).WithFields(logger.Fields{
+			"service": GateWayProtos.ServiceType(req.ServiceType).String(),
+			"addr":    req.Addr,
+			"action":  req.Action,
+			"ttl":     req.TTL,
+			"reason":  req.Reason,
+		})
+		o, err := httpMsg.RegCenter.SetNodeOverride(req.ServiceType, req.Addr, req.Action,
+			time.Duration(req.TTL)*time.Second, operator, req.Reason)
+		if err != nil {
+			header := http.StatusBadRequest
+			if errors.Is(err, RegisterCenter.ErrNodeNotFound) {
+				header = http.StatusNotFound
+			}
+			entry.Warn(err)
+			responseError(w, header, format_json, code, err.Error(), st)
+			return
+		}
+		entry.Info("Admin Set Node Override")
+		responseJson(w, http.StatusOK, int32(GateWayProtos.ResultType_OK), "ok", st, o)
+
+	case http.MethodDelete:
+		query := r.URL.Query()
+		addr := query.Get("addr")
+		entry := adminAudit(r, operator, client_ip).WithField("addr", addr)
+		serviceType, err := queryServiceType(query)
+		if err != nil {
+			entry.WithField("query", r.URL.RawQuery).Warn(err)
+			responseError(w, http.StatusBadRequest, format_json, code, err.Error(), st)
+			return
+		}
+		entry = entry.WithField("service", GateWayProtos.ServiceType(serviceType).String())
+		o, err := httpMsg.RegCenter.ClearNodeOverride(serviceType, addr)
+		if err != nil {
+			entry.Warn(err)
+			responseError(w, http.StatusNotFound, format_json, code, err.Error(), st)
+			return
+		}
+		entry.WithField("action", o.Action).Info("Admin Clear Node Override")
+		responseJson(w, http.StatusOK, int32(GateWayProtos.ResultType_OK), "ok", st, o)
+
+	default:
+		responseError(w, http.StatusMethodNotAllowed, format_json, code, "method not allowed", st)
+	}
+}
+
+// queryServiceType 读取请求参数中的服务类型, service_name优先
+func queryServiceType(query url.Values) (int32, error) {
+	if name := query.Get("service_name"); name != "" {
+		serviceType, ok := GateWayProtos.ServiceType_value[name]
+		if !ok {
+			return 0, errors.New("service_name invalid: " + name)
+		}
+		return serviceType, nil
+	}
+	serviceType, err := strconv.Atoi(query.Get("service_type"))
+	if err != nil {
+		return 0, errors.New("service_name or service_type required")
+	}
+	return int32(serviceType), nil
+}
@@ -0,0 +1,119 @@
+package HTTPMessage
+
+import (
+	"GateWayCommon/ResponseCache"
+	"GateWayCommon/Tracing"
+	"GateWayCommon/logger"
+	"context"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	protoV2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const header_cache = "X-Cache" // 缓存状态: hit/miss/stale
+
+// RouteCache 路由返回结果缓存配置, TTL为0不启用
+type RouteCache struct {
+	KeyFields []string // 缓存Key字段, 取自请求Proto字段, 如: ["user_id", "ll_id"]; 为空则使用整个请求(不含request_id)
+	ResponseCache.Config
+}
+
+// cacheKey 生成缓存Key: cmd + 请求字段值
+//	未配置KeyFields时使用清空request_id后的整个请求, 字段值按"长度:值"拼接
+func cacheKey(
+	cmd int32,
+	keyFields []string,
+	requestProto protoV2.Message,
+	request []byte,
+) string {
+	var builder strings.Builder
+	builder.WriteString(strconv.Itoa(int(cmd)))
+	if len(keyFields) == 0 {
+		builder.WriteByte(0)
+		builder.Write(cacheRequest(requestProto, request))
+		return builder.String()
+	}
+	for _, field := range keyFields {
+		val, _ := protoFieldKey(requestProto, field)
+		builder.WriteByte(0)
+		builder.WriteString(field)
+		builder.WriteByte('=')
+		builder.WriteString(strconv.Itoa(len(val)))
+		builder.WriteByte(':')
+		builder.WriteString(val)
+	}
+	return builder.String()
+}
+
+// cacheRequest 清空每次请求都不同的request_id后重新编码
+func cacheRequest(
+	requestProto protoV2.Message,
+	request []byte,
+) []byte {
+	if requestProto == nil {
+		return request
+	}
+	m := requestProto.ProtoReflect()
+	fd := m.Descriptor().Fields().ByName(param_request_id)
+	if fd == nil || !m.Has(fd) {
+		return request
+	}
+	clone := protoV2.Clone(requestProto).ProtoReflect()
+	clone.Clear(fd)
+	data, err := protoV2.MarshalOptions{Deterministic: true}.Marshal(clone.Interface())
+	if err != nil {
+		return request
+	}
+	return data
+}
+
+// cacheLoad 缓存未命中或后台刷新时请求下级服务
+//	后台刷新使用新的请求ID及新的链路, 不沿用触发刷新的请求
+func (httpMsg *HttpMessage) cacheLoad(
+	serviceType int32,
+	cmd int32,
+	requestProto protoV2.Message,
+	request []byte,
+) ResponseCache.LoadFunc {
+	return func(ctx context.Context) ([]byte, int32, error) {
+		if ResponseCache.IsRefresh(ctx) {
+			ctx, request = refreshRequest(ctx, requestProto, request)
+		}
+		return httpMsg.RegCenter.CallService(ctx, serviceType, cmd, request)
+	}
+}
+
+// refreshRequest 为后台刷新生成新的请求ID, 替换metadata及请求Proto中的request_id
+func refreshRequest(
+	ctx context.Context,
+	requestProto protoV2.Message,
+	request []byte,
+) (context.Context, []byte) {
+	request_id := newRequestId()
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	origin := md.Get(metadata_request_id)
+	md.Set(metadata_request_id, request_id)
+	ctx = metadata.NewOutgoingContext(Tracing.WithoutParent(ctx), md)
+
+	if requestProto != nil {
+		m := requestProto.ProtoReflect()
+		if fd := m.Descriptor().Fields().ByName(param_request_id); fd != nil &&
+			fd.Kind() == protoreflect.StringKind && !fd.IsList() {
+			clone := protoV2.Clone(requestProto)
+			clone.ProtoReflect().Set(fd, protoreflect.ValueOfString(request_id))
+			if data, err := protoV2.Marshal(clone); err == nil {
+				request = data
+			}
+		}
+	}
+
+	logger.Log().WithFields(logger.Fields{
+		"request_id":        request_id,
+		"origin_request_id": origin,
+	}).Debug("Cache Refresh")
+	return ctx, request
+}
@@ -0,0 +1,367 @@
+package HTTPMessage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 压缩算法
+const (
+	encoding_gzip    = "gzip"
+	encoding_deflate = "deflate"
+)
+
+const (
+	default_compress_min_size     = 1024     // 默认最小压缩长度
+	default_max_request_body      = 4 << 20  // 默认请求Body最大长度(压缩后)
+	default_max_decompressed_body = 16 << 20 // 默认请求Body解压后最大长度
+)
+
+// ErrBodyTooLarge 请求Body超出长度限制
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// CompressionConfig HTTP压缩配置
+//	返回: 根据Accept-Encoding选择Encodings中的算法, 长度不足MinSize不压缩
+//	请求: 支持 Content-Encoding: gzip/deflate 的Body, 限制压缩前后的长度
+type CompressionConfig struct {
+	Encodings           []string // 返回压缩算法, 按优先级: gzip/deflate; 为空不压缩
+	MinSize             int      // 最小压缩长度, 单位字节; 不填默认1024
+	Level               int      // 压缩等级 1-9, 不填为默认等级
+	MaxRequestBody      int64    // 请求Body最大长度(压缩后), 单位字节; 不填默认4MB
+	MaxDecompressedBody int64    // 请求Body解压后最大长度, 单位字节; 不填默认16MB
+}
+
+// Compression 解析后的压缩配置, 通过BuildCompression生成
+type Compression struct {
+	encodings           []string
+	minSize             int
+	maxRequestBody      int64
+	maxDecompressedBody int64
+	pools               map[string]*sync.Pool // 算法->压缩Writer
+}
+
+var compression atomic.Value // *Compression
+
+func init() {
+	c, _ := BuildCompression(CompressionConfig{})
+	compression.Store(c)
+}
+
+// BuildCompression 校验压缩配置
+func BuildCompression(conf CompressionConfig) (*Compression, error) {
+	if conf.MinSize < 0 || conf.MaxRequestBody < 0 || conf.MaxDecompressedBody < 0 {
+		return nil, errors.New("compression size invalid")
+	}
+	level := conf.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	} else if level < flate.BestSpeed || level > flate.BestCompression {
+		return nil, errors.New("compression level invalid")
+	}
+
+	c := &Compression{
+		minSize:             conf.MinSize,
+		maxRequestBody:      conf.MaxRequestBody,
+		maxDecompressedBody: conf.MaxDecompressedBody,
+		pools:               make(map[string]*sync.Pool, len(conf.Encodings)),
+	}
+	if c.minSize == 0 {
+		c.minSize = default_compress_min_size
+	}
+	if c.maxRequestBody == 0 {
+		c.maxRequestBody = default_max_request_body
+	}
+	if c.maxDecompressedBody == 0 {
+		c.maxDecompressedBody = default_max_decompressed_body
+	}
+
+	for _, encoding := range conf.Encodings {
+		encoding = strings.ToLower(encoding)
+		if _, ok := c.pools[encoding]; ok {
+			return nil, errors.New("compression encoding repeated: " + encoding)
+		}
+		switch encoding {
+		case encoding_gzip:
+			c.pools[encoding] = &sync.Pool{New: func() interface{} {
+				zw, _ := gzip.NewWriterLevel(ioutil.Discard, level)
+				return zw
+			}}
+		case encoding_deflate:
+			// HTTP的deflate为zlib格式(RFC 1950), 不是裸deflate流
+			c.pools[encoding] = &sync.Pool{New: func() interface{} {
+				zw, _ := zlib.NewWriterLevel(ioutil.Discard, level)
+				return zw
+			}}
+		default:
+			return nil, errors.New("compression encoding not support: " + encoding)
+		}
+		c.encodings = append(c.encodings, encoding)
+	}
+	return c, nil
+}
+
+// StoreCompression 替换压缩配置
+func StoreCompression(c *Compression) {
+	if c != nil {
+		compression.Store(c)
+	}
+}
+
+func getCompression() *Compression {
+	return compression.Load().(*Compression)
+}
+
+// negotiateEncoding 根据Accept-Encoding选择压缩算法, q值相同按配置优先级, 不压缩返回空
+func (c *Compression) negotiateEncoding(acceptEncoding string) string {
+	if len(c.encodings) == 0 || acceptEncoding == "" {
+		return ""
+	}
+
+	qMap := make(map[string]float64)
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(item, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if val, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = val
+				}
+			}
+		}
+		qMap[name] = q
+	}
+
+	encoding := ""
+	best := 0.0
+	for _, name := range c.encodings {
+		q, ok := qMap[name]
+		if !ok {
+			q, ok = qMap["*"]
+		}
+		if ok && q > best {
+			encoding, best = name, q
+		}
+	}
+	return encoding
+}
+
+// compressWriter 压缩返回的ResponseWriter
+//	先缓存MinSize长度的数据, 超出后才开始压缩; 已设置Content-Encoding的返回不再压缩
+type compressWriter struct {
+	http.ResponseWriter
+	c        *Compression
+	encoding string
+
+	status      int
+	buf         []byte
+	decided     bool // 已决定是否压缩, 并已写回Header
+	zw          io.WriteCloser
+	wroteHeader bool
+}
+
+// compressHandler 压缩返回
+func compressHandler(w http.ResponseWriter, r *http.Request, next func(http.ResponseWriter, *http.Request)) {
+	c := getCompression()
+	encoding := c.negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	if encoding == "" || r.Method == http.MethodHead {
+		next(w, r)
+		return
+	}
+
+	cw := &compressWriter{
+		ResponseWriter: w,
+		c:              c,
+		encoding:       encoding,
+		status:         http.StatusOK,
+	}
+	defer cw.close()
+	next(cw, r)
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	cw.wroteHeader = true
+	if !cw.decided {
+		cw.buf = append(cw.buf, data...)
+		if len(cw.buf) < cw.c.minSize {
+			return len(data), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if cw.zw != nil {
+		return cw.zw.Write(data)
+	}
+	return cw.ResponseWriter.Write(data)
+}
+
+// decide 决定是否压缩, 写回Header及已缓存的数据
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	header := cw.ResponseWriter.Header()
+	header.Add("Vary", "Accept-Encoding")
+	if header.Get("Content-Encoding") != "" ||
+		cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		compress = false
+	}
+
+	if compress {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		switch zw := cw.c.pools[cw.encoding].Get().(type) {
+		case *gzip.Writer:
+			zw.Reset(cw.ResponseWriter)
+			cw.zw = zw
+		case *zlib.Writer:
+			zw.Reset(cw.ResponseWriter)
+			cw.zw = zw
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.zw != nil {
+		_, err := cw.zw.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush 立即写回, 缓存数据不足MinSize时不压缩
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(len(cw.buf) >= cw.c.minSize)
+	}
+	switch zw := cw.zw.(type) {
+	case *gzip.Writer:
+		zw.Flush()
+	case *zlib.Writer:
+		zw.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 支持连接接管(如pprof等内置路由)
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijack not supported")
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if !cw.wroteHeader {
+			return
+		}
+		cw.decide(false)
+	}
+	if cw.zw != nil {
+		cw.zw.Close()
+		cw.c.pools[cw.encoding].Put(cw.zw)
+		cw.zw = nil
+	}
+}
+
+// readRequestBody 读取请求Body, 支持 Content-Encoding: gzip/deflate, 超出长度限制返回ErrBodyTooLarge
+func readRequestBody(r *http.Request) ([]byte, error) {
+	c := getCompression()
+	if r.Body == nil {
+		return nil, nil
+	}
+	defer r.Body.Close()
+
+	body, err := readLimit(r.Body, c.maxRequestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	var zr io.ReadCloser
+	switch encoding {
+	case "", "identity":
+		return body, nil
+	case encoding_gzip:
+		if zr, err = gzip.NewReader(bytes.NewReader(body)); err != nil {
+			return nil, err
+		}
+	case encoding_deflate:
+		if zr, err = zlib.NewReader(bytes.NewReader(body)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("content encoding not support: " + encoding)
+	}
+	defer zr.Close()
+	return readLimit(zr, c.maxDecompressedBody)
+}
+
+// readLimit 最多读取limit字节, 超出返回ErrBodyTooLarge
+func readLimit(reader io.Reader, limit int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	return data, nil
+}
+
+// limitedBody 限制请求Body长度, 超出返回ErrBodyTooLarge
+type limitedBody struct {
+	io.ReadCloser
+	remain int64
+}
+
+func newLimitedBody(body io.ReadCloser, limit int64) io.ReadCloser {
+	return &limitedBody{ReadCloser: body, remain: limit}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remain < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	// 多读1字节, 判断是否超出
+	if int64(len(p)) > b.remain+1 {
+		p = p[:b.remain+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remain {
+		n = int(b.remain)
+		b.remain = -1
+		return n, ErrBodyTooLarge
+	}
+	b.remain -= int64(n)
+	return n, err
+}
@@ -0,0 +1,47 @@
+package HTTPMessage
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/GroundRules"
+	"errors"
+	"strconv"
+
+	protoV2 "google.golang.org/protobuf/proto"
+)
+
+const (
+	header_ground_rules = "X-Ground-Rules" // 兜底返回标识
+
+	default_ground_rules_count = 10 // 默认兜底物料数量
+)
+
+// groundRulesAlgoCenter 算法中控兜底方案, 从cmd对应的兜底物料池中随机抽取物料
+func groundRulesAlgoCenter(
+	cmd int32,
+	request protoV2.Message,
+) (protoV2.Message, error) {
+	pool, ok := GroundRules.Get(cmd)
+	if !ok {
+		return nil, errors.New("ground rules pool not found, cmd = " + strconv.Itoa(int(cmd)))
+	}
+
+	req, ok := request.(*GateWayProtos.AlgoCenterRequest)
+	if !ok || req == nil {
+		return nil, errors.New("ground rules request is not AlgoCenterRequest")
+	}
+
+	count := int(req.GetRetCount())
+	if count <= 0 {
+		count = default_ground_rules_count
+	}
+
+	itemList := pool.Sample(int64(req.GetResType()), req.GetLlId(), count)
+	if len(itemList) == 0 {
+		return nil, errors.New("ground rules sample empty, cmd = " + strconv.Itoa(int(cmd)))
+	}
+
+	return &GateWayProtos.AlgoCenterResponse{
+		UserId:   req.GetUserId(),
+		ItemList: itemList,
+	}, nil
+}
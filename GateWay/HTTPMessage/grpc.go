@@ -0,0 +1,401 @@
+package HTTPMessage
+
+import (
+	"GateWayCommon/AddrLimiter"
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/Metrics"
+	"GateWayCommon/RateLimiter"
+	"GateWayCommon/RegisterCenter"
+	"GateWayCommon/Tracing"
+	"GateWayCommon/logger"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	protoV2 "google.golang.org/protobuf/proto"
+)
+
+// 请求协议, 用于日志及统计
+const (
+	Protocol_Http    = "http"
+	Protocol_Grpc    = "grpc"
+	Protocol_GrpcWeb = "grpc-web"
+)
+
+// GrpcMethod_CallService UnifiedService.CallService 完整方法名
+//	gRPC透传请求视为 POST GrpcMethod_CallService, body为UnifiedRequest.Request,
+//	HMAC签名按此计算(RAW_QUERY为空)
+const GrpcMethod_CallService = "/GrpcProtos.UnifiedService/CallService"
+
+// newGrpcHttpRequest 将gRPC请求转换为http.Request, 复用HTTP的IP/Token/限流Key处理
+//	metadata 转为Header(忽略伪Header及二进制metadata), peer地址转为RemoteAddr
+func newGrpcHttpRequest(
+	ctx context.Context,
+	body []byte,
+) (*http.Request, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, GrpcMethod_CallService, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r.URL = &url.URL{Path: GrpcMethod_CallService}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, vals := range md {
+			if strings.HasPrefix(k, ":") || strings.HasSuffix(k, "-bin") {
+				continue
+			}
+			r.Header[textproto.CanonicalMIMEHeaderKey(k)] = vals
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return nil, errors.New("grpc peer not found")
+	}
+	r.RemoteAddr = p.Addr.String()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return r, nil
+}
+
+// grpcResponse 生成返回结果, msg作为Response返回
+func grpcResponse(cmd int32, result int32, msg string) *GateWayProtos.UnifiedResponse {
+	return &GateWayProtos.UnifiedResponse{
+		Cmd:      cmd,
+		Result:   result,
+		Response: []byte(msg),
+	}
+}
+
+// grpcRateLimit 返回限流错误
+func grpcRateLimit(
+	cmd int32,
+	req_param *requestParam,
+	scope string,
+) *GateWayProtos.UnifiedResponse {
+	Metrics.HttpRateLimited.WithLabelValues(req_param.FuncName, scope).Inc()
+	result := int32(GateWayProtos.ResultType_ERR_Rate_Limit)
+	return grpcResponse(cmd, result, "rate limit exceeded, scope = "+scope)
+}
+
+// CallService gRPC/gRPC-Web 透传业务CMD
+//	按CMD查找开启gRPC调用的路由, 与HTTP请求使用相同的IP/Token校验、限流、负载均衡、缓存及兜底配置;
+//	请求与返回均为Proto编码, 不做Json转换. 错误通过UnifiedResponse.Result返回.
+func (httpMsg *HttpMessage) CallService(
+	ctx context.Context,
+	protocol string,
+	req *GateWayProtos.UnifiedRequest,
+) *GateWayProtos.UnifiedResponse {
+	st := time.Now()
+	cmd := req.GetCmd()
+
+	// 链路追踪, 沿用metadata中的traceparent
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx, span := startServerSpan(ctx, func(key string) string {
+		if vals := md.Get(key); len(vals) > 0 {
+			return vals[0]
+		}
+		return ""
+	}, GrpcMethod_CallService)
+	defer span.End()
+	span.SetAttributes(
+		Tracing.Attribute{Key: "rpc.system", Value: protocol},
+		Tracing.Attribute{Key: "gateway.cmd", Value: cmd},
+	)
+
+	rt, ok := httpMsg.getGrpcRoute(cmd)
+	if !ok || httpMsg.RegCenter == nil {
+		span.SetStatus(false, "unsupported cmd")
+		return grpcResponse(cmd, int32(GateWayProtos.ResultType_ERR_Service_CMD), "unsupported cmd.")
+	}
+
+	resp := httpMsg.common_grpc_request(ctx, protocol, req, &rt.param, rt.requestOptions()...)
+	span.SetAttribute("gateway.result", resp.Result)
+	if resp.Result != int32(GateWayProtos.ResultType_OK) {
+		span.SetStatus(false, GateWayProtos.ResultType(resp.Result).String())
+	}
+
+	// 统计请求数/耗时
+	cmdLabel := Metrics.CmdLabel(cmd)
+	Metrics.GrpcRequestTotal.WithLabelValues(protocol, cmdLabel, Metrics.ResultLabel(resp.Result)).Inc()
+	Metrics.GrpcRequestDuration.WithLabelValues(protocol, cmdLabel).Observe(time.Since(st).Seconds())
+	return resp
+}
+
+func (httpMsg *HttpMessage) common_grpc_request(
+	ctx context.Context,
+	protocol string,
+	req *GateWayProtos.UnifiedRequest,
+	req_param *requestParam,
+	opts ...RequestOption,
+) *GateWayProtos.UnifiedResponse {
+	cmd := req.GetCmd()
+
+	// 循环调用opts获取参数
+	req_opts := defaultOptions()
+	for _, opt := range opts {
+		opt.apply(req_opts)
+	}
+
+	// 请求ID, 优先取metadata中的x-request-id, 通过Header返回
+	request_id, from_md := grpcRequestId(ctx)
+	grpc_request := logger.Fields{
+		"Protocol":  protocol,
+		"CMD":       cmd,
+		"RequestId": request_id,
+	}
+	defer func() {
+		grpc.SetHeader(ctx, metadata.Pairs(metadata_request_id, request_id))
+	}()
+
+	// 获取客户端真实IP地址
+	r, err := newGrpcHttpRequest(ctx, req.GetRequest())
+	if err != nil {
+		code := int32(GateWayProtos.ResultType_ERR_Decode_Request)
+		logger.Log().WithFields(logger.Fields{
+			"grpc.Request": grpc_request,
+			"req.param":    req_param,
+		}).Warn(err)
+		return grpcResponse(cmd, code, err.Error())
+	}
+	client_ip, err := GetClientIP(r)
+	if err != nil {
+		code := int32(GateWayProtos.ResultType_ERR_Decode_Request)
+		logger.Log().WithFields(logger.Fields{
+			"grpc.Request": grpc_request,
+			"req.param":    req_param,
+			"RemoteAddr":   r.RemoteAddr,
+			"Header":       r.Header,
+		}).Warn(err)
+		return grpcResponse(cmd, code, err.Error())
+	}
+	grpc_request["ClientIP"] = client_ip
+
+	// ip 名单校验
+	if req_opts.CheckIP != "" {
+		if check, err := AddrLimiter.ListEnable(req_opts.CheckIP, client_ip); !check {
+			code := int32(GateWayProtos.ResultType_ERR_Forbidden)
+			logger.Log().WithFields(logger.Fields{
+				"grpc.Request": grpc_request,
+				"req.param":    req_param,
+				"req.opts":     req_opts,
+				"Header":       r.Header,
+			}).Warn(err)
+			return grpcResponse(cmd, code, err.Error())
+		}
+	}
+
+	// token 校验
+	token_name := ""
+	if req_opts.CheckToken != CheckToken_None {
+		identity, header, err := checkToken(r, req_opts)
+		if err != nil {
+			code := tokenResultCode(header)
+			logger.Log().WithFields(logger.Fields{
+				"grpc.Request": grpc_request,
+				"req.param":    req_param,
+				"req.opts":     req_opts,
+				"identity":     identity,
+			}).Warn(err)
+			return grpcResponse(cmd, code, err.Error())
+		}
+		token_name = identity.Type + ":" + identity.Name
+	}
+
+	// 全局限流, 在IP/Token校验之后
+	if !RateLimiter.AllowGlobal() {
+		logger.Log().WithFields(logger.Fields{
+			"grpc.Request": grpc_request,
+			"req.param":    req_param,
+		}).Warn("rate limit global")
+		return grpcRateLimit(cmd, req_param, rate_limit_scope_global)
+	}
+
+	// 校验请求Proto, 用于读取负载均衡/限流/缓存Key字段
+	request := req.GetRequest()
+	if req_opts.RequestProto != nil {
+		_, decode_span := Tracing.Start(ctx, "Decode", Tracing.SpanKind_Internal)
+		if err := protoV2.Unmarshal(request, req_opts.RequestProto); err != nil {
+			decode_span.SetError(err)
+			decode_span.End()
+			code := int32(GateWayProtos.ResultType_ERR_Decode_Request)
+			logger.Log().WithFields(logger.Fields{
+				"grpc.Request": grpc_request,
+				"req.param":    req_param,
+				"req.opts":     req_opts,
+			}).Error(err)
+			return grpcResponse(cmd, code, err.Error())
+		}
+		if verr := req_opts.validator.validate(req_opts.RequestProto.ProtoReflect(), nil); verr != nil {
+			decode_span.SetError(verr)
+			decode_span.End()
+			code := int32(GateWayProtos.ResultType_ERR_Decode_Request)
+			logger.Log().WithFields(logger.Fields{
+				"grpc.Request": grpc_request,
+				"req.param":    req_param,
+				"req.opts":     req_opts,
+			}).Warn(verr)
+			// 返回全部不通过的字段(Json)
+			data, _ := json.Marshal(verr)
+			return &GateWayProtos.UnifiedResponse{
+				Cmd:      cmd,
+				Result:   code,
+				Response: data,
+			}
+		}
+		decode_span.End()
+
+		// metadata中没有请求ID时使用请求中的request_id
+		if id := getRequestId(req_opts.RequestProto.ProtoReflect()); !from_md && validRequestId(id) {
+			request_id = id
+			grpc_request["RequestId"] = id
+		}
+	}
+
+	// 路由限流
+	if req_opts.rateLimiter != nil {
+		key := rateLimitKey(r, req_opts.RateLimitKey, client_ip, token_name, req_opts.RequestProto)
+		if !req_opts.rateLimiter.Allow(key) {
+			logger.Log().WithFields(logger.Fields{
+				"grpc.Request":   grpc_request,
+				"req.param":      req_param,
+				"rate_limit_key": key,
+			}).Warn("rate limit route")
+			return grpcRateLimit(cmd, req_param, rate_limit_scope_route)
+		}
+	}
+
+	// 下级服务接口限流
+	if !RateLimiter.AllowCMD(req_param.CMD) {
+		logger.Log().WithFields(logger.Fields{
+			"grpc.Request": grpc_request,
+			"req.param":    req_param,
+		}).Warn("rate limit cmd")
+		return grpcRateLimit(cmd, req_param, rate_limit_scope_cmd)
+	}
+
+	// 设置超时时间, 调用方设置了超时(grpc-timeout)时取较小值
+	var cancel context.CancelFunc
+	if req_opts.Timeout == 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		timeout := time.Duration(req_opts.Timeout) * time.Millisecond
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	// 设置负载均衡方案
+	data := make(map[string]string)
+	if req_opts.LBPolicy == LBPolicy_ConsistentHash ||
+		req_opts.LBPolicy == LBPolicy_SpecifyAddr {
+		if req_opts.getLBKeyFunc == nil {
+			code := int32(GateWayProtos.ResultType_ERR_Decode_Request)
+			msg := "get load balancer key failed"
+			logger.Log().WithFields(logger.Fields{
+				"grpc.Request": grpc_request,
+				"req.param":    req_param,
+				"req.opts":     req_opts,
+			}).Warn(msg)
+			return grpcResponse(cmd, code, msg)
+		}
+
+		data[RegisterCenter.Param_PickType] = string(req_opts.LBPolicy)
+		data[RegisterCenter.Param_PickParam] = req_opts.getLBKeyFunc(r, req_opts.RequestProto)
+	}
+
+	// 设置下级服务版本约束
+	if req_opts.Semver != "" {
+		data[RegisterCenter.Param_Semver] = req_opts.Semver
+	}
+	if len(data) > 0 {
+		ctx = RegisterCenter.BuildCtxFilter(ctx, data)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, metadata_request_id, request_id)
+
+	// 发送请求, 启用缓存时优先读取缓存
+	var response []byte
+	var result int32
+	cache_status := ""
+	if req_opts.responseCache != nil {
+		key := cacheKey(req_param.CMD, req_opts.cacheKeyFields, req_opts.RequestProto, request)
+		response, result, cache_status, err = req_opts.responseCache.Get(ctx, key,
+			httpMsg.cacheLoad(req_param.ServiceType, req_param.CMD, req_opts.RequestProto, request))
+		Metrics.HttpCacheTotal.WithLabelValues(req_param.FuncName, cache_status).Inc()
+	} else {
+		response, result, err = httpMsg.RegCenter.CallService(
+			ctx, req_param.ServiceType, req_param.CMD, request)
+	}
+
+	if err == nil && result != int32(GateWayProtos.ResultType_OK) {
+		err = errors.New(string(response))
+	}
+	if err != nil {
+		// 启用兜底返回
+		if req_opts.GroundRules && req_opts.groundRulesFunc != nil {
+			ground_resp, ground_err := req_opts.groundRulesFunc(req_param.CMD, req_opts.RequestProto)
+			var ground_data []byte
+			if ground_err == nil {
+				ground_data, ground_err = protoV2.Marshal(ground_resp)
+				if ground_err == nil {
+					logger.Log().WithFields(logger.Fields{
+						"grpc.Request": grpc_request,
+						"req.param":    req_param,
+						"req.opts":     req_opts,
+						"code":         result,
+						"ground_rules": "succ",
+					}).Warn(err)
+					return &GateWayProtos.UnifiedResponse{
+						Cmd:      cmd,
+						Result:   int32(GateWayProtos.ResultType_OK),
+						Response: ground_data,
+					}
+				}
+			}
+			logger.Log().WithFields(logger.Fields{
+				"req.param":    req_param,
+				"ground_rules": "failed",
+				"err":          ground_err,
+			}).Error("GroundRules Failed")
+		}
+
+		logger.Log().WithFields(logger.Fields{
+			"grpc.Request": grpc_request,
+			"req.param":    req_param,
+			"req.opts":     req_opts,
+			"code":         result,
+		}).Error(err)
+		return grpcResponse(cmd, result, err.Error())
+	}
+
+	logger.Log().WithFields(logger.Fields{
+		"grpc.Request": grpc_request,
+		"req.param":    req_param,
+		"req.opts":     req_opts,
+		"code":         result,
+		"cache":        cache_status,
+	}).Debug("ok")
+	return &GateWayProtos.UnifiedResponse{
+		Cmd:      cmd,
+		Result:   result,
+		Response: response,
+	}
+}
+
+// grpcRequestId 读取metadata中的请求ID, 没有时自动生成
+func grpcRequestId(ctx context.Context) (string, bool) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(metadata_request_id); len(vals) > 0 && validRequestId(vals[0]) {
+			return vals[0], true
+		}
+	}
+	return newRequestId(), false
+}
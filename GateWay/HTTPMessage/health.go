@@ -0,0 +1,74 @@
+package HTTPMessage
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/RegisterCenter"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// readyzData /readyz 返回数据
+type readyzData struct {
+	Ready        bool                              `json:"ready"`        // 是否可以接收流量
+	Draining     bool                              `json:"draining"`     // 是否正在下线
+	Dependencies []RegisterCenter.DependencyHealth `json:"dependencies"` // 各依赖的就绪状态
+}
+
+// SetDraining 设置下线状态, 下线中/readyz返回503, 负载均衡不再转发新请求
+func (httpMsg *HttpMessage) SetDraining(draining bool) {
+	var v int32
+	if draining {
+		v = 1
+	}
+	atomic.StoreInt32(&httpMsg.draining, v)
+}
+
+// IsDraining 是否正在下线
+func (httpMsg *HttpMessage) IsDraining() bool {
+	return atomic.LoadInt32(&httpMsg.draining) == 1
+}
+
+// healthz 存活检查, 进程能处理请求即返回200
+func (httpMsg *HttpMessage) healthz(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	st := time.Now()
+	responseJson(w, http.StatusOK, int32(GateWayProtos.ResultType_OK), "alive", st, &emptyData{})
+}
+
+// readyz 就绪检查, 以下条件全部满足返回200, 否则返回503
+//	1. 注册中心可达
+//	2. RelyList中每个服务至少有一个可用连接
+//	3. 没有在下线
+func (httpMsg *HttpMessage) readyz(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	st := time.Now()
+	data := &readyzData{
+		Ready:        true,
+		Draining:     httpMsg.IsDraining(),
+		Dependencies: httpMsg.RegCenter.Health(),
+	}
+	msg := "ready"
+	if data.Draining {
+		data.Ready = false
+		msg = "draining"
+	}
+	for _, dep := range data.Dependencies {
+		if !dep.Ready {
+			data.Ready = false
+			if msg == "ready" {
+				msg = dep.Name + " not ready"
+			}
+		}
+	}
+
+	if data.Ready {
+		responseJson(w, http.StatusOK, int32(GateWayProtos.ResultType_OK), msg, st, data)
+	} else {
+		responseJson(w, http.StatusServiceUnavailable, int32(GateWayProtos.ResultType_ERR_NO_Server), msg, st, data)
+	}
+}
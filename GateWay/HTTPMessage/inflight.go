@@ -0,0 +1,55 @@
+package HTTPMessage
+
+import (
+	"sync/atomic"
+)
+
+// inflightCounter 按协议统计正在处理的请求数
+type inflightCounter struct {
+	http    int64
+	grpc    int64
+	grpcWeb int64
+}
+
+// InFlightStat 正在处理的请求数
+type InFlightStat struct {
+	Http    int64 `json:"http"`
+	Grpc    int64 `json:"grpc"`
+	GrpcWeb int64 `json:"grpc_web"`
+	Total   int64 `json:"total"`
+}
+
+// inflightData /admin/inflight 返回数据
+type inflightData struct {
+	Draining bool         `json:"draining"`
+	InFlight InFlightStat `json:"in_flight"`
+}
+
+// TrackInFlight 记录一个正在处理的请求, 请求结束时调用返回的函数
+//	HTTP请求在路由中统计, gRPC/gRPC-Web请求由调用方在分发时统计
+func (httpMsg *HttpMessage) TrackInFlight(protocol string) func() {
+	var counter *int64
+	switch protocol {
+	case Protocol_Grpc:
+		counter = &httpMsg.inflight.grpc
+	case Protocol_GrpcWeb:
+		counter = &httpMsg.inflight.grpcWeb
+	default:
+		counter = &httpMsg.inflight.http
+	}
+	atomic.AddInt64(counter, 1)
+	return func() {
+		atomic.AddInt64(counter, -1)
+	}
+}
+
+// InFlight 当前正在处理的请求数
+func (httpMsg *HttpMessage) InFlight() InFlightStat {
+	stat := InFlightStat{
+		Http:    atomic.LoadInt64(&httpMsg.inflight.http),
+		Grpc:    atomic.LoadInt64(&httpMsg.inflight.grpc),
+		GrpcWeb: atomic.LoadInt64(&httpMsg.inflight.grpcWeb),
+	}
+	stat.Total = stat.Http + stat.Grpc + stat.GrpcWeb
+	return stat
+}
@@ -0,0 +1,236 @@
+package HTTPMessage
+
+import (
+	"GateWayCommon/jsonpb"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// 返回格式
+const (
+	format_json     = "json"
+	format_protobuf = "protobuf" // 直接返回下级服务的Proto编码, 不做转换
+	format_msgpack  = "msgpack"  // 与Json相同的结构, msgpack编码
+)
+
+const (
+	content_type_json     = "application/json; charset=utf-8"
+	content_type_protobuf = "application/x-protobuf"
+	content_type_msgpack  = "application/msgpack"
+
+	header_result_code = "X-Result-Code" // Proto返回时, 通过Header返回code
+)
+
+// Accept/Content-Type 媒体类型->格式
+var mediaTypeFormat = map[string]string{
+	"application/json":                format_json,
+	"application/x-protobuf":          format_protobuf,
+	"application/protobuf":            format_protobuf,
+	"application/vnd.google.protobuf": format_protobuf,
+	"application/msgpack":             format_msgpack,
+	"application/x-msgpack":           format_msgpack,
+	"application/*":                   format_json,
+	"*/*":                             format_json,
+}
+
+// RouteJson 路由Json返回选项, 默认与原有格式一致(枚举为数值, 输出默认值, 使用proto字段名)
+//	只对配置了ResponseProto的路由生效, Json返回的下级服务原样返回
+type RouteJson struct {
+	EnumNames    bool // 枚举输出名称
+	CamelCase    bool // 字段名使用lowerCamelCase
+	OmitDefaults bool // 不输出默认值字段
+}
+
+// newJsonMarshaler 根据路由Json选项生成Marshaler
+func newJsonMarshaler(conf RouteJson) *jsonpb.Marshaler {
+	return &jsonpb.Marshaler{
+		EnumsAsInts:  !conf.EnumNames,    // 是否将枚举值设定为整数，而不是字符串类型
+		EmitDefaults: !conf.OmitDefaults, // 是否将字段值为空的渲染到JSON结构中
+		OrigName:     !conf.CamelCase,    // 是否使用原生的proto协议中的字段
+	}
+}
+
+// mediaFormat 解析媒体类型对应的格式, 不支持返回空
+func mediaFormat(mediaType string) string {
+	mt, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return ""
+	}
+	return mediaTypeFormat[mt]
+}
+
+// isProtobufRequest 判断请求Body是否为Proto编码
+func isProtobufRequest(contentType string) bool {
+	return contentType != "" && mediaFormat(contentType) == format_protobuf
+}
+
+// negotiateFormat 根据Accept选择返回格式
+//	按q值选择路由支持的格式, q值相同取靠前的; 没有支持的格式时返回Json
+//	protobuf 需要路由配置ResponseProto, msgpack 需要路由开启Msgpack
+func negotiateFormat(
+	accept string,
+	req_opts *requestOption,
+) string {
+	format := format_json
+	best := -1.0
+	for _, item := range strings.Split(accept, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		mt, params, err := mime.ParseMediaType(item)
+		if err != nil {
+			continue
+		}
+		f, ok := mediaTypeFormat[mt]
+		if !ok ||
+			(f == format_protobuf && req_opts.ResponseProto == nil) ||
+			(f == format_msgpack && !req_opts.Msgpack) {
+			continue
+		}
+		q := 1.0
+		if str, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(str, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 && q > best {
+			format, best = f, q
+		}
+	}
+	return format
+}
+
+// json2msgpack 将Json转为msgpack编码, 保持对象字段顺序
+//	整数编码为int/uint, 其余数值编码为float64
+func json2msgpack(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var buf bytes.Buffer
+	if err := msgpackValue(decoder, &buf); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("msgpack: invalid json")
+	}
+	return buf.Bytes(), nil
+}
+
+func msgpackValue(decoder *json.Decoder, buf *bytes.Buffer) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch v := token.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		msgpackNumber(v, buf)
+	case string:
+		msgpackString(v, buf)
+	case json.Delim:
+		// 先编码元素, 得到元素数量后再写入头部
+		var elems bytes.Buffer
+		n := 0
+		for decoder.More() {
+			if v == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				msgpackString(key.(string), &elems)
+			}
+			if err := msgpackValue(decoder, &elems); err != nil {
+				return err
+			}
+			n++
+		}
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		if v == '{' {
+			msgpackHeader(buf, n, 0x80, 0xde, 0xdf)
+		} else {
+			msgpackHeader(buf, n, 0x90, 0xdc, 0xdd)
+		}
+		buf.Write(elems.Bytes())
+	}
+	return nil
+}
+
+// msgpackHeader 写入map/array头部, fix格式最多15个元素
+func msgpackHeader(buf *bytes.Buffer, n int, fix byte, b16 byte, b32 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(b16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(b32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+func msgpackString(s string, buf *bytes.Buffer) {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.WriteString(s)
+}
+
+func msgpackNumber(num json.Number, buf *bytes.Buffer) {
+	if i, err := num.Int64(); err == nil {
+		switch {
+		case i >= 0 && i < 128:
+			buf.WriteByte(byte(i))
+		case i < 0 && i >= -32:
+			buf.WriteByte(byte(int8(i)))
+		case i >= math.MinInt8 && i <= math.MaxInt8:
+			buf.WriteByte(0xd0)
+			buf.WriteByte(byte(int8(i)))
+		case i >= math.MinInt16 && i <= math.MaxInt16:
+			buf.WriteByte(0xd1)
+			binary.Write(buf, binary.BigEndian, int16(i))
+		case i >= math.MinInt32 && i <= math.MaxInt32:
+			buf.WriteByte(0xd2)
+			binary.Write(buf, binary.BigEndian, int32(i))
+		default:
+			buf.WriteByte(0xd3)
+			binary.Write(buf, binary.BigEndian, i)
+		}
+		return
+	}
+	if u, err := strconv.ParseUint(num.String(), 10, 64); err == nil {
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, u)
+		return
+	}
+	f, _ := num.Float64()
+	buf.WriteByte(0xcb)
+	binary.Write(buf, binary.BigEndian, f)
+}
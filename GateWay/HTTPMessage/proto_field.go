@@ -0,0 +1,98 @@
+package HTTPMessage
+
+import (
+	"strconv"
+	"strings"
+
+	protoV2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// findField 根据proto字段名或json字段名查找字段描述
+func findField(
+	md protoreflect.MessageDescriptor,
+	name string,
+) protoreflect.FieldDescriptor {
+	fields := md.Fields()
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	return fields.ByJSONName(name)
+}
+
+// protoFieldString 获取proto顶层字段的字符串值, 字段不存在返回false
+func protoFieldString(
+	message protoV2.Message,
+	name string,
+) (string, bool) {
+	if message == nil {
+		return "", false
+	}
+
+	m := message.ProtoReflect()
+	fd := findField(m.Descriptor(), name)
+	if fd == nil || fd.IsList() || fd.IsMap() {
+		return "", false
+	}
+	return protoValueString(fd, m.Get(fd))
+}
+
+// protoFieldKey 获取proto顶层字段的字符串值, 字段不存在返回false
+//	repeated字段的每个值按"长度:值"拼接, 保证不同的值列表不会得到相同的结果
+func protoFieldKey(
+	message protoV2.Message,
+	name string,
+) (string, bool) {
+	if message == nil {
+		return "", false
+	}
+
+	m := message.ProtoReflect()
+	fd := findField(m.Descriptor(), name)
+	if fd == nil || fd.IsMap() {
+		return "", false
+	}
+	if !fd.IsList() {
+		return protoValueString(fd, m.Get(fd))
+	}
+
+	list := m.Get(fd).List()
+	var builder strings.Builder
+	for i := 0; i < list.Len(); i++ {
+		str, ok := protoValueString(fd, list.Get(i))
+		if !ok {
+			return "", false
+		}
+		builder.WriteString(strconv.Itoa(len(str)))
+		builder.WriteByte(':')
+		builder.WriteString(str)
+	}
+	return builder.String(), true
+}
+
+// protoValueString 标量字段值转字符串
+func protoValueString(
+	fd protoreflect.FieldDescriptor,
+	v protoreflect.Value,
+) (string, bool) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return v.String(), true
+	case protoreflect.BytesKind:
+		return string(v.Bytes()), true
+	case protoreflect.BoolKind:
+		return strconv.FormatBool(v.Bool()), true
+	case protoreflect.EnumKind:
+		return strconv.Itoa(int(v.Enum())), true
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return strconv.FormatInt(v.Int(), 10), true
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
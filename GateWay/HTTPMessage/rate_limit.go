@@ -0,0 +1,68 @@
+package HTTPMessage
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/Metrics"
+	"GateWayCommon/RateLimiter"
+	"net/http"
+	"time"
+
+	protoV2 "google.golang.org/protobuf/proto"
+)
+
+const (
+	RateLimitKey_Route = ""      // 整个路由共用一个令牌桶
+	RateLimitKey_IP    = "ip"    // 按客户端IP
+	RateLimitKey_Token = "token" // 按Token调用方
+)
+
+// 限流范围, 用于日志及统计
+const (
+	rate_limit_scope_global = "global"
+	rate_limit_scope_route  = "route"
+	rate_limit_scope_cmd    = "cmd"
+)
+
+// RouteRateLimit 路由限流配置
+type RouteRateLimit struct {
+	Key string // 限流Key: 为空为整个路由, ip/token, 其他为请求字段名(如: user_id)
+	RateLimiter.LimitConfig
+}
+
+// rateLimitKey 获取本次请求的限流Key, 获取失败时返回空字符串(与其他请求共用令牌桶)
+func rateLimitKey(
+	r *http.Request,
+	key string,
+	client_ip string,
+	identity string,
+	request protoV2.Message,
+) string {
+	switch key {
+	case RateLimitKey_Route:
+		return ""
+	case RateLimitKey_IP:
+		return client_ip
+	case RateLimitKey_Token:
+		return identity
+	default:
+		if val, ok := protoFieldString(request, key); ok {
+			return val
+		}
+		return r.URL.Query().Get(key)
+	}
+}
+
+// responseRateLimit 返回限流错误
+func responseRateLimit(
+	w http.ResponseWriter,
+	format string,
+	req_param *requestParam,
+	scope string,
+	st time.Time,
+) {
+	Metrics.HttpRateLimited.WithLabelValues(req_param.FuncName, scope).Inc()
+	w.Header().Set("Retry-After", "1")
+	header := http.StatusTooManyRequests
+	code := int32(GateWayProtos.ResultType_ERR_Rate_Limit)
+	responseError(w, header, format, code, "rate limit exceeded, scope = "+scope, st)
+}
@@ -0,0 +1,102 @@
+package HTTPMessage
+
+import (
+	"GateWayCommon/logger"
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	header_request_id   = "X-Request-Id"
+	metadata_request_id = "x-request-id" // 转发下级服务的metadata
+	param_request_id    = "request_id"   // 请求参数/Proto字段
+	max_request_id_len  = 128
+)
+
+// requestContext 单次请求的上下文, 记录请求ID, 并生成统一的日志字段
+//	请求ID优先取 X-Request-Id Header, 其次为 request_id 参数, 都没有时自动生成
+type requestContext struct {
+	RequestId  string
+	ClientIP   string
+	fromHeader bool // 请求ID取自Header, 不再被参数覆盖
+
+	w         http.ResponseWriter
+	r         *http.Request
+	req_param *requestParam
+	req_opts  *requestOption
+}
+
+// newRequestContext 读取请求ID, 并通过 X-Request-Id 返回
+func newRequestContext(
+	w http.ResponseWriter,
+	r *http.Request,
+	req_param *requestParam,
+	req_opts *requestOption,
+) *requestContext {
+	rc := &requestContext{
+		w:         w,
+		r:         r,
+		req_param: req_param,
+		req_opts:  req_opts,
+	}
+	if id := r.Header.Get(header_request_id); validRequestId(id) {
+		rc.RequestId = id
+		rc.fromHeader = true
+	} else if id := r.URL.Query().Get(param_request_id); validRequestId(id) {
+		rc.RequestId = id
+	} else {
+		rc.RequestId = newRequestId()
+	}
+	w.Header().Set(header_request_id, rc.RequestId)
+	return rc
+}
+
+// setParamRequestId 使用Body中的request_id, Header中已有请求ID时忽略
+func (rc *requestContext) setParamRequestId(id string) {
+	if rc.fromHeader || !validRequestId(id) || id == rc.RequestId {
+		return
+	}
+	rc.RequestId = id
+	rc.w.Header().Set(header_request_id, id)
+}
+
+// outgoing 转发请求ID到下级服务
+func (rc *requestContext) outgoing(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, metadata_request_id, rc.RequestId)
+}
+
+// log 带有请求ID及请求信息的日志
+func (rc *requestContext) log() *logger.Entry {
+	return logger.Log().WithFields(logger.Fields{
+		"request_id": rc.RequestId,
+		"http.Request": logger.Fields{
+			"ClientIP": rc.ClientIP,
+			"Method":   rc.r.Method,
+			"Host":     rc.r.Host,
+			"URL":      rc.r.URL.String(),
+		},
+		"req.param": rc.req_param,
+		"req.opts":  rc.req_opts,
+	})
+}
+
+// newRequestId 自动生成的请求ID带有auto前缀
+func newRequestId() string {
+	return "auto_" + uuid.New().String()
+}
+
+// validRequestId 请求ID只允许可见ASCII字符, 防止日志注入
+func validRequestId(id string) bool {
+	if id == "" || len(id) > max_request_id_len {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,346 @@
+package HTTPMessage
+
+import (
+	"GateWayCommon/jsonpb"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	proto "github.com/golang/protobuf/proto"
+	protoV2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// decodeRequest 根据参数类型将请求解析为Proto并按路由规则校验, 返回Proto编码后的请求
+//	query: 按字段逐个解析, 见 query2pb
+//	body:  Json按Proto的Json映射规则解析(jsonpb), 忽略未知字段;
+//	       Content-Type 为 application/x-protobuf 时按Proto编码解析;
+//	       Content-Encoding 为 gzip/deflate 时先解压, 超出长度限制返回 ErrBodyTooLarge
+//	校验不通过返回 *ValidationError
+func decodeRequest(
+	r *http.Request,
+	paramType string,
+	message protoV2.Message,
+	validator *requestValidator,
+	request_id string,
+) ([]byte, error) {
+	var present map[string]bool
+	var err error
+	switch paramType {
+	case "query":
+		present, err = query2pb(r.URL.Query(), message)
+	case "body":
+		var body []byte
+		if body, err = read_body(r); err != nil {
+			return nil, err
+		}
+		if isProtobufRequest(r.Header.Get("Content-Type")) {
+			// Proto编码的Body, 按字段是否为非默认值判断是否存在
+			err = protoV2.Unmarshal(body, message)
+		} else {
+			present, err = json2pb(body, message)
+		}
+	default:
+		return nil, errors.New("ParamType not support, check gateway code.")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fillRequestId(message.ProtoReflect(), request_id); err != nil {
+		return nil, err
+	}
+	if verr := validator.validate(message.ProtoReflect(), present); verr != nil {
+		return nil, verr
+	}
+
+	// proto 转 []byte
+	return protoV2.Marshal(message)
+}
+
+// fillRequestId request_id 为空时使用请求ID(X-Request-Id 或自动生成的auto前缀uuid)
+func fillRequestId(m protoreflect.Message, request_id string) error {
+	fd := m.Descriptor().Fields().ByName(param_request_id)
+	if fd == nil {
+		return nil
+	}
+	if fd.Kind() != protoreflect.StringKind || fd.IsList() {
+		return errors.New("proto uuid type is not string.")
+	}
+	if m.Get(fd).String() == "" {
+		if request_id == "" {
+			request_id = newRequestId()
+		}
+		m.Set(fd, protoreflect.ValueOfString(request_id))
+	}
+	return nil
+}
+
+// getRequestId 读取Proto中的request_id, 没有该字段返回空
+func getRequestId(m protoreflect.Message) string {
+	fd := m.Descriptor().Fields().ByName(param_request_id)
+	if fd == nil || fd.Kind() != protoreflect.StringKind || fd.IsList() {
+		return ""
+	}
+	return m.Get(fd).String()
+}
+
+// json2pb 将Json Body解析为Proto, 返回出现的顶层字段
+func json2pb(
+	body []byte,
+	message protoV2.Message,
+) (map[string]bool, error) {
+	unmarshaler := &jsonpb.Unmarshaler{AllowUnknownFields: true}
+	if err := unmarshaler.Unmarshal(bytes.NewReader(body), proto.MessageV1(message)); err != nil {
+		return nil, err
+	}
+
+	object := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &object); err != nil {
+		return nil, err
+	}
+	md := message.ProtoReflect().Descriptor()
+	present := make(map[string]bool, len(object))
+	for k, v := range object {
+		if fd := findField(md, k); fd != nil && string(v) != "null" {
+			present[string(fd.Name())] = true
+		}
+	}
+	return present, nil
+}
+
+// query2pb 将Query参数按字段解析为Proto, 返回出现的顶层字段
+//	字段名可以为proto字段名或json字段名, 顶层未知字段忽略
+//	repeated: 重复Key(a=1&a=2), 或单个值逗号分隔(a=1,2 / a=[1,2])
+//	嵌套Message及map: 点分路径(a.b=1, attrs.key=value); Message也可以直接传Json(a={"b":1})
+//	enum: 名称或数值; bytes: base64
+func query2pb(
+	values url.Values,
+	message protoV2.Message,
+) (map[string]bool, error) {
+	// 按Key排序, 保证重复设置时结果稳定
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	m := message.ProtoReflect()
+	present := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		path := strings.Split(key, ".")
+		fd := findField(m.Descriptor(), path[0])
+		if fd == nil {
+			continue
+		}
+		if err := setQueryValue(m, fd, path[1:], values[key]); err != nil {
+			return nil, errors.New("params " + key + " invalid: " + err.Error())
+		}
+		present[string(fd.Name())] = true
+	}
+	return present, nil
+}
+
+// setQueryValue 设置字段值, path为字段之后的路径
+func setQueryValue(
+	m protoreflect.Message,
+	fd protoreflect.FieldDescriptor,
+	path []string,
+	vals []string,
+) error {
+	// 同一oneof只能设置一个字段
+	if oneof := fd.ContainingOneof(); oneof != nil {
+		if set := m.WhichOneof(oneof); set != nil && set.Number() != fd.Number() {
+			return errors.New("oneof " + string(oneof.Name()) + " already set by " + string(set.Name()))
+		}
+	}
+
+	switch {
+	case fd.IsMap():
+		if len(path) == 0 {
+			return errors.New("map key missing")
+		}
+		key, err := parseScalar(fd.MapKey(), path[0])
+		if err != nil {
+			return err
+		}
+		mp := m.Mutable(fd).Map()
+		vfd := fd.MapValue()
+		if vfd.Message() != nil {
+			return setMessageValue(mp.Mutable(key.MapKey()).Message(), path[1:], vals)
+		}
+		if len(path) > 1 {
+			return errors.New("path into scalar map value")
+		}
+		v, err := parseScalar(vfd, vals[len(vals)-1])
+		if err != nil {
+			return err
+		}
+		mp.Set(key.MapKey(), v)
+		return nil
+
+	case fd.IsList():
+		if len(path) > 0 {
+			return errors.New("path into repeated field not support")
+		}
+		list := m.Mutable(fd).List()
+		if fd.Message() != nil {
+			// repeated Message 每个值为一个Json对象
+			for _, str := range vals {
+				elem := list.NewElement()
+				if err := json2message(str, elem.Message()); err != nil {
+					return err
+				}
+				list.Append(elem)
+			}
+			return nil
+		}
+		for _, str := range splitListValues(vals) {
+			v, err := parseScalar(fd, str)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+		return nil
+
+	case fd.Message() != nil:
+		sub := m.Mutable(fd).Message()
+		if len(path) == 0 {
+			return json2message(vals[len(vals)-1], sub)
+		}
+		return setMessageValue(sub, path, vals)
+
+	default:
+		if len(path) > 0 {
+			return errors.New("path into scalar field")
+		}
+		v, err := parseScalar(fd, vals[len(vals)-1])
+		if err != nil {
+			return err
+		}
+		m.Set(fd, v)
+		return nil
+	}
+}
+
+// setMessageValue 按路径设置嵌套Message的字段, 嵌套字段不存在时报错
+func setMessageValue(
+	m protoreflect.Message,
+	path []string,
+	vals []string,
+) error {
+	if len(path) == 0 {
+		return json2message(vals[len(vals)-1], m)
+	}
+	fd := findField(m.Descriptor(), path[0])
+	if fd == nil {
+		return errors.New("field not found: " + path[0])
+	}
+	return setQueryValue(m, fd, path[1:], vals)
+}
+
+// json2message 将Json解析到Message中
+func json2message(str string, m protoreflect.Message) error {
+	unmarshaler := &jsonpb.Unmarshaler{AllowUnknownFields: true}
+	return unmarshaler.Unmarshal(strings.NewReader(str), proto.MessageV1(m.Interface()))
+}
+
+// splitListValues 重复Key的每个值作为一个元素; 只有一个值时, 兼容 [1,2,3] 及 1,2,3 格式
+func splitListValues(vals []string) []string {
+	if len(vals) != 1 {
+		return vals
+	}
+	trimString := strings.Trim(vals[0], "[ ]")
+	if trimString == "" {
+		return nil
+	}
+	strList := strings.Split(trimString, ",")
+	for i := range strList {
+		strList[i] = strings.TrimSpace(strList[i])
+	}
+	return strList
+}
+
+// parseScalar 将字符串解析为标量字段值
+func parseScalar(
+	fd protoreflect.FieldDescriptor,
+	str string,
+) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		if !utf8.ValidString(str) {
+			return protoreflect.Value{}, errors.New("invalid UTF-8")
+		}
+		return protoreflect.ValueOfString(str), nil
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			b, err = base64.URLEncoding.DecodeString(str)
+		}
+		if err != nil {
+			return protoreflect.Value{}, errors.New("invalid base64")
+		}
+		return protoreflect.ValueOfBytes(b), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfBool(b), nil
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(str)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		n, err := strconv.ParseInt(str, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, errors.New("enum value invalid: " + str)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(str, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfInt32(int32(n)), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfInt64(n), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(str, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfUint32(uint32(n)), nil
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfUint64(n), nil
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(str, 32)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfFloat32(float32(f)), nil
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfFloat64(f), nil
+	default:
+		return protoreflect.Value{}, errors.New("field kind not support: " + fd.Kind().String())
+	}
+}
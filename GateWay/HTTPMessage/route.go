@@ -0,0 +1,419 @@
+package HTTPMessage
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/Metrics"
+	"GateWayCommon/RateLimiter"
+	"GateWayCommon/RegisterCenter"
+	"GateWayCommon/ResponseCache"
+	"GateWayCommon/Tracing"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	protoV2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// RouteConfig 路由配置, 由配置文件声明
+type RouteConfig struct {
+	Path          string         // 请求路径, 如: /api/v1/web/download/
+	Methods       []string       // 允许请求方法, 如: ["GET"]
+	ParamType     string         // 读取参数类型: query/body
+	ServiceType   string         // 服务类型, ServiceType枚举名称或数值
+	CMD           string         // 服务接口, CmdType枚举名称或数值
+	Timeout       int64          // 超时时间, 单位ms; 0为不超时, 不填默认3s
+	MaxBodySize   int64          // 请求Body最大长度(压缩后), 单位字节; 0为全局配置, 超出返回413
+	LBPolicy      string         // 负载均衡策略: rand_weight/consistent_hash/specify_addr
+	LBKey         string         // 负载均衡Key, 取自请求Proto字段(或query参数)
+	Semver        string         // 下级服务版本约束, 如: ">=1.2.0, <2.0.0"
+	CheckToken    string         // Token校验: none/api_key/hmac/jwt, 为空不校验
+	TokenScope    string         // Token需具备的Scope, 为空则不校验Scope
+	CheckIP       string         // IP名单名称, 如: default; 为空不校验
+	RateLimit     RouteRateLimit // 路由限流, Rate为0不限流
+	Cache         RouteCache     // 返回结果缓存, TTL为0不启用
+	RequestProto  string         // 请求Proto全名, 如: COMM_AlgoCenter.AlgoCenterRequest
+	ResponseProto string         // 返回Proto全名, 为空则视为Json返回
+	GroundRules   string         // 兜底方案名称, 为空则不启用
+	Validate      []FieldRule    // 请求字段校验规则, 需配置RequestProto
+	Json          RouteJson      // Json返回选项
+	Msgpack       bool           // 支持msgpack返回(Accept: application/msgpack)
+	Grpc          bool           // 允许通过gRPC/gRPC-Web按CMD调用, 同一CMD只能有一个路由开启
+}
+
+// 兜底方案 名称->函数
+var groundRulesFuncMap = map[string]GroundRulesFunc{
+	"algo_center": groundRulesAlgoCenter,
+}
+
+// route 解析后的路由
+type route struct {
+	conf         RouteConfig
+	param        requestParam
+	opts         []RequestOption
+	requestType  protoreflect.MessageType // 请求Proto类型, nil为无请求Proto
+	responseType protoreflect.MessageType // 返回Proto类型, nil为Json返回
+
+	rateLimiter   *RateLimiter.KeyedLimiter // 路由限流, 配置未修改时重新加载后沿用
+	responseCache *ResponseCache.Cache      // 返回结果缓存, 配置未修改时重新加载后沿用
+}
+
+// parseEnumValue 解析枚举名称或数值
+func parseEnumValue(
+	str string,
+	valueMap map[string]int32,
+) (int32, error) {
+	if val, ok := valueMap[str]; ok {
+		return val, nil
+	}
+	val, err := strconv.ParseInt(str, 10, 32)
+	if err != nil {
+		return 0, errors.New("enum value invalid: " + str)
+	}
+	return int32(val), nil
+}
+
+// findMessageType 根据Proto全名查找Proto类型
+func findMessageType(fullName string) (protoreflect.MessageType, error) {
+	if fullName == "" {
+		return nil, nil
+	}
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(fullName))
+	if err != nil {
+		return nil, errors.New("proto message not found: " + fullName)
+	}
+	return mt, nil
+}
+
+// newRoute 校验路由配置并生成路由
+//	prev为重新加载前同一路径的路由, 限流及缓存配置未修改时沿用其令牌桶及缓存
+func newRoute(conf RouteConfig, prev *route) (*route, error) {
+	if !strings.HasPrefix(conf.Path, "/") {
+		return nil, errors.New("route path must start with '/', path = " + conf.Path)
+	}
+
+	rt := &route{conf: conf}
+	rt.param.FuncName = conf.Path
+
+	// 请求方法
+	if len(conf.Methods) == 0 {
+		return nil, errors.New("route methods empty, path = " + conf.Path)
+	}
+	for _, method := range conf.Methods {
+		method = strings.ToUpper(method)
+		switch method {
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch:
+			rt.param.Methods = append(rt.param.Methods, method)
+		default:
+			return nil, errors.New("route method not support, path = " + conf.Path + ", method = " + method)
+		}
+	}
+
+	// 参数类型
+	if conf.ParamType != "query" && conf.ParamType != "body" {
+		return nil, errors.New("route param_type not support, path = " + conf.Path)
+	}
+	rt.param.ParamType = conf.ParamType
+
+	// 服务类型与服务接口
+	serviceType, err := parseEnumValue(conf.ServiceType, GateWayProtos.ServiceType_value)
+	if err != nil {
+		return nil, errors.New("route service_type invalid, path = " + conf.Path)
+	}
+	rt.param.ServiceType = serviceType
+
+	cmd, err := parseEnumValue(conf.CMD, GateWayProtos.CmdType_value)
+	if err != nil {
+		return nil, errors.New("route cmd invalid, path = " + conf.Path)
+	}
+	rt.param.CMD = cmd
+
+	// Proto类型
+	if rt.requestType, err = findMessageType(conf.RequestProto); err != nil {
+		return nil, err
+	}
+	if rt.responseType, err = findMessageType(conf.ResponseProto); err != nil {
+		return nil, err
+	}
+
+	// 请求校验
+	if len(conf.Validate) > 0 {
+		if rt.requestType == nil {
+			return nil, errors.New("route validate without request_proto, path = " + conf.Path)
+		}
+		validator, err := newRequestValidator(rt.requestType.Descriptor(), conf.Validate)
+		if err != nil {
+			return nil, errors.New(err.Error() + ", path = " + conf.Path)
+		}
+		rt.opts = append(rt.opts, withValidator(validator))
+	}
+
+	// 超时
+	if conf.Timeout < 0 {
+		return nil, errors.New("route timeout invalid, path = " + conf.Path)
+	}
+	if conf.Timeout > 0 {
+		rt.opts = append(rt.opts, withTimeout(conf.Timeout))
+	}
+
+	// 请求Body长度
+	if conf.MaxBodySize < 0 {
+		return nil, errors.New("route max body size invalid, path = " + conf.Path)
+	}
+	if conf.MaxBodySize > 0 {
+		rt.opts = append(rt.opts, withMaxBodySize(conf.MaxBodySize))
+	}
+
+	// 负载均衡
+	switch LBPolicy(conf.LBPolicy) {
+	case "", LBPolicy_RandWeight:
+	case LBPolicy_ConsistentHash, LBPolicy_SpecifyAddr:
+		if conf.LBKey == "" {
+			return nil, errors.New("route lb_key empty, path = " + conf.Path)
+		}
+		lbKey := conf.LBKey
+		rt.opts = append(rt.opts, withLBPolicy(LBPolicy(conf.LBPolicy),
+			func(r *http.Request, request protoV2.Message) string {
+				if key, ok := protoFieldString(request, lbKey); ok {
+					return key
+				}
+				return r.URL.Query().Get(lbKey)
+			}))
+	default:
+		return nil, errors.New("route lb_policy not support, path = " + conf.Path)
+	}
+
+	// 版本约束
+	if conf.Semver != "" {
+		if err := RegisterCenter.CheckSemverConstraint(conf.Semver); err != nil {
+			return nil, errors.New("route semver invalid, path = " + conf.Path)
+		}
+		rt.opts = append(rt.opts, withSemver(conf.Semver))
+	}
+
+	// Token校验
+	checkToken, ok := checkTokenValue[conf.CheckToken]
+	if !ok {
+		return nil, errors.New("route check_token not support, path = " + conf.Path)
+	}
+	if checkToken != CheckToken_None {
+		rt.opts = append(rt.opts, withCheckToken(checkToken, conf.TokenScope))
+	}
+
+	// IP校验
+	if conf.CheckIP != "" {
+		rt.opts = append(rt.opts, withCheckIP(conf.CheckIP))
+	}
+
+	// 路由限流
+	if conf.RateLimit.Rate > 0 {
+		if conf.RateLimit.Burst < 0 {
+			return nil, errors.New("route rate_limit burst invalid, path = " + conf.Path)
+		}
+		if conf.RateLimit.Key == RateLimitKey_Token && checkToken == CheckToken_None {
+			return nil, errors.New("route rate_limit key token without check_token, path = " + conf.Path)
+		}
+		if prev != nil && prev.rateLimiter != nil && prev.conf.RateLimit == conf.RateLimit {
+			rt.rateLimiter = prev.rateLimiter
+		} else {
+			rt.rateLimiter = RateLimiter.NewKeyedLimiter(conf.RateLimit.LimitConfig)
+		}
+		rt.opts = append(rt.opts, withRateLimit(rt.rateLimiter, conf.RateLimit.Key))
+	}
+
+	// 返回结果缓存
+	if conf.Cache.TTL < 0 || conf.Cache.StaleTTL < 0 || conf.Cache.MaxBytes < 0 {
+		return nil, errors.New("route cache config invalid, path = " + conf.Path)
+	}
+	if conf.Cache.TTL > 0 {
+		if rt.requestType == nil {
+			return nil, errors.New("route cache without request_proto, path = " + conf.Path)
+		}
+		for _, field := range conf.Cache.KeyFields {
+			if fd := findField(rt.requestType.Descriptor(), field); fd == nil || fd.IsMap() {
+				return nil, errors.New("route cache key field invalid, path = " + conf.Path + ", field = " + field)
+			}
+		}
+		if prev != nil && prev.responseCache != nil && sameCache(&prev.conf, &conf) {
+			rt.responseCache = prev.responseCache
+		} else {
+			rt.responseCache = ResponseCache.New(conf.Cache.Config, time.Duration(conf.Timeout)*time.Millisecond)
+		}
+		rt.opts = append(rt.opts, withResponseCache(rt.responseCache, conf.Cache.KeyFields))
+	}
+
+	// 返回格式, 默认支持Json, 配置ResponseProto时支持Proto返回
+	rt.opts = append(rt.opts, withResponseFormat(conf.Json, conf.Msgpack))
+
+	// 兜底方案
+	if conf.GroundRules != "" {
+		f, ok := groundRulesFuncMap[conf.GroundRules]
+		if !ok {
+			return nil, errors.New("route ground_rules not found, path = " + conf.Path)
+		}
+		rt.opts = append(rt.opts, withGroundRules(f))
+	}
+	return rt, nil
+}
+
+// sameCache 缓存内容是否可以沿用: 缓存配置及决定返回内容的下级服务/接口/Proto/超时均未修改
+func sameCache(old *RouteConfig, conf *RouteConfig) bool {
+	return reflect.DeepEqual(old.Cache, conf.Cache) &&
+		old.ServiceType == conf.ServiceType &&
+		old.CMD == conf.CMD &&
+		old.RequestProto == conf.RequestProto &&
+		old.ResponseProto == conf.ResponseProto &&
+		old.Timeout == conf.Timeout
+}
+
+// requestOptions 生成本次请求参数, 请求与返回Proto每次请求新建
+func (rt *route) requestOptions() []RequestOption {
+	opts := make([]RequestOption, 0, len(rt.opts)+2)
+	opts = append(opts, rt.opts...)
+	if rt.requestType != nil {
+		opts = append(opts, withRequestProto(rt.requestType.New().Interface()))
+	}
+	if rt.responseType != nil {
+		opts = append(opts, withResponseProto(rt.responseType.New().Interface()))
+	}
+	return opts
+}
+
+// RouteTable 路由表, 校验通过后整体替换
+type RouteTable struct {
+	routeMap   map[string]*route // path->路由
+	grpcCmdMap map[int32]*route  // cmd->开启gRPC调用的路由
+}
+
+// BuildRoutes 校验路由配置, 生成路由表
+//	prev为当前路由表(可以为nil), 同一路径的限流令牌桶及返回结果缓存在配置未修改时沿用
+func BuildRoutes(confList []RouteConfig, prev *RouteTable) (*RouteTable, error) {
+	table := &RouteTable{
+		routeMap:   make(map[string]*route, len(confList)),
+		grpcCmdMap: make(map[int32]*route),
+	}
+	for _, conf := range confList {
+		if builtinPathMap[conf.Path] {
+			return nil, errors.New("route path conflicts with builtin path, path = " + conf.Path)
+		}
+		if _, ok := table.routeMap[conf.Path]; ok {
+			return nil, errors.New("route path repeated, path = " + conf.Path)
+		}
+		var prevRoute *route
+		if prev != nil {
+			prevRoute = prev.routeMap[conf.Path]
+		}
+		rt, err := newRoute(conf, prevRoute)
+		if err != nil {
+			return nil, err
+		}
+		table.routeMap[conf.Path] = rt
+
+		if conf.Grpc {
+			if _, ok := table.grpcCmdMap[rt.param.CMD]; ok {
+				return nil, errors.New("route grpc cmd repeated, path = " + conf.Path)
+			}
+			table.grpcCmdMap[rt.param.CMD] = rt
+		}
+	}
+	return table, nil
+}
+
+// SetRoutes 替换路由表
+// P.s> http.ServeMux 不支持删除路由, 所以新路径注册到mux, 已删除的路径在处理时返回404
+func (httpMsg *HttpMessage) SetRoutes(table *RouteTable) {
+	httpMsg.routeLock.Lock()
+	defer httpMsg.routeLock.Unlock()
+
+	for path := range table.routeMap {
+		if !httpMsg.mounted[path] {
+			httpMsg.mux.HandleFunc(path, httpMsg.routeHandler(path))
+			httpMsg.mounted[path] = true
+		}
+	}
+	httpMsg.routeTable.Store(table)
+}
+
+// Routes 当前路由表, 未设置返回nil
+func (httpMsg *HttpMessage) Routes() *RouteTable {
+	table, _ := httpMsg.routeTable.Load().(*RouteTable)
+	return table
+}
+
+// getRoute 根据注册路径获取当前路由
+func (httpMsg *HttpMessage) getRoute(path string) (*route, bool) {
+	table, ok := httpMsg.routeTable.Load().(*RouteTable)
+	if !ok || table == nil {
+		return nil, false
+	}
+	rt, ok := table.routeMap[path]
+	return rt, ok
+}
+
+// getGrpcRoute 根据CMD获取开启gRPC调用的路由
+func (httpMsg *HttpMessage) getGrpcRoute(cmd int32) (*route, bool) {
+	table, ok := httpMsg.routeTable.Load().(*RouteTable)
+	if !ok || table == nil {
+		return nil, false
+	}
+	rt, ok := table.grpcCmdMap[cmd]
+	return rt, ok
+}
+
+// routeHandler 路由统一处理函数
+func (httpMsg *HttpMessage) routeHandler(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rt, ok := httpMsg.getRoute(path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		// 统计请求数/耗时/正在处理的请求数
+		st := time.Now()
+		cmdLabel := Metrics.CmdLabel(rt.param.CMD)
+		inflight := Metrics.HttpInflight.WithLabelValues(path)
+		inflight.Inc()
+		defer httpMsg.TrackInFlight(Protocol_Http)()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		// 链路追踪, 沿用请求中的traceparent
+		ctx, span := startServerSpan(r.Context(), r.Header.Get, r.Method+" "+path)
+		span.SetAttributes(
+			Tracing.Attribute{Key: "http.method", Value: r.Method},
+			Tracing.Attribute{Key: "http.route", Value: path},
+			Tracing.Attribute{Key: "gateway.cmd", Value: rt.param.CMD},
+		)
+		setTraceResponse(w, span)
+		defer func() {
+			inflight.Dec()
+			Metrics.HttpRequestTotal.WithLabelValues(path, cmdLabel, strconv.Itoa(sw.status)).Inc()
+			Metrics.HttpRequestDuration.WithLabelValues(path, cmdLabel).Observe(time.Since(st).Seconds())
+			span.SetAttribute("http.status_code", sw.status)
+			span.End()
+		}()
+
+		err := httpMsg.common_request_v3(sw, r.WithContext(ctx), &rt.param, rt.requestOptions()...)
+		if sw.status >= http.StatusInternalServerError {
+			msg := http.StatusText(sw.status)
+			if err != nil {
+				msg = err.Error()
+			}
+			span.SetStatus(false, msg)
+		}
+	}
+}
+
+// statusWriter 记录返回的HTTP状态码
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
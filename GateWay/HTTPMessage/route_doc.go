@@ -0,0 +1,12 @@
+package HTTPMessage
+
+// 配置路由的接口文档
+//	路由由配置文件声明, 没有对应的处理函数, 文档注释挂在空函数上供swag生成文档
+
+// @Tags	下载推荐
+// @Summary 下载
+// @Router /api/v1/web/download/ [get]
+// @Param request query GateWayProtos.AlgoCenterRequest true "请求Proto结构"
+// @Produce json
+// @Success 200 {object} jsonResponse{data=GateWayProtos.AlgoCenterResponse} "成功 code=0, msg=ok; 失败code=错误码, msg=错误信息."
+func doc_api_v1_web_download() {}
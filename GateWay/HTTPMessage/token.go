@@ -0,0 +1,54 @@
+package HTTPMessage
+
+import (
+	"GateWayCommon/GateWayProtos"
+	"GateWayCommon/TokenAuth"
+	"errors"
+	"net/http"
+)
+
+// checkToken 按路由配置的版本校验token
+// 返回HTTP状态码: token缺失或无效为401, scope不满足为403, 读取Body失败为400(超出长度为413)
+func checkToken(
+	r *http.Request,
+	req_opts *requestOption,
+) (*TokenAuth.Identity, int, error) {
+	var identity *TokenAuth.Identity
+	var err error
+	switch req_opts.CheckToken {
+	case CheckToken_APIKey:
+		identity, err = TokenAuth.CheckAPIKey(r)
+	case CheckToken_HMAC:
+		var body []byte
+		if body, err = read_body(r); err != nil {
+			if errors.Is(err, ErrBodyTooLarge) {
+				return nil, http.StatusRequestEntityTooLarge, err
+			}
+			return nil, http.StatusBadRequest, err
+		}
+		identity, err = TokenAuth.CheckHMAC(r, body)
+	case CheckToken_JWT:
+		identity, err = TokenAuth.CheckJWT(r)
+	default:
+		return nil, http.StatusInternalServerError, errors.New("check token version not support")
+	}
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	if !identity.Allow(req_opts.TokenScope) {
+		return identity, http.StatusForbidden, errors.New("token scope forbidden")
+	}
+	return identity, http.StatusOK, nil
+}
+
+// tokenResultCode checkToken返回的HTTP状态码转换为错误码, HTTP与gRPC请求返回相同的错误码
+func tokenResultCode(header int) int32 {
+	switch header {
+	case http.StatusUnauthorized:
+		return int32(GateWayProtos.ResultType_ERR_Unauthorized)
+	case http.StatusForbidden:
+		return int32(GateWayProtos.ResultType_ERR_Forbidden)
+	}
+	return int32(GateWayProtos.ResultType_ERR_Decode_Request)
+}
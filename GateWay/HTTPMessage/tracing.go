@@ -0,0 +1,30 @@
+package HTTPMessage
+
+import (
+	"GateWayCommon/Tracing"
+	"context"
+	"net/http"
+)
+
+// header_trace_response 返回给调用方的Span信息, 格式同traceparent (W3C Trace Context Level 2)
+const header_trace_response = "Traceresponse"
+
+// startServerSpan 创建请求的根Span, get为Header/metadata取值函数
+//	请求带有效traceparent时作为其子Span, 未启用追踪时仍透传traceparent
+func startServerSpan(
+	ctx context.Context,
+	get func(key string) string,
+	name string,
+) (context.Context, *Tracing.Span) {
+	if sc, ok := Tracing.Extract(get); ok {
+		ctx = Tracing.ContextWithRemote(ctx, sc)
+	}
+	return Tracing.Start(ctx, name, Tracing.SpanKind_Server)
+}
+
+// setTraceResponse 通过Header返回Span信息, 未启用追踪不返回
+func setTraceResponse(w http.ResponseWriter, span *Tracing.Span) {
+	if sc := span.SpanContext(); sc.IsValid() {
+		w.Header().Set(header_trace_response, sc.Traceparent())
+	}
+}
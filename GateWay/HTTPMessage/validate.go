@@ -0,0 +1,328 @@
+package HTTPMessage
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// 校验规则名称, 用于返回错误
+const (
+	rule_required  = "required"
+	rule_min       = "min"
+	rule_max       = "max"
+	rule_min_len   = "min_len"
+	rule_max_len   = "max_len"
+	rule_pattern   = "pattern"
+	rule_enum      = "enum"
+	rule_min_items = "min_items"
+	rule_max_items = "max_items"
+)
+
+// FieldRule 请求字段校验规则, 数值为0(或nil)的规则不校验
+//	repeated字段的 Min/Max/MinLen/MaxLen/Pattern/Enum 对每个元素校验
+type FieldRule struct {
+	Field    string   // 字段路径, 支持点分嵌套Message, 如: user_id / item.ll_id
+	Required bool     // 必须存在
+	Min      *float64 // 数值最小值(含)
+	Max      *float64 // 数值最大值(含)
+	MinLen   int      // string/bytes最小长度, string按字符计算
+	MaxLen   int      // string/bytes最大长度
+	Pattern  string   // string正则
+	Enum     []string // 允许值; enum字段可以写名称或数值
+	MinItems int      // repeated/map最少元素数
+	MaxItems int      // repeated/map最多元素数
+}
+
+// FieldError 字段校验错误
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Msg   string `json:"msg"`
+}
+
+// ValidationError 请求校验错误, 包含全部不通过的字段
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	strList := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		strList = append(strList, fe.Field+": "+fe.Msg)
+	}
+	return "request validation failed: " + strings.Join(strList, "; ")
+}
+
+type fieldValidator struct {
+	rule    FieldRule
+	path    []protoreflect.FieldDescriptor // 字段路径, 最后一个为校验字段
+	pattern *regexp.Regexp
+	enum    map[string]bool // 允许值, 按 protoValueString 格式
+}
+
+// requestValidator 路由请求校验, 通过newRequestValidator生成
+type requestValidator struct {
+	fields []*fieldValidator
+}
+
+// newRequestValidator 根据请求Proto校验规则配置
+func newRequestValidator(
+	md protoreflect.MessageDescriptor,
+	rules []FieldRule,
+) (*requestValidator, error) {
+	v := &requestValidator{}
+	for _, rule := range rules {
+		fv, err := newFieldValidator(md, rule)
+		if err != nil {
+			return nil, errors.New(err.Error() + ", field = " + rule.Field)
+		}
+		v.fields = append(v.fields, fv)
+	}
+	return v, nil
+}
+
+func newFieldValidator(
+	md protoreflect.MessageDescriptor,
+	rule FieldRule,
+) (*fieldValidator, error) {
+	fv := &fieldValidator{rule: rule}
+
+	// 解析字段路径, 中间字段必须为非repeated的Message
+	for i, name := range strings.Split(rule.Field, ".") {
+		if i > 0 {
+			last := fv.path[i-1]
+			if last.Message() == nil || last.IsList() || last.IsMap() {
+				return nil, errors.New("validate field path invalid")
+			}
+			md = last.Message()
+		}
+		fd := findField(md, name)
+		if fd == nil {
+			return nil, errors.New("validate field not found")
+		}
+		fv.path = append(fv.path, fd)
+	}
+	fd := fv.path[len(fv.path)-1]
+
+	if rule.MinLen < 0 || rule.MaxLen < 0 || rule.MinItems < 0 || rule.MaxItems < 0 {
+		return nil, errors.New("validate rule invalid")
+	}
+	if (rule.MinItems > 0 || rule.MaxItems > 0) && !fd.IsList() && !fd.IsMap() {
+		return nil, errors.New("validate items rule on non repeated field")
+	}
+
+	// 元素校验规则
+	if rule.Min != nil || rule.Max != nil || rule.MinLen > 0 || rule.MaxLen > 0 ||
+		rule.Pattern != "" || len(rule.Enum) > 0 {
+		if fd.IsMap() || fd.Message() != nil {
+			return nil, errors.New("validate value rule on message or map field")
+		}
+	}
+	if (rule.Min != nil || rule.Max != nil) && !isNumberKind(fd.Kind()) {
+		return nil, errors.New("validate range rule on non number field")
+	}
+	if (rule.MinLen > 0 || rule.MaxLen > 0) &&
+		fd.Kind() != protoreflect.StringKind && fd.Kind() != protoreflect.BytesKind {
+		return nil, errors.New("validate length rule on non string field")
+	}
+	if rule.Pattern != "" {
+		if fd.Kind() != protoreflect.StringKind {
+			return nil, errors.New("validate pattern rule on non string field")
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, errors.New("validate pattern invalid")
+		}
+		fv.pattern = pattern
+	}
+	if len(rule.Enum) > 0 {
+		fv.enum = make(map[string]bool, len(rule.Enum))
+		for _, str := range rule.Enum {
+			val, err := parseScalar(fd, str)
+			if err != nil {
+				return nil, errors.New("validate enum value invalid: " + str)
+			}
+			key, _ := protoValueString(fd, val)
+			fv.enum[key] = true
+		}
+	}
+	return fv, nil
+}
+
+func isNumberKind(kind protoreflect.Kind) bool {
+	switch kind {
+	case protoreflect.EnumKind,
+		protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind,
+		protoreflect.FloatKind, protoreflect.DoubleKind:
+		return true
+	default:
+		return false
+	}
+}
+
+// validate 校验请求, 返回全部不通过的字段, 通过返回nil
+//	present 为请求中出现的顶层字段(proto字段名), nil则按字段是否为非默认值判断
+func (v *requestValidator) validate(
+	m protoreflect.Message,
+	present map[string]bool,
+) *ValidationError {
+	if v == nil {
+		return nil
+	}
+	var fieldErrors []FieldError
+	for _, fv := range v.fields {
+		fieldErrors = fv.validate(m, present, fieldErrors)
+	}
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: fieldErrors}
+}
+
+func (fv *fieldValidator) validate(
+	m protoreflect.Message,
+	present map[string]bool,
+	fieldErrors []FieldError,
+) []FieldError {
+	field := fv.rule.Field
+	rule := fv.rule
+
+	// 查找字段所在的Message, 中间Message不存在视为字段不存在
+	exist := true
+	for i, fd := range fv.path[:len(fv.path)-1] {
+		if i == 0 && present != nil {
+			exist = present[string(fd.Name())]
+		} else {
+			exist = m.Has(fd)
+		}
+		if !exist {
+			break
+		}
+		m = m.Get(fd).Message()
+	}
+	fd := fv.path[len(fv.path)-1]
+	if exist {
+		if len(fv.path) == 1 && present != nil {
+			exist = present[string(fd.Name())]
+		} else {
+			exist = m.Has(fd)
+		}
+	}
+
+	if !exist {
+		if rule.Required {
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Rule: rule_required, Msg: "is required"})
+		}
+		if rule.MinItems > 0 {
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Rule: rule_min_items,
+				Msg: "must have at least " + strconv.Itoa(rule.MinItems) + " items"})
+		}
+		return fieldErrors
+	}
+
+	switch {
+	case fd.IsMap():
+		return fv.validateItems(m.Get(fd).Map().Len(), fieldErrors)
+	case fd.IsList():
+		list := m.Get(fd).List()
+		fieldErrors = fv.validateItems(list.Len(), fieldErrors)
+		for i := 0; i < list.Len(); i++ {
+			fieldErrors = fv.validateValue(field+"["+strconv.Itoa(i)+"]", fd, list.Get(i), fieldErrors)
+		}
+		return fieldErrors
+	default:
+		return fv.validateValue(field, fd, m.Get(fd), fieldErrors)
+	}
+}
+
+// validateItems 校验repeated/map元素数
+func (fv *fieldValidator) validateItems(n int, fieldErrors []FieldError) []FieldError {
+	if fv.rule.MinItems > 0 && n < fv.rule.MinItems {
+		fieldErrors = append(fieldErrors, FieldError{Field: fv.rule.Field, Rule: rule_min_items,
+			Msg: "must have at least " + strconv.Itoa(fv.rule.MinItems) + " items"})
+	}
+	if fv.rule.MaxItems > 0 && n > fv.rule.MaxItems {
+		fieldErrors = append(fieldErrors, FieldError{Field: fv.rule.Field, Rule: rule_max_items,
+			Msg: "must have at most " + strconv.Itoa(fv.rule.MaxItems) + " items"})
+	}
+	return fieldErrors
+}
+
+// validateValue 校验标量值
+func (fv *fieldValidator) validateValue(
+	field string,
+	fd protoreflect.FieldDescriptor,
+	v protoreflect.Value,
+	fieldErrors []FieldError,
+) []FieldError {
+	rule := fv.rule
+
+	if rule.Min != nil || rule.Max != nil {
+		num := numberValue(fd, v)
+		if rule.Min != nil && num < *rule.Min {
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Rule: rule_min,
+				Msg: "must be >= " + strconv.FormatFloat(*rule.Min, 'f', -1, 64)})
+		}
+		if rule.Max != nil && num > *rule.Max {
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Rule: rule_max,
+				Msg: "must be <= " + strconv.FormatFloat(*rule.Max, 'f', -1, 64)})
+		}
+	}
+
+	if rule.MinLen > 0 || rule.MaxLen > 0 {
+		var n int
+		if fd.Kind() == protoreflect.StringKind {
+			n = utf8.RuneCountInString(v.String())
+		} else {
+			n = len(v.Bytes())
+		}
+		if rule.MinLen > 0 && n < rule.MinLen {
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Rule: rule_min_len,
+				Msg: "length must be >= " + strconv.Itoa(rule.MinLen)})
+		}
+		if rule.MaxLen > 0 && n > rule.MaxLen {
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Rule: rule_max_len,
+				Msg: "length must be <= " + strconv.Itoa(rule.MaxLen)})
+		}
+	}
+
+	if fv.pattern != nil && !fv.pattern.MatchString(v.String()) {
+		fieldErrors = append(fieldErrors, FieldError{Field: field, Rule: rule_pattern,
+			Msg: "must match " + rule.Pattern})
+	}
+
+	if fv.enum != nil {
+		if key, _ := protoValueString(fd, v); !fv.enum[key] {
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Rule: rule_enum,
+				Msg: "must be one of [" + strings.Join(rule.Enum, ", ") + "]"})
+		}
+	}
+	return fieldErrors
+}
+
+// numberValue 数值字段转float64
+func numberValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) float64 {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return float64(v.Enum())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return float64(v.Int())
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return float64(v.Uint())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return v.Float()
+	default:
+		return math.NaN()
+	}
+}
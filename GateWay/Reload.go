@@ -0,0 +1,246 @@
+package main
+
+import (
+	"AlgoGateWay/GateWay/HTTPMessage"
+	"GateWayCommon/AddrLimiter"
+	"GateWayCommon/GroundRules"
+	"GateWayCommon/RateLimiter"
+	"GateWayCommon/RegisterCenter"
+	"GateWayCommon/TokenAuth"
+	"GateWayCommon/Tracing"
+	"GateWayCommon/logger"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const config_watch_interval = 3 * time.Second // 配置文件检查间隔
+
+// preparedConfig 校验通过, 可以直接替换的配置
+type preparedConfig struct {
+	g_config *s_serverConfig
+	logLevel logger.Level
+	routes   *HTTPMessage.RouteTable
+	poolMap  map[int32]*GroundRules.ItemPool
+	checker  *TokenAuth.Checker
+	limiter  *AddrLimiter.Limiter
+	rate     *RateLimiter.Limiter
+	retry    *RegisterCenter.RetryPolicies
+	batch    *RegisterCenter.BatchPolicies
+	compress *HTTPMessage.Compression
+	tracer   *Tracing.Tracer
+	admin    *HTTPMessage.Admin
+}
+
+// prepareConfig 校验配置并预先加载路由及兜底物料池, 任一项失败则整体失败
+//	prevRoutes为当前路由表, 首次加载为nil
+func prepareConfig(g_config *s_serverConfig, prevRoutes *HTTPMessage.RouteTable) (*preparedConfig, error) {
+	logLevel, err := g_config.logLevel()
+	if err != nil {
+		return nil, err
+	}
+
+	routes, err := HTTPMessage.BuildRoutes(g_config.Routes, prevRoutes)
+	if err != nil {
+		return nil, err
+	}
+
+	// IP白名单合并到默认名单
+	limiterConf := AddrLimiter.Config{
+		Lists:          make(map[string]AddrLimiter.ListConfig, len(g_config.AddrLimiter.Lists)+1),
+		TrustedProxies: g_config.AddrLimiter.TrustedProxies,
+	}
+	for name, list := range g_config.AddrLimiter.Lists {
+		limiterConf.Lists[name] = list
+	}
+	defaultList := limiterConf.Lists[AddrLimiter.DefaultList]
+	defaultList.Allow = append(append([]string{}, defaultList.Allow...), g_config.IPWhiteList...)
+	limiterConf.Lists[AddrLimiter.DefaultList] = defaultList
+	limiter, err := AddrLimiter.Build(limiterConf)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := RateLimiter.Build(g_config.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	retry, err := RegisterCenter.BuildRetryPolicies(g_config.Retry)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := RegisterCenter.BuildBatchPolicies(g_config.Batch)
+	if err != nil {
+		return nil, err
+	}
+
+	compress, err := HTTPMessage.BuildCompression(g_config.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, route := range g_config.Routes {
+		if route.CheckIP != "" && !limiter.HasList(route.CheckIP) {
+			return nil, errors.New("route check_ip list not found, path = " + route.Path)
+		}
+	}
+
+	admin, err := HTTPMessage.BuildAdmin(g_config.Admin)
+	if err != nil {
+		return nil, err
+	}
+	if g_config.Admin.CheckIP != "" && !limiter.HasList(g_config.Admin.CheckIP) {
+		return nil, errors.New("admin check_ip list not found")
+	}
+
+	checker, err := TokenAuth.Build(g_config.TokenAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	poolMap := make(map[int32]*GroundRules.ItemPool, len(g_config.GroundRules))
+	for _, groundRules := range g_config.GroundRules {
+		pool, err := GroundRules.LoadItemPool(groundRules.FileName)
+		if err != nil {
+			return nil, err
+		}
+		poolMap[groundRules.CMD] = pool
+	}
+
+	// 启动导出协程, 放在最后校验
+	tracer, err := Tracing.Build(g_config.Tracing)
+	if err != nil {
+		return nil, err
+	}
+
+	return &preparedConfig{
+		g_config: g_config,
+		logLevel: logLevel,
+		routes:   routes,
+		poolMap:  poolMap,
+		checker:  checker,
+		limiter:  limiter,
+		rate:     rate,
+		retry:    retry,
+		batch:    batch,
+		compress: compress,
+		tracer:   tracer,
+		admin:    admin,
+	}, nil
+}
+
+// applyConfig 替换配置, 配置需已经过prepareConfig校验
+func (app *Application) applyConfig(prepared *preparedConfig) {
+	g_config := prepared.g_config
+
+	logger.SetLevel(prepared.logLevel)
+	AddrLimiter.Store(prepared.limiter)
+	RateLimiter.Store(prepared.rate)
+	GroundRules.StoreAll(prepared.poolMap)
+	TokenAuth.Store(prepared.checker)
+	RegisterCenter.SetBreakerConfig(g_config.CircuitBreaker)
+	RegisterCenter.StoreRetryPolicies(prepared.retry)
+	RegisterCenter.StoreBatchPolicies(prepared.batch)
+	HTTPMessage.StoreCompression(prepared.compress)
+	Tracing.Store(prepared.tracer)
+	HTTPMessage.StoreAdmin(prepared.admin)
+
+	if app.HttpReceiver != nil {
+		app.HttpReceiver.SetRoutes(prepared.routes)
+	}
+	if app.RegCenter != nil {
+		app.RegCenter.UpdateRegisterCenterAddr(g_config.RegisterCenterAddr)
+	}
+	app.Conf.Set(g_config)
+}
+
+// ReloadConfig 重新加载配置文件, 失败则保留原有配置
+func (app *Application) ReloadConfig() error {
+	g_config, err := app.Conf.Load()
+	if err != nil {
+		return err
+	}
+
+	// 修改需要重启的配置时拒绝重新加载, 避免部分配置生效
+	// P.s> 需在prepareConfig之前校验, prepareConfig会启动链路追踪导出协程
+	old_config := app.Conf.GetConfig()
+	if changed := restartFields(&old_config, g_config); len(changed) > 0 {
+		return errors.New("config " + strings.Join(changed, "/") + " changed, restart required")
+	}
+
+	var prevRoutes *HTTPMessage.RouteTable
+	if app.HttpReceiver != nil {
+		prevRoutes = app.HttpReceiver.Routes()
+	}
+	prepared, err := prepareConfig(g_config, prevRoutes)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(old_config.RegisterCenterAddr, g_config.RegisterCenterAddr) {
+		logger.Log().WithFields(logger.Fields{
+			"old": old_config.RegisterCenterAddr,
+			"new": g_config.RegisterCenterAddr,
+		}).Info("Config RegisterCenterAddr changed")
+	}
+
+	app.applyConfig(prepared)
+	return nil
+}
+
+// restartFields 需要重启服务才能生效且已修改的配置项
+func restartFields(old_config *s_serverConfig, g_config *s_serverConfig) []string {
+	var changed []string
+	if old_config.IP != g_config.IP {
+		changed = append(changed, "IP")
+	}
+	if old_config.Http != g_config.Http {
+		changed = append(changed, "Http")
+	}
+	if old_config.ServiceGroupTab != g_config.ServiceGroupTab {
+		changed = append(changed, "ServiceGroupTab")
+	}
+	if !reflect.DeepEqual(old_config.Discovery, g_config.Discovery) {
+		changed = append(changed, "Discovery")
+	}
+	// 启动时未使用注册中心, 不能通过重新加载开启
+	if len(old_config.RegisterCenterAddr) == 0 && len(g_config.RegisterCenterAddr) > 0 {
+		changed = append(changed, "RegisterCenterAddr")
+	}
+	return changed
+}
+
+// watchConfig 监听配置文件修改及SIGHUP信号, 重新加载配置
+func (app *Application) watchConfig(
+	hup <-chan os.Signal,
+	done <-chan struct{},
+) {
+	ticker := time.NewTicker(config_watch_interval)
+	defer ticker.Stop()
+
+	for {
+		reason := ""
+		select {
+		case <-done:
+			return
+		case <-hup:
+			reason = "SIGHUP"
+		case <-ticker.C:
+			if !app.Conf.Modified() {
+				continue
+			}
+			reason = "file modified"
+		}
+
+		if err := app.ReloadConfig(); err != nil {
+			logger.Log().WithFields(logger.Fields{
+				"reason": reason,
+				"err":    err,
+			}).Error("Config Reload Failed, keep old config")
+		} else {
+			logger.Log().WithField("reason", reason).Info("Config Reload Succ")
+		}
+	}
+}
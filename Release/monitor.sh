@@ -104,6 +104,47 @@ status_server() {
     fi
 }
 
+# 网关实例地址, 取自config/server.json
+getaddrs() {
+    addrs=$(
+        python <<-EOF
+import json
+with open('./config/server.json') as f:
+    for server in json.load(f)['server_list']:
+        print(server['ip'] + ':' + server['port'])
+EOF
+    )
+}
+
+# 检查网关存活及就绪状态
+# /healthz 进程存活, /readyz 注册中心可达/依赖服务有可用连接/未在下线
+# 返回值: 0 全部就绪, 1 存在未存活实例, 2 全部存活但存在未就绪实例
+health_server() {
+    getaddrs
+    ret=0
+    for addr in $addrs; do
+        code=$(curl -s -o /dev/null -w "%{http_code}" --max-time 2 "http://${addr}/healthz")
+        if [ "$code" != "200" ]; then
+            echo "${addr} is not alive (healthz: ${code})."
+            ret=1
+            continue
+        fi
+
+        resp=$(curl -s -w "\n%{http_code}" --max-time 2 "http://${addr}/readyz")
+        code=${resp##*$'\n'}
+        body=${resp%$'\n'*}
+        if [ "$code" != "200" ]; then
+            echo "${addr} is alive but not ready (readyz: ${code}): ${body}"
+            if [ "$ret" -eq 0 ]; then
+                ret=2
+            fi
+        else
+            echo "${addr} is ready."
+        fi
+    done
+    exit $ret
+}
+
 case "$1" in
 'stop')
     stop_server $1
@@ -120,8 +161,11 @@ case "$1" in
 'status')
     status_server $1
     ;;
+'health')
+    health_server $1
+    ;;
 *)
-    printf "action : start | stop | restart | status \n"
+    printf "action : start | stop | restart | status | health \n"
     exit 1
     ;;
 esac